@@ -0,0 +1,754 @@
+package duitdraw
+
+import "sort"
+
+// This is the Unicode bidirectional algorithm (UAX #9) for a single line of text.
+// It resolves explicit embeddings, overrides and isolates (X1-X10), weak
+// and neutral types including paired brackets (W1-W7, N0-N2) and implicit
+// levels (I1, I2), and reorders the line (L1, L2). Each paragraph
+// separator starts a new paragraph with its own direction.
+// Mirroring (L4) is done by the shaper, which also keeps combining marks
+// with their base (L3).
+
+type bidiClass uint8
+
+const (
+	bidiL   bidiClass = iota // Left-to-right.
+	bidiR                    // Right-to-left.
+	bidiAL                   // Arabic letter.
+	bidiEN                   // European number.
+	bidiES                   // European separator.
+	bidiET                   // European terminator.
+	bidiAN                   // Arabic number.
+	bidiCS                   // Common separator.
+	bidiNSM                  // Nonspacing mark.
+	bidiBN                   // Boundary neutral.
+	bidiB                    // Paragraph separator.
+	bidiS                    // Segment separator.
+	bidiWS                   // Whitespace.
+	bidiON                   // Other neutral.
+	bidiLRE                  // Left-to-right embedding.
+	bidiLRO                  // Left-to-right override.
+	bidiRLE                  // Right-to-left embedding.
+	bidiRLO                  // Right-to-left override.
+	bidiPDF                  // Pop directional format.
+	bidiLRI                  // Left-to-right isolate.
+	bidiRLI                  // Right-to-left isolate.
+	bidiFSI                  // First strong isolate.
+	bidiPDI                  // Pop directional isolate.
+)
+
+// BidiMaxDepth is the maximum explicit embedding level.
+const bidiMaxDepth = 125
+
+func bidiClassOf(r rune) bidiClass {
+	i := sort.Search(len(bidiClasses), func(i int) bool { return bidiClasses[i].hi >= r })
+	if i < len(bidiClasses) && bidiClasses[i].lo <= r {
+		return bidiClasses[i].class
+	}
+	return bidiL
+}
+
+// RemovedByX9 reports if characters of class c are ignored after X9.
+func removedByX9(c bidiClass) bool {
+	switch c {
+	case bidiLRE, bidiRLE, bidiLRO, bidiRLO, bidiPDF, bidiBN:
+		return true
+	}
+	return false
+}
+
+// IsBidiControl reports if r is an explicit directional formatting
+// character or a directional mark, which are not drawn.
+func isBidiControl(r rune) bool {
+	switch r {
+	case 0x061C, 0x200E, 0x200F:
+		return true
+	}
+	c := bidiClassOf(r)
+	return c >= bidiLRE && c <= bidiPDI
+}
+
+func isIsolateInitiator(c bidiClass) bool {
+	return c == bidiLRI || c == bidiRLI || c == bidiFSI
+}
+
+// BidiBracket returns the closing bracket of an opening bracket r,
+// or r itself and false. Brackets are compared after canonical
+// decomposition, which maps U+2329 and U+232A to U+3008 and U+3009.
+func bidiBracket(r rune) (rune, bool) {
+	i := sort.Search(len(bidiBrackets), func(i int) bool { return bidiBrackets[i][0] >= r })
+	if i < len(bidiBrackets) && bidiBrackets[i][0] == r {
+		return canonicalBracket(bidiBrackets[i][1]), true
+	}
+	return r, false
+}
+
+func canonicalBracket(r rune) rune {
+	switch r {
+	case 0x2329:
+		return 0x3008
+	case 0x232A:
+		return 0x3009
+	}
+	return r
+}
+
+// IsClosingBracket reports if r is a closing paired bracket.
+func isClosingBracket(r rune) bool {
+	_, ok := closingBrackets[r]
+	return ok
+}
+
+// ClosingBrackets maps closing paired brackets to their opening brackets.
+var closingBrackets = func() map[rune]rune {
+	m := make(map[rune]rune, len(bidiBrackets))
+	for _, b := range bidiBrackets {
+		m[b[1]] = b[0]
+	}
+	return m
+}()
+
+// BidiMirror maps characters with the Bidi_Mirrored property, which are
+// not paired brackets, to their mirror image.
+var bidiMirror = map[rune]rune{
+	'<': '>', '>': '<',
+	'«': '»', '»': '«',
+	'‹': '›', '›': '‹',
+	'≤': '≥', '≥': '≤',
+	'≪': '≫', '≫': '≪',
+	'⊂': '⊃', '⊃': '⊂',
+	'⊆': '⊇', '⊇': '⊆',
+	'∈': '∋', '∋': '∈',
+}
+
+// MirrorRune returns the mirror image of r for right-to-left text (L4).
+func mirrorRune(r rune) rune {
+	if c, ok := bidiBracket(r); ok {
+		return c
+	}
+	if o, ok := closingBrackets[r]; ok {
+		return o
+	}
+	if m, ok := bidiMirror[r]; ok {
+		return m
+	}
+	return r
+}
+
+// HasRTL returns if the string contains right-to-left text or
+// explicit formatting characters. Other strings do not need to be reordered.
+func hasRTL(s string) bool {
+	for _, r := range s {
+		if r >= 0x0590 {
+			switch bidiClassOf(r) {
+			case bidiR, bidiAL, bidiAN, bidiLRE, bidiRLE, bidiLRO, bidiRLO, bidiLRI, bidiRLI, bidiFSI:
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// BidiParagraph holds the state of the algorithm for one paragraph.
+type bidiParagraph struct {
+	runes    []rune
+	initial  []bidiClass // Classes of the runes.
+	types    []bidiClass // Resolved classes.
+	levels   []int8
+	level    int8   // Paragraph embedding level.
+	matching []int  // Index of the matching PDI of an isolate initiator, or -1.
+	matched  []bool // The PDI has a matching isolate initiator.
+}
+
+// BidiLevels resolves the embedding levels of a line of text.
+// Dir is the paragraph level, 0 or 1, or -1 to take it from the first
+// strong character of each paragraph (P2, P3).
+// It returns the level of each rune, after the line rules L1,
+// and the level of the first paragraph.
+// Runes removed by X9 are reported in removed and have the level of the
+// preceding rune.
+func bidiLevels(rs []rune, dir int) (levels []int8, removed []bool, paraLevel int8) {
+	levels = make([]int8, len(rs))
+	removed = make([]bool, len(rs))
+	paraLevel = -1
+	for start := 0; start < len(rs); {
+		end := start
+		for end < len(rs) && bidiClassOf(rs[end]) != bidiB {
+			end++
+		}
+		if end < len(rs) {
+			end++ // The paragraph separator belongs to the paragraph.
+		}
+		p := newBidiParagraph(rs[start:end], dir)
+		p.resolve()
+		p.lineLevels()
+		copy(levels[start:], p.levels)
+		for i, c := range p.initial {
+			removed[start+i] = removedByX9(c)
+		}
+		if paraLevel < 0 {
+			paraLevel = p.level
+		}
+		start = end
+	}
+	if paraLevel < 0 {
+		paraLevel = 0
+		if dir == 1 {
+			paraLevel = 1
+		}
+	}
+	return levels, removed, paraLevel
+}
+
+func newBidiParagraph(rs []rune, dir int) *bidiParagraph {
+	n := len(rs)
+	p := &bidiParagraph{
+		runes:    rs,
+		initial:  make([]bidiClass, n),
+		types:    make([]bidiClass, n),
+		levels:   make([]int8, n),
+		matching: make([]int, n),
+		matched:  make([]bool, n),
+	}
+	for i, r := range rs {
+		p.initial[i] = bidiClassOf(r)
+	}
+	copy(p.types, p.initial)
+
+	// BD9: matching isolate initiators and PDIs.
+	var stack []int
+	for i, c := range p.initial {
+		p.matching[i] = -1
+		switch {
+		case isIsolateInitiator(c):
+			stack = append(stack, i)
+		case c == bidiPDI && len(stack) > 0:
+			p.matching[stack[len(stack)-1]] = i
+			p.matched[i] = true
+			stack = stack[:len(stack)-1]
+		}
+	}
+
+	switch dir {
+	case 0, 1:
+		p.level = int8(dir)
+	default:
+		if p.firstStrong(0, n) == bidiR {
+			p.level = 1
+		}
+	}
+	return p
+}
+
+// FirstStrong returns L or R for the first strong character from start
+// to end, skipping isolated text (P2), or ON if there is none.
+func (p *bidiParagraph) firstStrong(start, end int) bidiClass {
+	for i := start; i < end; i++ {
+		switch c := p.initial[i]; {
+		case c == bidiL:
+			return bidiL
+		case c == bidiR || c == bidiAL:
+			return bidiR
+		case isIsolateInitiator(c):
+			if p.matching[i] < 0 {
+				return bidiON
+			}
+			i = p.matching[i]
+		}
+	}
+	return bidiON
+}
+
+func (p *bidiParagraph) resolve() {
+	p.explicitLevels()
+	for _, seq := range p.isolatingRunSequences() {
+		seq.resolveWeakTypes()
+		seq.resolvePairedBrackets()
+		seq.resolveNeutralTypes()
+		seq.resolveImplicitLevels()
+	}
+}
+
+// ExplicitLevels applies the rules X1 to X8.
+func (p *bidiParagraph) explicitLevels() {
+	type status struct {
+		level    int8
+		override bidiClass // L, R or ON for no override.
+		isolate  bool
+	}
+	stack := []status{{level: p.level, override: bidiON}}
+	overflowIsolates, overflowEmbeddings, validIsolates := 0, 0, 0
+
+	// Next returns the least odd or even level greater than l.
+	next := func(l int8, rtl bool) int8 {
+		if rtl {
+			return (l + 1) | 1
+		}
+		return (l + 2) &^ 1
+	}
+
+	for i, c := range p.initial {
+		top := stack[len(stack)-1]
+		p.levels[i] = top.level
+		switch c {
+		case bidiRLE, bidiLRE, bidiRLO, bidiLRO:
+			l := next(top.level, c == bidiRLE || c == bidiRLO)
+			if l <= bidiMaxDepth && overflowIsolates == 0 && overflowEmbeddings == 0 {
+				s := status{level: l, override: bidiON}
+				if c == bidiRLO {
+					s.override = bidiR
+				} else if c == bidiLRO {
+					s.override = bidiL
+				}
+				stack = append(stack, s)
+			} else if overflowIsolates == 0 {
+				overflowEmbeddings++
+			}
+
+		case bidiRLI, bidiLRI, bidiFSI:
+			if top.override != bidiON {
+				p.types[i] = top.override
+			}
+			rtl := c == bidiRLI
+			if c == bidiFSI {
+				end := p.matching[i]
+				if end < 0 {
+					end = len(p.initial)
+				}
+				rtl = p.firstStrong(i+1, end) == bidiR
+			}
+			l := next(top.level, rtl)
+			if l <= bidiMaxDepth && overflowIsolates == 0 && overflowEmbeddings == 0 {
+				validIsolates++
+				stack = append(stack, status{level: l, override: bidiON, isolate: true})
+			} else {
+				overflowIsolates++
+			}
+
+		case bidiPDI:
+			if overflowIsolates > 0 {
+				overflowIsolates--
+			} else if validIsolates > 0 {
+				overflowEmbeddings = 0
+				for !stack[len(stack)-1].isolate {
+					stack = stack[:len(stack)-1]
+				}
+				stack = stack[:len(stack)-1]
+				validIsolates--
+			}
+			top = stack[len(stack)-1]
+			p.levels[i] = top.level
+			if top.override != bidiON {
+				p.types[i] = top.override
+			}
+
+		case bidiPDF:
+			if overflowIsolates > 0 {
+			} else if overflowEmbeddings > 0 {
+				overflowEmbeddings--
+			} else if !top.isolate && len(stack) >= 2 {
+				stack = stack[:len(stack)-1]
+			}
+
+		case bidiB:
+			p.levels[i] = p.level
+
+		case bidiBN:
+
+		default:
+			if top.override != bidiON {
+				p.types[i] = top.override
+			}
+		}
+	}
+}
+
+// BidiSequence is an isolating run sequence (BD13).
+type bidiSequence struct {
+	p        *bidiParagraph
+	indexes  []int // Indexes of the runes in the paragraph.
+	types    []bidiClass
+	level    int8
+	sos, eos bidiClass
+}
+
+// IsolatingRunSequences applies the rules X9 and X10.
+func (p *bidiParagraph) isolatingRunSequences() []*bidiSequence {
+	// Level runs, ignoring the characters removed by X9.
+	var runs [][]int
+	level := int8(-1)
+	for i, c := range p.initial {
+		if removedByX9(c) {
+			continue
+		}
+		if len(runs) == 0 || p.levels[i] != level {
+			runs = append(runs, nil)
+			level = p.levels[i]
+		}
+		runs[len(runs)-1] = append(runs[len(runs)-1], i)
+	}
+
+	runOf := make(map[int]int) // Run index by its first character.
+	for k, run := range runs {
+		runOf[run[0]] = k
+	}
+
+	var seqs []*bidiSequence
+	for _, run := range runs {
+		first := run[0]
+		if p.matched[first] {
+			continue // Part of the sequence of its isolate initiator.
+		}
+		var indexes []int
+		for {
+			indexes = append(indexes, run...)
+			last := run[len(run)-1]
+			if !isIsolateInitiator(p.initial[last]) || p.matching[last] < 0 {
+				break
+			}
+			k, ok := runOf[p.matching[last]]
+			if !ok {
+				break
+			}
+			run = runs[k]
+		}
+		seqs = append(seqs, p.newSequence(indexes))
+	}
+	return seqs
+}
+
+func (p *bidiParagraph) newSequence(indexes []int) *bidiSequence {
+	s := &bidiSequence{
+		p:       p,
+		indexes: indexes,
+		types:   make([]bidiClass, len(indexes)),
+		level:   p.levels[indexes[0]],
+	}
+	for k, i := range indexes {
+		s.types[k] = p.types[i]
+	}
+
+	prev := p.level
+	for i := indexes[0] - 1; i >= 0; i-- {
+		if !removedByX9(p.initial[i]) {
+			prev = p.levels[i]
+			break
+		}
+	}
+	next := p.level
+	if last := indexes[len(indexes)-1]; !isIsolateInitiator(p.initial[last]) {
+		for i := last + 1; i < len(p.initial); i++ {
+			if !removedByX9(p.initial[i]) {
+				next = p.levels[i]
+				break
+			}
+		}
+	}
+	s.sos = levelDir(max8(prev, s.level))
+	s.eos = levelDir(max8(next, s.level))
+	return s
+}
+
+func levelDir(l int8) bidiClass {
+	if l%2 == 0 {
+		return bidiL
+	}
+	return bidiR
+}
+
+func max8(a, b int8) int8 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// StrongDir returns the direction of a resolved type for N0 to N2:
+// numbers count as R, and neutrals as ON.
+func strongDir(c bidiClass) bidiClass {
+	switch c {
+	case bidiL:
+		return bidiL
+	case bidiR, bidiAL, bidiEN, bidiAN:
+		return bidiR
+	}
+	return bidiON
+}
+
+// ResolveWeakTypes applies the rules W1 to W7.
+func (s *bidiSequence) resolveWeakTypes() {
+	t := s.types
+
+	// W1: nonspacing marks take the type of the previous character.
+	for k, c := range t {
+		if c != bidiNSM {
+			continue
+		}
+		switch {
+		case k == 0:
+			t[k] = s.sos
+		case isIsolateInitiator(t[k-1]) || t[k-1] == bidiPDI:
+			t[k] = bidiON
+		default:
+			t[k] = t[k-1]
+		}
+	}
+
+	// W2: European numbers after Arabic letters are Arabic numbers.
+	// W3: Arabic letters are right-to-left.
+	strong := s.sos
+	for k, c := range t {
+		switch c {
+		case bidiL, bidiR, bidiAL:
+			strong = c
+		case bidiEN:
+			if strong == bidiAL {
+				t[k] = bidiAN
+			}
+		}
+	}
+	for k, c := range t {
+		if c == bidiAL {
+			t[k] = bidiR
+		}
+	}
+
+	// W4: a single separator between two numbers of the same type.
+	for k := 1; k+1 < len(t); k++ {
+		switch {
+		case t[k] == bidiES && t[k-1] == bidiEN && t[k+1] == bidiEN:
+			t[k] = bidiEN
+		case t[k] == bidiCS && t[k-1] == bidiEN && t[k+1] == bidiEN:
+			t[k] = bidiEN
+		case t[k] == bidiCS && t[k-1] == bidiAN && t[k+1] == bidiAN:
+			t[k] = bidiAN
+		}
+	}
+
+	// W5: European terminators adjacent to European numbers.
+	for k := 0; k < len(t); k++ {
+		if t[k] != bidiET {
+			continue
+		}
+		j := k
+		for j < len(t) && t[j] == bidiET {
+			j++
+		}
+		if (k > 0 && t[k-1] == bidiEN) || (j < len(t) && t[j] == bidiEN) {
+			for i := k; i < j; i++ {
+				t[i] = bidiEN
+			}
+		}
+		k = j
+	}
+
+	// W6: remaining separators and terminators are neutral.
+	// W7: European numbers in left-to-right context are left-to-right.
+	strong = s.sos
+	for k, c := range t {
+		switch c {
+		case bidiES, bidiET, bidiCS:
+			t[k] = bidiON
+		case bidiL, bidiR:
+			strong = c
+		case bidiEN:
+			if strong == bidiL {
+				t[k] = bidiL
+			}
+		}
+	}
+}
+
+// ResolvePairedBrackets applies the rule N0.
+func (s *bidiSequence) resolvePairedBrackets() {
+	// BD16: identify the bracket pairs with a stack of 63 elements.
+	type opener struct {
+		closing rune
+		k       int
+	}
+	var stack []opener
+	var pairs [][2]int
+	rs := s.p.runes
+loop:
+	for k, i := range s.indexes {
+		if s.types[k] != bidiON {
+			continue
+		}
+		r := canonicalBracket(rs[i])
+		if c, ok := bidiBracket(r); ok {
+			if len(stack) == 63 {
+				break loop
+			}
+			stack = append(stack, opener{c, k})
+		} else if isClosingBracket(rs[i]) {
+			for j := len(stack) - 1; j >= 0; j-- {
+				if stack[j].closing == r {
+					pairs = append(pairs, [2]int{stack[j].k, k})
+					stack = stack[:j]
+					break
+				}
+			}
+		}
+	}
+	sort.Slice(pairs, func(a, b int) bool { return pairs[a][0] < pairs[b][0] })
+
+	e := levelDir(s.level)
+	for _, pair := range pairs {
+		open, close := pair[0], pair[1]
+		found := bidiON
+		for k := open + 1; k < close; k++ {
+			if d := strongDir(s.types[k]); d == e {
+				found = e
+				break
+			} else if d != bidiON {
+				found = d
+			}
+		}
+		if found == bidiON {
+			continue
+		}
+		if found != e {
+			before := s.sos
+			for k := open - 1; k >= 0; k-- {
+				if d := strongDir(s.types[k]); d != bidiON {
+					before = d
+					break
+				}
+			}
+			if before != found {
+				found = e
+			}
+		}
+		s.setBracket(open, found)
+		s.setBracket(close, found)
+	}
+}
+
+// SetBracket sets the type of a bracket and of the nonspacing marks following it.
+func (s *bidiSequence) setBracket(k int, c bidiClass) {
+	s.types[k] = c
+	for k++; k < len(s.types) && s.p.initial[s.indexes[k]] == bidiNSM; k++ {
+		s.types[k] = c
+	}
+}
+
+// ResolveNeutralTypes applies the rules N1 and N2.
+func (s *bidiSequence) resolveNeutralTypes() {
+	t := s.types
+	neutral := func(c bidiClass) bool {
+		switch c {
+		case bidiB, bidiS, bidiWS, bidiON, bidiLRI, bidiRLI, bidiFSI, bidiPDI:
+			return true
+		}
+		return false
+	}
+	e := levelDir(s.level)
+	for k := 0; k < len(t); k++ {
+		if !neutral(t[k]) {
+			continue
+		}
+		j := k
+		for j < len(t) && neutral(t[j]) {
+			j++
+		}
+		before, after := s.sos, s.eos
+		if k > 0 {
+			before = strongDir(t[k-1])
+		}
+		if j < len(t) {
+			after = strongDir(t[j])
+		}
+		c := e
+		if before == after {
+			c = before
+		}
+		for i := k; i < j; i++ {
+			t[i] = c
+		}
+		k = j
+	}
+}
+
+// ResolveImplicitLevels applies the rules I1 and I2.
+func (s *bidiSequence) resolveImplicitLevels() {
+	for k, i := range s.indexes {
+		l := s.p.levels[i]
+		switch c := s.types[k]; {
+		case l%2 == 0 && c == bidiR:
+			l++
+		case l%2 == 0 && (c == bidiAN || c == bidiEN):
+			l += 2
+		case l%2 == 1 && (c == bidiL || c == bidiEN || c == bidiAN):
+			l++
+		}
+		s.p.levels[i] = l
+	}
+}
+
+// LineLevels applies the rule L1 to the paragraph as a single line,
+// and gives removed characters the level of the preceding character.
+func (p *bidiParagraph) lineLevels() {
+	trailing := func(c bidiClass) bool {
+		switch c {
+		case bidiWS, bidiLRI, bidiRLI, bidiFSI, bidiPDI:
+			return true
+		}
+		return removedByX9(c)
+	}
+	reset := func(end int) {
+		for i := end - 1; i >= 0 && trailing(p.initial[i]); i-- {
+			p.levels[i] = p.level
+		}
+	}
+	for i, c := range p.initial {
+		if c == bidiS || c == bidiB {
+			p.levels[i] = p.level
+			reset(i)
+		}
+	}
+	reset(len(p.initial))
+
+	prev := p.level
+	for i, c := range p.initial {
+		if removedByX9(c) {
+			p.levels[i] = prev
+		} else {
+			prev = p.levels[i]
+		}
+	}
+}
+
+// BidiReorder returns the visual order of items with the given levels (L2):
+// from the highest level down to the lowest odd level, each run of items
+// at that level or higher is reversed.
+// Items are runes of a line, or runs of runes with the same level.
+func bidiReorder(levels []int8) []int {
+	order := make([]int, len(levels))
+	var hi, lo int8 = 0, bidiMaxDepth + 2
+	for i, l := range levels {
+		order[i] = i
+		if l > hi {
+			hi = l
+		}
+		if l%2 == 1 && l < lo {
+			lo = l
+		}
+	}
+	for l := hi; l >= lo; l-- {
+		for i := 0; i < len(order); i++ {
+			if levels[order[i]] < l {
+				continue
+			}
+			j := i
+			for j < len(order) && levels[order[j]] >= l {
+				j++
+			}
+			for a, b := i, j-1; a < b; a, b = a+1, b-1 {
+				order[a], order[b] = order[b], order[a]
+			}
+			i = j
+		}
+	}
+	return order
+}
@@ -0,0 +1,95 @@
+package duitdraw
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestBidiCharacters runs test cases in the format of BidiCharacterTest.txt.
+// Testdata/bidi_character_test.txt is generated with a reference
+// implementation. The test also runs the cases of the Unicode file
+// testdata/BidiCharacterTest.txt, if it is downloaded from
+// https://www.unicode.org/Public/17.0.0/ucd/BidiCharacterTest.txt.
+func TestBidiCharacters(t *testing.T) {
+	for _, name := range []string{"testdata/bidi_character_test.txt", "testdata/BidiCharacterTest.txt"} {
+		f, err := os.Open(name)
+		if os.IsNotExist(err) && name != "testdata/bidi_character_test.txt" {
+			continue
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		n, failed := 0, 0
+		s := bufio.NewScanner(f)
+		s.Buffer(nil, 1<<20)
+		for line := 1; s.Scan(); line++ {
+			text := s.Text()
+			if i := strings.Index(text, "#"); i >= 0 {
+				text = text[:i]
+			}
+			fields := strings.Split(text, ";")
+			if len(fields) != 5 {
+				continue
+			}
+			n++
+			if !testBidiLine(t, fields) {
+				t.Errorf("%s:%d: %s", name, line, s.Text())
+				if failed++; failed == 10 {
+					t.Fatal("too many failures")
+				}
+			}
+		}
+		f.Close()
+		if err := s.Err(); err != nil {
+			t.Fatal(err)
+		}
+		t.Logf("%s: %d test cases", name, n)
+	}
+}
+
+func testBidiLine(t *testing.T, fields []string) bool {
+	var rs []rune
+	for _, s := range strings.Fields(fields[0]) {
+		r, err := strconv.ParseUint(s, 16, 32)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs = append(rs, rune(r))
+	}
+	dir, _ := strconv.Atoi(fields[1])
+	if dir == 2 {
+		dir = -1
+	}
+	levels, removed, para := bidiLevels(rs, dir)
+	if strconv.Itoa(int(para)) != fields[2] {
+		t.Logf("paragraph level is %d", para)
+		return false
+	}
+
+	var got []string
+	for i, l := range levels {
+		if removed[i] {
+			got = append(got, "x")
+		} else {
+			got = append(got, strconv.Itoa(int(l)))
+		}
+	}
+	if s := strings.Join(got, " "); s != strings.Join(strings.Fields(fields[3]), " ") {
+		t.Logf("levels are %s", s)
+		return false
+	}
+
+	got = got[:0]
+	for _, i := range bidiReorder(levels) {
+		if !removed[i] {
+			got = append(got, strconv.Itoa(i))
+		}
+	}
+	if s := strings.Join(got, " "); s != strings.Join(strings.Fields(fields[4]), " ") {
+		t.Logf("visual order is %s", s)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,555 @@
+package duitdraw
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"sort"
+
+	"github.com/golang/freetype/truetype"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+// Color glyphs are read from the tables of the font file, as freetype
+// only supports outlines:
+//	CBLC/CBDT: PNG bitmaps in one or more sizes (e.g. Noto Color Emoji)
+//	COLR/CPAL: layers of outline glyphs with colors from a palette (version 0)
+
+// ColorTables holds the color tables of a font file.
+type colorTables struct {
+	cblc, cbdt []byte
+	colr       []byte
+	palette    []color.RGBA // First palette of the CPAL table.
+	outlines   bool         // The font has a glyf table.
+}
+
+// ParseColorTables returns the color tables of a truetype file,
+// or nil if it has none.
+func parseColorTables(ttf []byte) *colorTables {
+	if len(ttf) < 12 {
+		return nil
+	}
+	var t colorTables
+	n := int(u16(ttf, 4))
+	for i := 0; i < n; i++ {
+		x := 12 + 16*i
+		if x+16 > len(ttf) {
+			return nil
+		}
+		off, size := int(u32(ttf, x+8)), int(u32(ttf, x+12))
+		if off+size > len(ttf) {
+			continue
+		}
+		b := ttf[off : off+size]
+		switch string(ttf[x : x+4]) {
+		case "CBLC":
+			t.cblc = b
+		case "CBDT":
+			t.cbdt = b
+		case "COLR":
+			t.colr = b
+		case "CPAL":
+			t.palette = parseCPAL(b)
+		case "glyf":
+			t.outlines = true
+		}
+	}
+	if t.cblc == nil || t.cbdt == nil {
+		t.cblc, t.cbdt = nil, nil
+	}
+	if t.colr == nil || t.palette == nil {
+		t.colr = nil
+	}
+	if t.cblc == nil && t.colr == nil {
+		return nil
+	}
+	return &t
+}
+
+// Count returns n, limited to the number of records of the given size
+// which fit into b at offset x. It protects the loops over the records
+// of a truncated or malformed table.
+func count(b []byte, n, x, size int) int {
+	if x < 0 || x > len(b) {
+		return 0
+	}
+	if max := (len(b) - x) / size; n > max {
+		return max
+	}
+	return n
+}
+
+func u16(b []byte, i int) uint16 {
+	if i < 0 || i+2 > len(b) {
+		return 0
+	}
+	return binary.BigEndian.Uint16(b[i:])
+}
+
+func u32(b []byte, i int) uint32 {
+	if i < 0 || i+4 > len(b) {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b[i:])
+}
+
+// ParseCPAL returns the first palette of a CPAL table.
+func parseCPAL(b []byte) []color.RGBA {
+	if len(b) < 14 {
+		return nil
+	}
+	entries := int(u16(b, 2))
+	records := int(u32(b, 8))
+	first := int(u16(b, 12)) // Index of the first color record of palette 0.
+	p := make([]color.RGBA, entries)
+	for i := range p {
+		x := records + 4*(first+i)
+		if x+4 > len(b) {
+			return nil
+		}
+		// Colors are stored as BGRA and are not premultiplied.
+		c := color.NRGBA{R: b[x+2], G: b[x+1], B: b[x], A: b[x+3]}
+		p[i] = color.RGBAModel.Convert(c).(color.RGBA)
+	}
+	return p
+}
+
+// ColorLayer is a single layer of a COLR glyph.
+type colorLayer struct {
+	glyph      truetype.Index
+	color      color.RGBA
+	foreground bool // Use the text color.
+}
+
+// Layers returns the layers of a COLR glyph from bottom to top.
+func (t *colorTables) layers(g truetype.Index) []colorLayer {
+	b := t.colr
+	if len(b) < 14 {
+		return nil
+	}
+	base := int(u32(b, 4))
+	nbase := count(b, int(u16(b, 2)), base, 6)
+	layers := int(u32(b, 8))
+	nlayers := count(b, int(u16(b, 12)), layers, 4)
+
+	// Base glyph records are sorted by glyph id.
+	i := sort.Search(nbase, func(i int) bool {
+		return u16(b, base+6*i) >= uint16(g)
+	})
+	if i == nbase || u16(b, base+6*i) != uint16(g) {
+		return nil
+	}
+	first, n := int(u16(b, base+6*i+2)), int(u16(b, base+6*i+4))
+	if first+n > nlayers {
+		return nil
+	}
+	l := make([]colorLayer, n)
+	for k := range l {
+		x := layers + 4*(first+k)
+		l[k].glyph = truetype.Index(u16(b, x))
+		if p := int(u16(b, x+2)); p == 0xFFFF {
+			l[k].foreground = true
+		} else if p < len(t.palette) {
+			l[k].color = t.palette[p]
+		}
+	}
+	return l
+}
+
+// HasBitmap returns if any strike covers the glyph, without decoding it.
+func (t *colorTables) hasBitmap(g truetype.Index) bool {
+	b := t.cblc
+	for i, n := 0, count(b, int(u32(b, 4)), 8, 48); i < n; i++ {
+		x := 8 + 48*i
+		array := int(u32(b, x))
+		for k, m := 0, count(b, int(u32(b, x+8)), array, 8); k < m; k++ {
+			if first, last := u16(b, array+8*k), u16(b, array+8*k+2); uint16(g) >= first && uint16(g) <= last {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Bitmap returns the decoded CBDT bitmap for the glyph from the strike
+// which is the closest to ppem pixels per em, preferring larger strikes.
+// The rectangle is relative to the dot, in pixels of the strike.
+func (t *colorTables) bitmap(g truetype.Index, ppem int) (image.Image, image.Rectangle, int, bool) {
+	b := t.cblc
+	if len(b) < 8 {
+		return nil, image.Rectangle{}, 0, false
+	}
+
+	// Sort the strikes which contain the glyph by preference.
+	type strike struct {
+		x, ppem int
+	}
+	var strikes []strike
+	for i, n := 0, count(b, int(u32(b, 4)), 8, 48); i < n; i++ {
+		x := 8 + 48*i
+		if start, end := u16(b, x+40), u16(b, x+42); uint16(g) >= start && uint16(g) <= end {
+			strikes = append(strikes, strike{x, int(b[x+45])})
+		}
+	}
+	sort.Slice(strikes, func(i, j int) bool {
+		si, sj := strikes[i].ppem, strikes[j].ppem
+		if (si >= ppem) != (sj >= ppem) {
+			return si >= ppem
+		} else if si >= ppem {
+			return si < sj
+		}
+		return si > sj
+	})
+
+	for _, s := range strikes {
+		array := int(u32(b, s.x))
+		for k, n := 0, count(b, int(u32(b, s.x+8)), array, 8); k < n; k++ {
+			x := array + 8*k
+			first, last := u16(b, x), u16(b, x+2)
+			if uint16(g) < first || uint16(g) > last {
+				continue
+			}
+			m, r, ok := t.decodeBitmap(array+int(u32(b, x+4)), uint16(g), int(g)-int(first))
+			if ok {
+				return m, r, s.ppem, true
+			}
+		}
+	}
+	return nil, image.Rectangle{}, 0, false
+}
+
+// DecodeBitmap decodes glyph g of the CBLC index subtable at x.
+// I is the index of g within the range of the subtable.
+func (t *colorTables) decodeBitmap(x int, g uint16, i int) (image.Image, image.Rectangle, bool) {
+	b := t.cblc
+	indexFormat, imageFormat := u16(b, x), u16(b, x+2)
+	data := int(u32(b, x+4))
+
+	var off, size int
+	var metrics []byte // Big glyph metrics from the index subtable.
+	switch indexFormat {
+	case 1:
+		o0, o1 := int(u32(b, x+8+4*i)), int(u32(b, x+12+4*i))
+		off, size = data+o0, o1-o0
+	case 2:
+		size = int(u32(b, x+8))
+		off = data + i*size
+		metrics = sub(b, x+12, 8)
+	case 3:
+		o0, o1 := int(u16(b, x+8+2*i)), int(u16(b, x+10+2*i))
+		off, size = data+o0, o1-o0
+	case 4:
+		// Sparse glyph id and offset pairs.
+		n := count(b, int(u32(b, x+8)), x+12, 4)
+		for k := 0; k < n; k++ {
+			p := x + 12 + 4*k
+			if u16(b, p) == g {
+				o0, o1 := int(u16(b, p+2)), int(u16(b, p+6))
+				off, size = data+o0, o1-o0
+				break
+			}
+		}
+	case 5:
+		// Sparse glyph ids with a constant image size.
+		size = int(u32(b, x+8))
+		metrics = sub(b, x+12, 8)
+		n := count(b, int(u32(b, x+20)), x+24, 2)
+		k := sort.Search(n, func(k int) bool { return u16(b, x+24+2*k) >= g })
+		if k == n || u16(b, x+24+2*k) != g {
+			return nil, image.Rectangle{}, false
+		}
+		off = data + k*size
+	default:
+		return nil, image.Rectangle{}, false
+	}
+	if size <= 0 {
+		return nil, image.Rectangle{}, false
+	}
+	return decodeCBDT(sub(t.cbdt, off, size), imageFormat, metrics)
+}
+
+// Sub returns n bytes of b at offset x, or nil if b is too short.
+func sub(b []byte, x, n int) []byte {
+	if x < 0 || n < 0 || x+n > len(b) {
+		return nil
+	}
+	return b[x : x+n]
+}
+
+// DecodeCBDT decodes glyph bitmap data of the given image format.
+func decodeCBDT(b []byte, format uint16, metrics []byte) (image.Image, image.Rectangle, bool) {
+	var bx, by, w, h int
+	switch format {
+	case 17: // Small metrics and PNG.
+		if len(b) < 9 {
+			return nil, image.Rectangle{}, false
+		}
+		h, w, bx, by = int(b[0]), int(b[1]), int(int8(b[2])), int(int8(b[3]))
+		b = b[9:]
+	case 18: // Big metrics and PNG.
+		if len(b) < 12 {
+			return nil, image.Rectangle{}, false
+		}
+		h, w, bx, by = int(b[0]), int(b[1]), int(int8(b[2])), int(int8(b[3]))
+		b = b[12:]
+	case 19: // PNG, metrics are in the index subtable.
+		if len(b) < 4 || len(metrics) < 8 {
+			return nil, image.Rectangle{}, false
+		}
+		h, w, bx, by = int(metrics[0]), int(metrics[1]), int(int8(metrics[2])), int(int8(metrics[3]))
+		b = b[4:]
+	default:
+		return nil, image.Rectangle{}, false
+	}
+	m, err := png.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, image.Rectangle{}, false
+	}
+	if w == 0 || h == 0 {
+		w, h = m.Bounds().Dx(), m.Bounds().Dy()
+	}
+	return m, image.Rect(bx, -by, bx+w, -by+h), true
+}
+
+// ColorKey identifies a color glyph drawn with a text color.
+type colorKey struct {
+	id FaceID
+	r  rune
+	fg color.RGBA
+}
+
+type colorGlyph struct {
+	dr image.Rectangle // Relative to the integer dot.
+	m  *image.RGBA
+	ok bool
+}
+
+// ColorGlyph returns the color image for r drawn at dot, if the font has one.
+// The text color fg is used for COLR layers that have no palette color.
+func (f *Font) colorGlyph(dot fixed.Point26_6, r rune, fg color.RGBA) (image.Rectangle, image.Image, image.Point, bool) {
+	if f.file == nil || f.file.color == nil {
+		return image.Rectangle{}, nil, image.Point{}, false
+	}
+	ip := image.Point{dot.X.Round(), dot.Y.Round()}
+	key := colorKey{id: f.FaceID, r: r, fg: fg}
+
+	glyphs.Lock()
+	defer glyphs.Unlock()
+	if v, ok := glyphs.get(key); ok {
+		g := v.(*colorGlyph)
+		return g.dr.Add(ip), g.m, g.dr.Min, g.ok
+	}
+
+	var g colorGlyph
+	g.dr, g.m, g.ok = f.renderColorGlyph(r, fg)
+	if glyphs.max > 0 {
+		glyphs.put(key, &g)
+	}
+	return g.dr.Add(ip), g.m, g.dr.Min, g.ok
+}
+
+// HasColorGlyph returns if the font has a color image for r.
+func (f *Font) hasColorGlyph(r rune) bool {
+	if f.file == nil || f.file.color == nil {
+		return false
+	}
+	t := f.file.color
+	g := f.file.ttf.Index(r)
+	if g == 0 {
+		return false
+	}
+	if t.colr != nil && len(t.layers(g)) > 0 {
+		return true
+	}
+	return t.cblc != nil && t.hasBitmap(g)
+}
+
+// BitmapOnly returns if the font has color bitmaps but no outlines,
+// which cannot be drawn by the truetype face.
+func (f *Font) bitmapOnly() bool {
+	return f.file != nil && f.file.color != nil && !f.file.color.outlines
+}
+
+// Ppem returns the font size in pixels per em.
+func (f *Font) ppem() int {
+	return f.scale().Round()
+}
+
+// Scale returns the font size in 26.6 fixed point pixels per em, as used by truetype.
+func (f *Font) scale() fixed.Int26_6 {
+	return fixed.Int26_6(0.5 + float64(f.Size)*float64(f.DPI)*64/72)
+}
+
+func (f *Font) renderColorGlyph(r rune, fg color.RGBA) (image.Rectangle, *image.RGBA, bool) {
+	t := f.file.color
+	g := f.file.ttf.Index(r)
+	if g == 0 {
+		return image.Rectangle{}, nil, false
+	}
+
+	if layers := t.layers(g); len(layers) > 0 {
+		return f.renderLayers(layers, fg)
+	}
+
+	if t.cblc != nil {
+		src, sr, ppem, ok := t.bitmap(g, f.ppem())
+		if !ok || ppem == 0 {
+			return image.Rectangle{}, nil, false
+		}
+		// Scale the bitmap from the strike size to the font size.
+		scale := func(x int) int {
+			return (x*f.ppem() + ppem/2) / ppem
+		}
+		dr := image.Rect(scale(sr.Min.X), scale(sr.Min.Y), scale(sr.Max.X), scale(sr.Max.Y))
+		m := image.NewRGBA(dr)
+		xdraw.ApproxBiLinear.Scale(m, dr, src, src.Bounds(), xdraw.Src, nil)
+		return dr, m, true
+	}
+	return image.Rectangle{}, nil, false
+}
+
+// RenderLayers draws the outlines of COLR layers on top of each other.
+func (f *Font) renderLayers(layers []colorLayer, fg color.RGBA) (image.Rectangle, *image.RGBA, bool) {
+	scale := f.scale()
+	bufs := make([]truetype.GlyphBuf, len(layers))
+	var dr image.Rectangle
+	for i, l := range layers {
+		if err := bufs[i].Load(f.file.ttf, scale, l.glyph, font.HintingNone); err != nil {
+			return image.Rectangle{}, nil, false
+		}
+		b := bufs[i].Bounds
+		dr = dr.Union(image.Rect(b.Min.X.Floor(), -b.Max.Y.Ceil(), b.Max.X.Ceil(), -b.Min.Y.Floor()))
+	}
+	if dr.Empty() {
+		return image.Rectangle{}, nil, false
+	}
+
+	m := image.NewRGBA(dr)
+	var z vector.Rasterizer
+	for i, l := range layers {
+		z.Reset(dr.Dx(), dr.Dy())
+		drawOutline(&z, &bufs[i], dr.Min)
+		c := l.color
+		if l.foreground {
+			c = fg
+		}
+		z.Draw(m, dr, image.NewUniform(c), image.ZP)
+	}
+	return dr, m, true
+}
+
+// RenderIndex draws the outline of the glyph with index g at the sub-pixel
+// position frac, with the coverage mapped like the face does with NoAA or Gamma.
+func (f *Font) renderIndex(g uint16, frac fixed.Point26_6) (image.Rectangle, *image.Alpha, bool) {
+	var buf truetype.GlyphBuf
+	if err := buf.Load(f.file.ttf, f.scale(), truetype.Index(g), f.Hinting); err != nil {
+		return image.Rectangle{}, nil, false
+	}
+	for i := range buf.Points {
+		buf.Points[i].X += frac.X
+		buf.Points[i].Y -= frac.Y
+	}
+	b := buf.Bounds.Add(fixed.Point26_6{X: frac.X, Y: -frac.Y})
+	dr := image.Rect(b.Min.X.Floor(), -b.Max.Y.Ceil(), b.Max.X.Ceil(), -b.Min.Y.Floor())
+	if dr.Empty() {
+		return image.Rectangle{}, nil, false
+	}
+
+	m := image.NewAlpha(dr)
+	var z vector.Rasterizer
+	z.Reset(dr.Dx(), dr.Dy())
+	drawOutline(&z, &buf, dr.Min)
+	z.Draw(m, dr, image.Opaque, image.ZP)
+	face := f.face
+	if p, ok := face.(pixFace); ok {
+		face = p.Face
+	}
+	if mf, ok := face.(*maskFace); ok {
+		for i, a := range m.Pix {
+			m.Pix[i] = mf.alpha[a]
+		}
+	}
+	return dr, m, true
+}
+
+// DrawOutline adds the quadratic contours of a glyph to the rasterizer.
+// The glyph's origin is at -o.
+func drawOutline(z *vector.Rasterizer, g *truetype.GlyphBuf, o image.Point) {
+	pt := func(p truetype.Point) (float32, float32) {
+		return float32(p.X)/64 - float32(o.X), -float32(p.Y)/64 - float32(o.Y)
+	}
+	mid := func(a, b truetype.Point) truetype.Point {
+		return truetype.Point{X: (a.X + b.X) / 2, Y: (a.Y + b.Y) / 2, Flags: 1}
+	}
+	on := func(p truetype.Point) bool {
+		return p.Flags&1 != 0
+	}
+
+	start := 0
+	for _, end := range g.Ends {
+		ps := g.Points[start:end]
+		start = end
+		if len(ps) == 0 {
+			continue
+		}
+
+		// Start at an on-curve point.
+		first := ps[0]
+		if !on(first) {
+			if last := ps[len(ps)-1]; on(last) {
+				first = last
+			} else {
+				first = mid(last, first)
+			}
+		} else {
+			ps = ps[1:]
+		}
+		z.MoveTo(pt(first))
+
+		var q truetype.Point
+		pending := false
+		for _, p := range ps {
+			if on(p) {
+				if pending {
+					qx, qy := pt(q)
+					px, py := pt(p)
+					z.QuadTo(qx, qy, px, py)
+				} else {
+					z.LineTo(pt(p))
+				}
+				pending = false
+				continue
+			}
+			if pending {
+				qx, qy := pt(q)
+				mx, my := pt(mid(q, p))
+				z.QuadTo(qx, qy, mx, my)
+			}
+			q, pending = p, true
+		}
+		if pending {
+			qx, qy := pt(q)
+			fx, fy := pt(first)
+			z.QuadTo(qx, qy, fx, fy)
+		}
+		z.ClosePath()
+	}
+}
+
+// ColorAdvance returns the advance of a color glyph from the hmtx table,
+// as bitmap fonts have no outlines to measure.
+func (f *Font) colorAdvance(r rune) (fixed.Int26_6, bool) {
+	if !f.hasColorGlyph(r) {
+		return 0, false
+	}
+	a := f.file.ttf.HMetric(f.scale(), f.file.ttf.Index(r)).AdvanceWidth
+	if !f.Kern {
+		a = fixed.I(a.Round())
+	}
+	return a, true
+}
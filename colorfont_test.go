@@ -0,0 +1,155 @@
+package duitdraw
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/golang/freetype/truetype"
+)
+
+// Sfnt returns a font file with the given tables and nothing else.
+func sfnt(tables map[string][]byte) []byte {
+	var names []string
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b bytes.Buffer
+	w := func(v ...interface{}) {
+		for _, v := range v {
+			binary.Write(&b, binary.BigEndian, v)
+		}
+	}
+	w(uint32(0x00010000), uint16(len(names)), uint16(0), uint16(0), uint16(0))
+	off := 12 + 16*len(names)
+	for _, name := range names {
+		b.WriteString(name)
+		w(uint32(0), uint32(off), uint32(len(tables[name])))
+		off += len(tables[name])
+	}
+	for _, name := range names {
+		b.Write(tables[name])
+	}
+	return b.Bytes()
+}
+
+func be(v ...interface{}) []byte {
+	var b bytes.Buffer
+	for _, v := range v {
+		binary.Write(&b, binary.BigEndian, v)
+	}
+	return b.Bytes()
+}
+
+func TestColorLayers(t *testing.T) {
+	// Palette with red and half transparent blue (BGRA).
+	cpal := be(uint16(0), uint16(2), uint16(1), uint16(2), uint32(14), uint16(0),
+		[]byte{0, 0, 255, 255}, []byte{255, 0, 0, 128})
+	// Glyph 3 has no layers, glyph 5 has three: 7 red, 8 foreground and 9 blue.
+	colr := be(uint16(0), uint16(2), uint32(14), uint32(26), uint16(4),
+		uint16(2), uint16(0), uint16(1),
+		uint16(5), uint16(1), uint16(3),
+		uint16(6), uint16(0),
+		uint16(7), uint16(0), uint16(8), uint16(0xFFFF), uint16(9), uint16(1))
+	ct := parseColorTables(sfnt(map[string][]byte{"COLR": colr, "CPAL": cpal}))
+	if ct == nil {
+		t.Fatal("no color tables")
+	}
+
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 128, 128}
+	if len(ct.palette) != 2 || ct.palette[0] != red || ct.palette[1] != blue {
+		t.Fatalf("palette: %v", ct.palette)
+	}
+	if l := ct.layers(3); l != nil {
+		t.Fatalf("layers of glyph 3: %v", l)
+	}
+	got := ct.layers(5)
+	exp := []colorLayer{{glyph: 7, color: red}, {glyph: 8, foreground: true}, {glyph: 9, color: blue}}
+	if len(got) != len(exp) {
+		t.Fatalf("layers of glyph 5: %v", got)
+	}
+	for i := range exp {
+		if got[i] != exp[i] {
+			t.Fatalf("layer %d: expected %v got %v", i, exp[i], got[i])
+		}
+	}
+}
+
+func TestColorBitmap(t *testing.T) {
+	var p bytes.Buffer
+	png.Encode(&p, image.NewRGBA(image.Rect(0, 0, 4, 2)))
+
+	// Two strikes for glyph 3 at 10 and 20 ppem, with one glyph each.
+	glyph := append(be(uint8(2), uint8(4), int8(1), int8(2), uint8(5), uint32(p.Len())), p.Bytes()...)
+	cbdt := append(be(uint32(0x00030000)), glyph...)
+	cbdt = append(cbdt, glyph...)
+	strike := func(array uint32, ppem uint8) []byte {
+		return be(array, uint32(24), uint32(1), uint32(0), make([]byte, 24),
+			uint16(3), uint16(3), ppem, ppem, uint8(32), uint8(1))
+	}
+	subtable := func(data int) []byte {
+		return be(uint16(3), uint16(3), uint32(8), // Index subtable array.
+			uint16(1), uint16(17), uint32(data), uint32(0), uint32(len(glyph)))
+	}
+	cblc := be(uint32(0x00030000), uint32(2), strike(104, 10), strike(128, 20))
+	cblc = append(cblc, subtable(4)...)
+	cblc = append(cblc, subtable(4+len(glyph))...)
+
+	ct := parseColorTables(sfnt(map[string][]byte{"CBLC": cblc, "CBDT": cbdt}))
+	if ct == nil {
+		t.Fatal("no color tables")
+	}
+	if !ct.hasBitmap(3) || ct.hasBitmap(4) {
+		t.Fatal("hasBitmap")
+	}
+	for _, tc := range []struct {
+		ppem, strike int
+	}{{5, 10}, {10, 10}, {15, 20}, {30, 20}} {
+		m, r, ppem, ok := ct.bitmap(truetype.Index(3), tc.ppem)
+		if !ok {
+			t.Fatalf("ppem %d: no bitmap", tc.ppem)
+		}
+		if ppem != tc.strike {
+			t.Fatalf("ppem %d: expected strike %d got %d", tc.ppem, tc.strike, ppem)
+		}
+		if exp := image.Rect(1, -2, 5, 0); r != exp || m.Bounds().Size() != exp.Size() {
+			t.Fatalf("ppem %d: expected %v got %v (%v)", tc.ppem, exp, r, m.Bounds())
+		}
+	}
+}
+
+func TestColorTruncated(t *testing.T) {
+	// The counts of strikes, index subtables and sparse glyphs are far too
+	// large for the tables. Without limits, the loops would run for 4G
+	// iterations.
+	strike := be(uint32(56), uint32(8), uint32(0xFFFFFFFF), uint32(0), make([]byte, 24),
+		uint16(0), uint16(0xFFFF), uint8(10), uint8(10), uint8(32), uint8(1))
+	subtable := be(uint16(0), uint16(0xFFFF), uint32(8),
+		uint16(4), uint16(17), uint32(0), uint32(0xFFFFFFFF))
+	cblc := be(uint32(0x00030000), uint32(0xFFFFFFFF), strike, subtable)
+	colr := be(uint16(0), uint16(0xFFFF), uint32(14), uint32(14), uint16(0xFFFF))
+	cpal := be(uint16(0), uint16(1), uint16(1), uint16(1), uint32(14), uint16(0), uint32(0))
+	ct := parseColorTables(sfnt(map[string][]byte{"CBLC": cblc, "CBDT": be(uint32(0x00030000)), "COLR": colr, "CPAL": cpal}))
+	if ct == nil {
+		t.Fatal("no color tables")
+	}
+	done := make(chan bool)
+	go func() {
+		ct.hasBitmap(5)
+		ct.bitmap(5, 10)
+		ct.layers(5)
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("truncated tables are not limited")
+	}
+}
@@ -0,0 +1,316 @@
+package duitdraw
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// ComposeKey is returned by key translation for a key which starts a compose
+// sequence, such as the Compose (Multi_key) key, or Alt in the plan9 keymap.
+// It is never sent to the application.
+const composeKey rune = -2
+
+// DeadKeyOf returns the dead key, e.g. dead_acute, of a key press which shiny
+// reports with rune 0, or "". Shiny does not report dead keys,
+// on X11 they are received by a separate connection.
+var deadKeyOf = pressedDeadKey
+
+// ComposeNode is a node in the tree of compose sequences.
+// Symbols are single characters, or key names such as Multi_key or dead_acute.
+type composeNode struct {
+	next map[string]*composeNode
+	out  string
+}
+
+func (n *composeNode) add(seq []string, out string) {
+	for _, s := range seq {
+		if n.next == nil {
+			n.next = make(map[string]*composeNode)
+		}
+		c := n.next[s]
+		if c == nil {
+			c = &composeNode{}
+			n.next[s] = c
+		}
+		n = c
+	}
+	n.out = out
+}
+
+// ComposeAccents are the accented letters of the builtin table.
+// A sequence is the Plan 9 accent character or the dead key, followed by the
+// letter. A dead key followed by space gives the spacing accent.
+var composeAccents = []struct {
+	plan9   rune
+	dead    string
+	spacing string
+	letters string // Pairs of letter and result.
+}{
+	{'\'', "dead_acute", "´", "aáeéiíoóuúyýAÁEÉIÍOÓUÚYÝcćCĆnńNŃsśSŚzźZŹlĺLĹrŕRŔ"},
+	{'`', "dead_grave", "`", "aàeèiìoòuùAÀEÈIÌOÒUÙ"},
+	{'^', "dead_circumflex", "^", "aâeêiîoôuûAÂEÊIÎOÔUÛ"},
+	{'~', "dead_tilde", "~", "aãnñoõAÃNÑOÕ"},
+	{'"', "dead_diaeresis", "¨", "aäeëiïoöuüyÿAÄEËIÏOÖUÜ"},
+	{',', "dead_cedilla", "¸", "cçCÇsşSŞ"},
+	{'o', "dead_abovering", "°", "aåuůAÅUŮ"},
+	{'v', "dead_caron", "ˇ", "cčCČsšSŠzžZŽeěEĚrřRŘnňNŇ"},
+	{'-', "dead_macron", "¯", "aāeēiīoōuūAĀEĒIĪOŌUŪ"},
+	{'/', "dead_stroke", "/", "oøOØdđDĐlłLŁ"},
+}
+
+// ComposeLatin1 are the builtin sequences from Plan 9's latin1 table,
+// which are not an accented letter.
+var composeLatin1 = map[string]string{
+	"ss": "ß", "ae": "æ", "AE": "Æ", "oe": "œ", "OE": "Œ",
+	"th": "þ", "TH": "Þ", "d-": "ð", "D-": "Ð",
+	"!!": "¡", "??": "¿", "<<": "«", ">>": "»",
+	"co": "©", "rg": "®", "tm": "™", "so": "§", "pg": "¶",
+	"de": "°", "+-": "±", "-:": "÷", "xx": "×", "mu": "µ",
+	"12": "½", "14": "¼", "34": "¾", "s1": "¹", "s2": "²", "s3": "³",
+	"$l": "£", "$y": "¥", "$e": "€", "ct": "¢", "no": "¬", "..": "·",
+}
+
+// ComposeTable returns the tree of compose sequences.
+// It contains the builtin sequences and those of the X Compose file,
+// which is loaded when it is first used.
+var composeTable = func() func() *composeNode {
+	var once sync.Once
+	var root *composeNode
+	return func() *composeNode {
+		once.Do(func() {
+			root = builtinCompose()
+			loadCompose(root, composeFile(), 0)
+		})
+		return root
+	}
+}()
+
+// BuiltinCompose returns the builtin compose sequences.
+// Sequences of the Compose key and Alt in the plan9 keymap start at Multi_key,
+// dead keys at their name.
+func builtinCompose() *composeNode {
+	root := &composeNode{}
+	for _, a := range composeAccents {
+		root.add([]string{a.dead, " "}, a.spacing)
+		for s := a.letters; s != ""; {
+			c, n := utf8.DecodeRuneInString(s)
+			r, m := utf8.DecodeRuneInString(s[n:])
+			s = s[n+m:]
+			root.add([]string{"Multi_key", string(a.plan9), string(c)}, string(r))
+			root.add([]string{a.dead, string(c)}, string(r))
+		}
+	}
+	for seq, out := range composeLatin1 {
+		root.add([]string{"Multi_key", seq[:1], seq[1:]}, out)
+	}
+	return root
+}
+
+// ComposeFile returns the name of the X Compose file of the user,
+// given by XCOMPOSEFILE or ~/.XCompose, or the file of the UTF-8 locale.
+func composeFile() string {
+	if name := os.Getenv("XCOMPOSEFILE"); name != "" {
+		return name
+	}
+	if home := os.Getenv("HOME"); home != "" {
+		name := filepath.Join(home, ".XCompose")
+		if _, err := os.Stat(name); err == nil {
+			return name
+		}
+	}
+	return systemComposeFile
+}
+
+// SystemComposeFile is the compose file of the UTF-8 locale,
+// which is included by %L.
+const systemComposeFile = "/usr/share/X11/locale/en_US.UTF-8/Compose"
+
+func loadCompose(root *composeNode, name string, depth int) {
+	f, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	for _, inc := range parseCompose(root, f) {
+		if depth < 4 {
+			loadCompose(root, inc, depth+1)
+		}
+	}
+}
+
+// ParseCompose adds the sequences of an X Compose file to root.
+// Lines which cannot be represented, e.g. with keypad keys, are ignored.
+// It returns the files which are included.
+func parseCompose(root *composeNode, r io.Reader) (includes []string) {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if strings.HasPrefix(line, "include") {
+			if inc, err := strconv.Unquote(strings.TrimSpace(line[len("include"):])); err == nil {
+				inc = strings.Replace(inc, "%L", systemComposeFile, -1)
+				inc = strings.Replace(inc, "%H", os.Getenv("HOME"), -1)
+				includes = append(includes, inc)
+			}
+			continue
+		}
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			continue
+		}
+		seq, ok := composeSymbols(line[:colon])
+		if !ok {
+			continue
+		}
+		rhs := strings.TrimSpace(line[colon+1:])
+		if len(rhs) < 2 || rhs[0] != '"' {
+			continue
+		}
+		end := 1
+		for end < len(rhs) && rhs[end] != '"' {
+			if rhs[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(rhs) {
+			continue
+		}
+		out, err := strconv.Unquote(rhs[:end+1])
+		if err != nil || out == "" {
+			continue
+		}
+		root.add(seq, out)
+	}
+	return includes
+}
+
+// ComposeSymbols parses the left side of a compose line, e.g. <Multi_key> <a> <e>.
+func composeSymbols(s string) ([]string, bool) {
+	var seq []string
+	for _, f := range strings.Fields(s) {
+		if len(f) < 3 || f[0] != '<' || f[len(f)-1] != '>' {
+			return nil, false
+		}
+		sym, ok := keysymSymbol(f[1 : len(f)-1])
+		if !ok {
+			return nil, false
+		}
+		seq = append(seq, sym)
+	}
+	return seq, len(seq) > 0
+}
+
+// KeysymSymbol returns the compose symbol for an X keysym name.
+func keysymSymbol(name string) (string, bool) {
+	if name == "Multi_key" || strings.HasPrefix(name, "dead_") {
+		return name, true
+	}
+	if utf8.RuneCountInString(name) == 1 {
+		return name, true
+	}
+	if r, ok := keysymNames[name]; ok {
+		return string(r), true
+	}
+	if len(name) > 1 && name[0] == 'U' {
+		if n, err := strconv.ParseUint(name[1:], 16, 32); err == nil {
+			return string(rune(n)), true
+		}
+	}
+	return "", false
+}
+
+// KeysymNames are the names of the ASCII keysyms, which are not a single character.
+var keysymNames = map[string]rune{
+	"space": ' ', "exclam": '!', "quotedbl": '"', "numbersign": '#',
+	"dollar": '$', "percent": '%', "ampersand": '&', "apostrophe": '\'',
+	"parenleft": '(', "parenright": ')', "asterisk": '*', "plus": '+',
+	"comma": ',', "minus": '-', "period": '.', "slash": '/',
+	"colon": ':', "semicolon": ';', "less": '<', "equal": '=',
+	"greater": '>', "question": '?', "at": '@', "bracketleft": '[',
+	"backslash": '\\', "bracketright": ']', "asciicircum": '^', "underscore": '_',
+	"grave": '`', "braceleft": '{', "bar": '|', "braceright": '}',
+	"asciitilde": '~',
+}
+
+// Composer is the state of a compose sequence of a display.
+type composer struct {
+	table *composeNode // Compose sequences, or nil for composeTable.
+	node  *composeNode // Current node, or nil if no sequence is active.
+	typed []rune       // Runes of the sequence.
+	hex   bool         // A Plan 9 X sequence of 4 hex digits.
+}
+
+func (c *composer) root() *composeNode {
+	if c.table != nil {
+		return c.table
+	}
+	return composeTable()
+}
+
+// Start starts a compose sequence at the symbol sym.
+func (c *composer) start(sym string) {
+	c.node = c.root().next[sym]
+	c.typed = c.typed[:0]
+	c.hex = false
+}
+
+// Key feeds the rune of a key press to the compose engine.
+// It returns the runes which are sent to the application.
+// If a sequence does not match, the typed runes are sent.
+func (c *composer) key(r rune) []rune {
+	if r == composeKey {
+		c.start("Multi_key")
+		return nil
+	}
+	if c.node == nil {
+		if r == -1 {
+			return nil
+		}
+		return []rune{r}
+	}
+	if r == -1 {
+		return nil // E.g. Shift is pressed.
+	}
+	c.typed = append(c.typed, r)
+	if c.hex {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return c.abort()
+		}
+		if len(c.typed) < 5 {
+			return nil
+		}
+		n, _ := strconv.ParseUint(string(c.typed[1:]), 16, 32)
+		c.node = nil
+		c.hex = false
+		return []rune{rune(n)}
+	}
+	next := c.node.next[string(r)]
+	if next == nil {
+		if r == 'X' && len(c.typed) == 1 && c.node == c.root().next["Multi_key"] {
+			c.hex = true
+			return nil
+		}
+		return c.abort()
+	}
+	c.node = next
+	if next.next != nil {
+		return nil
+	}
+	c.node = nil
+	return []rune(next.out)
+}
+
+func (c *composer) abort() []rune {
+	c.node = nil
+	c.hex = false
+	return append([]rune(nil), c.typed...)
+}
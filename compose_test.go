@@ -0,0 +1,110 @@
+package duitdraw
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/mobile/event/key"
+)
+
+func TestComposer(t *testing.T) {
+	tt := []struct {
+		start string // Dead key.
+		in    []rune
+		exp   string
+	}{
+		{"", []rune{composeKey, '\'', 'e'}, "é"},
+		{"", []rune{composeKey, -1, '"', -1, 'O'}, "Ö"},
+		{"", []rune{composeKey, 's', 's'}, "ß"},
+		{"", []rune{composeKey, '<', '<'}, "«"},
+		{"", []rune{composeKey, 'X', '0', '0', 'e', '9'}, "é"},
+		{"", []rune{composeKey, 'X', '2', 'g'}, "X2g"},
+		{"", []rune{composeKey, '\'', 'q'}, "'q"},
+		{"", []rune{composeKey, KeyEscape}, "\x1b"},
+		{"", []rune{'a', -1, 'b'}, "ab"},
+		{"dead_acute", []rune{'a'}, "á"},
+		{"dead_caron", []rune{'s'}, "š"},
+		{"dead_diaeresis", []rune{' '}, "¨"},
+		{"dead_acute", []rune{'q'}, "q"},
+		{"dead_unknown", []rune{'a'}, "a"},
+	}
+	for _, tc := range tt {
+		c := composer{table: builtinCompose()}
+		if tc.start != "" {
+			c.start(tc.start)
+		}
+		var out []rune
+		for _, r := range tc.in {
+			out = append(out, c.key(r)...)
+		}
+		if string(out) != tc.exp || c.node != nil {
+			t.Errorf("%s %q: expected %q got %q", tc.start, tc.in, tc.exp, string(out))
+		}
+	}
+}
+
+func TestParseCompose(t *testing.T) {
+	root := &composeNode{}
+	inc := parseCompose(root, strings.NewReader(`# comment
+include "%L"
+<Multi_key> <apostrophe> <e>	: "é"   eacute
+<dead_grave> <a>		: "à"
+<Multi_key> <less> <3>		: "♥"  U2665
+<Multi_key> <U2665> <U2665>	: "\"love\""
+<Multi_key> <KP_Add> <1>	: "x"
+<Multi_key> <minus> <minus>	: "\342\200\224"
+`))
+	if len(inc) != 1 || inc[0] != systemComposeFile {
+		t.Errorf("includes: %v", inc)
+	}
+	c := composer{table: root}
+	tt := []struct {
+		start string
+		in    string
+		exp   string
+	}{
+		{"Multi_key", "'e", "é"},
+		{"dead_grave", "a", "à"},
+		{"Multi_key", "<3", "♥"},
+		{"Multi_key", "♥♥", `"love"`},
+		{"Multi_key", "--", "—"},
+	}
+	for _, tc := range tt {
+		c.start(tc.start)
+		var out []rune
+		for _, r := range tc.in {
+			out = append(out, c.key(r)...)
+		}
+		if string(out) != tc.exp {
+			t.Errorf("%s %q: expected %q got %q", tc.start, tc.in, tc.exp, string(out))
+		}
+	}
+	if root.next["Multi_key"].next["KP_Add"] != nil || len(root.next["Multi_key"].next) != 4 {
+		t.Errorf("unexpected sequences: %v", root.next["Multi_key"].next)
+	}
+}
+
+func TestComposeEvents(t *testing.T) {
+	defer func(f func(*Display) string) { deadKeyOf = f }(deadKeyOf)
+	deadKeyOf = func(*Display) string { return "dead_circumflex" }
+	d, w, done := startEventLoop(t)
+	defer done()
+	d.compose.table = builtinCompose()
+
+	press := func(r rune, c key.Code) {
+		w.Send(key.Event{Rune: r, Code: c, Direction: key.DirPress})
+	}
+	press(-1, key.CodeCompose)
+	press('\'', key.CodeApostrophe)
+	press('e', key.CodeE)
+	if r := <-d.keyboard.C; r != 'é' {
+		t.Errorf("compose: expected é got %q", r)
+	}
+
+	// A dead key is reported by shiny as rune 0.
+	press(0, key.CodeUnknown)
+	press('o', key.CodeO)
+	if r := <-d.keyboard.C; r != 'ô' {
+		t.Errorf("dead key: expected ô got %q", r)
+	}
+}
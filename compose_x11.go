@@ -0,0 +1,207 @@
+// +build dragonfly freebsd linux netbsd openbsd solaris
+
+package duitdraw
+
+import (
+	"time"
+
+	"github.com/BurntSushi/xgb/xproto"
+)
+
+// DeadKeysyms are the names of the X dead keysyms, starting at 0xfe50.
+var deadKeysyms = []string{
+	"dead_grave", "dead_acute", "dead_circumflex", "dead_tilde",
+	"dead_macron", "dead_breve", "dead_abovedot", "dead_diaeresis",
+	"dead_abovering", "dead_doubleacute", "dead_caron", "dead_cedilla",
+	"dead_ogonek", "dead_iota", "dead_voiced_sound", "dead_semivoiced_sound",
+	"dead_belowdot", "dead_hook", "dead_horn", "dead_stroke",
+}
+
+// DeadKeyTimeout is the time the event loop waits for the X connection,
+// to tell if a key press is a dead key.
+const deadKeyTimeout = 100 * time.Millisecond
+
+// DeadPress is a dead key press, which is not yet read by the event loop.
+type deadPress struct {
+	sym  string
+	time xproto.Timestamp
+}
+
+// DeadKey records a key press, if it is a dead key.
+// Shiny delivers the same key press with a zero rune, and the event loop
+// reads it with pressedDeadKey.
+func (d *x11Display) deadKey(e xproto.KeyPressEvent) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.windows[e.Event] == nil {
+		return
+	}
+	sym := d.keysym(e.Detail, e.State)
+	if i := int(sym) - 0xfe50; i >= 0 && i < len(deadKeysyms) {
+		p := append(d.deadKeys[e.Event], deadPress{deadKeysyms[i], e.Time})
+		if len(p) > 8 {
+			p = p[1:] // The event loop does not ask for them.
+		}
+		d.deadKeys[e.Event] = p
+	}
+}
+
+// PressedDeadKey returns the dead key of the last key press of the window,
+// which shiny reports with a zero rune, or "" if it is not a dead key.
+//
+// Key presses are received on a separate connection, which is not ordered
+// with the events of shiny. The event loop syncs with the X event stream
+// by changing a property of the window: when its PropertyNotify arrives,
+// all earlier key presses are recorded. Dead keys with a later time
+// stamp belong to a key press, which shiny has not yet delivered.
+func pressedDeadKey(dpy *Display) string {
+	xw := x11Window(dpy.window)
+	if xw == 0 {
+		return ""
+	}
+	d, err := getX11Display()
+	if err != nil {
+		return ""
+	}
+	c := make(chan xproto.Timestamp, 1)
+	d.mu.Lock()
+	if d.syncAtom == 0 {
+		name := "_DUITDRAW_SYNC"
+		if r, err := xproto.InternAtom(d.conn, false, uint16(len(name)), name).Reply(); err == nil {
+			d.syncAtom = r.Atom
+		}
+	}
+	if d.syncAtom == 0 {
+		d.mu.Unlock()
+		return ""
+	}
+	d.syncs[xw] = append(d.syncs[xw], c)
+	d.mu.Unlock()
+	xproto.ChangeProperty(d.conn, xproto.PropModeAppend, xw, d.syncAtom, xproto.AtomString, 8, 0, nil)
+
+	var t xproto.Timestamp
+	select {
+	case t = <-c:
+	case <-time.After(deadKeyTimeout):
+		return ""
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	p := d.deadKeys[xw]
+	if len(p) == 0 || timeAfter(p[0].time, t) {
+		return ""
+	}
+	d.deadKeys[xw] = p[1:]
+	return p[0].sym
+}
+
+// Synced is called for a PropertyNotify of window xw.
+// It wakes the event loop, if the sync property was changed.
+func (d *x11Display) synced(xw xproto.Window, atom xproto.Atom, t xproto.Timestamp) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if atom != d.syncAtom || atom == 0 {
+		return
+	}
+	for _, c := range d.syncs[xw] {
+		c <- t
+	}
+	delete(d.syncs, xw)
+}
+
+// TimeAfter reports if the X time stamp a is later than b.
+// X time wraps around after about 49 days.
+func timeAfter(a, b xproto.Timestamp) bool {
+	return int32(a-b) > 0
+}
+
+// Keysym returns the keysym of a key code for the modifier state.
+// The keyboard and modifier mappings are requested once and reset by MappingNotify.
+// It must be called with d.mu held.
+func (d *x11Display) keysym(code xproto.Keycode, state uint16) xproto.Keysym {
+	setup := xproto.Setup(d.conn)
+	if d.keysyms == nil {
+		m, err := xproto.GetKeyboardMapping(d.conn, setup.MinKeycode,
+			byte(setup.MaxKeycode-setup.MinKeycode+1)).Reply()
+		if err != nil {
+			return 0
+		}
+		d.keysyms = m
+		d.modeSwitch, d.level3 = d.modifierMasks()
+	}
+	n := int(d.keysyms.KeysymsPerKeycode)
+	i := int(code-setup.MinKeycode) * n
+	if i < 0 || i+n > len(d.keysyms.Keysyms) {
+		return 0
+	}
+	group := int(state>>13) & 3 // XKB group of the core state.
+	if group == 0 && state&d.modeSwitch != 0 {
+		group = 1
+	}
+	return keysymColumn(d.keysyms.Keysyms[i:i+n], group,
+		state&d.level3 != 0, state&xproto.ModMaskShift != 0)
+}
+
+// ModifierMasks returns the modifier masks of the Mode_switch and ISO_Level3_Shift keys.
+// It must be called with d.mu held and the keyboard mapping present.
+func (d *x11Display) modifierMasks() (modeSwitch, level3 uint16) {
+	const (
+		xkModeSwitch     = 0xff7e
+		xkISOLevel3Shift = 0xfe03
+	)
+	m, err := xproto.GetModifierMapping(d.conn).Reply()
+	if err != nil {
+		return 0, 0
+	}
+	setup := xproto.Setup(d.conn)
+	n := int(d.keysyms.KeysymsPerKeycode)
+	per := int(m.KeycodesPerModifier)
+	for i, code := range m.Keycodes {
+		j := int(code-setup.MinKeycode) * n
+		if code == 0 || j < 0 || j+n > len(d.keysyms.Keysyms) {
+			continue
+		}
+		for _, sym := range d.keysyms.Keysyms[j : j+n] {
+			switch sym {
+			case xkModeSwitch:
+				modeSwitch |= 1 << uint(i/per)
+			case xkISOLevel3Shift:
+				level3 |= 1 << uint(i/per)
+			}
+		}
+	}
+	return modeSwitch, level3
+}
+
+// KeysymColumn selects the keysym of a key from its row of the core keyboard mapping.
+// The columns are: group 1 levels 1 and 2, group 2 levels 1 and 2,
+// and for XKB keyboards group 1 levels 3 and 4, group 2 levels 3 and 4.
+// Empty columns fall back to level 1 and to group 1.
+func keysymColumn(syms []xproto.Keysym, group int, level3, shift bool) xproto.Keysym {
+	at := func(i int) xproto.Keysym {
+		if i < len(syms) {
+			return syms[i]
+		}
+		return 0
+	}
+	level := func(i int) xproto.Keysym {
+		if shift {
+			if sym := at(i + 1); sym != 0 {
+				return sym
+			}
+		}
+		return at(i)
+	}
+	if group > 1 {
+		group = 0
+	}
+	if level3 {
+		if sym := level(4 + 2*group); sym != 0 {
+			return sym
+		}
+	}
+	if sym := level(2 * group); sym != 0 {
+		return sym
+	}
+	return level(0)
+}
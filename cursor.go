@@ -7,15 +7,45 @@ import (
 	"errors"
 	"fmt"
 	"image"
+
+	"golang.org/x/exp/shiny/screen"
 )
 
-func moveTo(p image.Point) error {
+func moveTo(w screen.Window, p image.Point) error {
 	return fmt.Errorf("moveTo: TODO for this os")
 }
 
-func setCursor(c *Cursor) error {
+func windowOrigin(w screen.Window) (image.Point, bool) {
+	return image.Point{}, false
+}
+
+func setCursor(w screen.Window, c *cursorBitmap) error {
 	if c != nil {
 		return errors.New("duitdraw: SetCursor is not implemented")
 	}
 	return nil
 }
+
+func setCursorImage(w screen.Window, m *image.RGBA, hot image.Point) error {
+	if m != nil {
+		return errors.New("duitdraw: SetCursorImage is not implemented")
+	}
+	return nil
+}
+
+func setSystemCursor(w screen.Window, c SystemCursor) error {
+	if c != CursorDefault {
+		return errors.New("duitdraw: SetSystemCursor is not implemented")
+	}
+	return nil
+}
+
+func hideCursor(w screen.Window, hide bool) error {
+	return errors.New("duitdraw: HideCursor is not implemented")
+}
+
+func grabPointer(w screen.Window, r image.Rectangle) error {
+	return errors.New("duitdraw: GrabPointer is not implemented")
+}
+
+func ungrabPointer(w screen.Window) {}
@@ -0,0 +1,55 @@
+package duitdraw
+
+import (
+	"image"
+	"testing"
+)
+
+func TestScaleCursor(t *testing.T) {
+	var c Cursor
+	c.Point = image.Point{-3, -5}
+	c.Set[0] = 0x80 // Pixel 0,0.
+	c.Clr[3] = 0x01 // Pixel 15,1.
+	c2 := ScaleCursor(c)
+	if c2.Point != (image.Point{-6, -10}) {
+		t.Errorf("expected hot spot offset (-6,-10) got %v", c2.Point)
+	}
+	set, clr := make(map[image.Point]bool), make(map[image.Point]bool)
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			bit := uint8(0x80) >> uint(x%8)
+			if c2.Set[4*y+x/8]&bit != 0 {
+				set[image.Point{x, y}] = true
+			}
+			if c2.Clr[4*y+x/8]&bit != 0 {
+				clr[image.Point{x, y}] = true
+			}
+		}
+	}
+	for _, p := range []image.Point{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+		if !set[p] {
+			t.Errorf("expected set pixel at %v", p)
+		}
+		if q := p.Add(image.Point{30, 2}); !clr[q] {
+			t.Errorf("expected clr pixel at %v", q)
+		}
+	}
+	if len(set) != 4 || len(clr) != 4 {
+		t.Errorf("expected 4 set and clr pixels got %d and %d", len(set), len(clr))
+	}
+}
+
+func TestSetCursorImageHotSpot(t *testing.T) {
+	var d Display
+	m := image.NewRGBA(image.Rect(10, 10, 26, 26))
+	if err := d.SetCursorImage(m, image.Point{16, 0}); err == nil {
+		t.Error("expected error for a hot spot outside of the image")
+	}
+}
+
+func TestSetSystemCursorUnknown(t *testing.T) {
+	var d Display
+	if err := d.SetSystemCursor(CursorNotAllowed + 1); err == nil {
+		t.Error("expected error for an unknown cursor")
+	}
+}
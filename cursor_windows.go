@@ -4,50 +4,84 @@ import (
 	"errors"
 	"fmt"
 	"image"
-	"os"
+	"reflect"
+	"syscall"
+	"unsafe"
 
 	"github.com/as/cursor"
-	"github.com/as/ms/win"
+	"golang.org/x/exp/shiny/screen"
 )
 
-// This sets the mouse cursor relative to the current window.
-//
-// TODO: There seems to be an offset, maybe it's related to the window borders.
-// You can calculate your offset by pressing the tab key and clicking with the mouse.
-// Log coordinates of MouseMove and mouse.Event (in display.go) and substract the results.
-//
-// Source: github.com/as/a/mouse_windows.go
-
-var (
-	winfd        win.Window
-	winfderr     error
-	cursorOffset = image.Point{4, 4}
-)
+var clientToScreen = syscall.NewLazyDLL("user32.dll").NewProc("ClientToScreen")
 
-func tryWindow() {
-	if winfd != 0 && winfderr == nil {
-		return
+// MoveTo sets the mouse cursor relative to the client area of the window.
+func moveTo(w screen.Window, pt image.Point) error {
+	o, ok := windowOrigin(w)
+	if !ok {
+		return errors.New("duitdraw: unknown window position")
+	}
+	if cursor.MoveTo(pt.Add(o)) == false {
+		return fmt.Errorf("move cursor failed")
 	}
-	winfd, winfderr = win.Open(os.Getpid())
+	return nil
 }
 
-func moveTo(pt image.Point) error {
-	tryWindow()
-	abs, err := winfd.Client()
-	if err != nil {
-		winfderr = err
-		return err
+// WindowOrigin returns the position of the client area of the window on the screen.
+func windowOrigin(w screen.Window) (image.Point, bool) {
+	hwnd := windowHandle(w)
+	if hwnd == 0 {
+		return image.Point{}, false
 	}
-	pt = pt.Add(abs.Min).Sub(cursorOffset)
-	if cursor.MoveTo(pt) == false {
-		return fmt.Errorf("move cursor failed")
+	var p struct{ X, Y int32 }
+	if r, _, _ := clientToScreen.Call(uintptr(hwnd), uintptr(unsafe.Pointer(&p))); r == 0 {
+		return image.Point{}, false
 	}
-	return nil
+	return image.Pt(int(p.X), int(p.Y)), true
 }
 
-func setCursor(c *Cursor) error {
+// WindowHandle returns the HWND of a shiny window.
+// The windriver does not export it, so it is read with reflection.
+func windowHandle(w screen.Window) syscall.Handle {
+	v := reflect.ValueOf(w)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return 0
+	}
+	if f := v.FieldByName("hwnd"); f.IsValid() && f.Kind() == reflect.Uintptr {
+		return syscall.Handle(f.Uint())
+	}
+	return 0
+}
+
+func setCursor(w screen.Window, c *cursorBitmap) error {
 	if c != nil {
 		return errors.New("duitdraw: SetCursor is not implemented")
 	}
 	return nil
 }
+
+func setCursorImage(w screen.Window, m *image.RGBA, hot image.Point) error {
+	if m != nil {
+		return errors.New("duitdraw: SetCursorImage is not implemented")
+	}
+	return nil
+}
+
+func setSystemCursor(w screen.Window, c SystemCursor) error {
+	if c != CursorDefault {
+		return errors.New("duitdraw: SetSystemCursor is not implemented")
+	}
+	return nil
+}
+
+func hideCursor(w screen.Window, hide bool) error {
+	return errors.New("duitdraw: HideCursor is not implemented")
+}
+
+func grabPointer(w screen.Window, r image.Rectangle) error {
+	return errors.New("duitdraw: GrabPointer is not implemented")
+}
+
+func ungrabPointer(w screen.Window) {}
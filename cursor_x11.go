@@ -3,96 +3,122 @@
 package duitdraw
 
 import (
+	"errors"
 	"fmt"
 	"image"
 
 	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/render"
 	"github.com/BurntSushi/xgb/xproto"
+	"golang.org/x/exp/shiny/screen"
 )
 
-var xdpy *x11Display
-
-func moveTo(pt image.Point) error {
-	d, err := getX11Display()
+// MoveTo warps the pointer relative to the origin of the window,
+// which the X server translates to screen coordinates.
+func moveTo(w screen.Window, pt image.Point) error {
+	d, xw, err := x11DisplayWindow(w)
 	if err != nil {
 		return err
 	}
 	return xproto.WarpPointerChecked(d.conn,
 		xproto.WindowNone, // src
-		d.focus,           // dst
+		xw,                // dst
 		0, 0, 0, 0,        // src X, Y, width, height
 		int16(pt.X), int16(pt.Y), // dst X, Y
 	).Check()
 }
 
-func setCursor(c *Cursor) error {
-	d, err := getX11Display()
+func setCursor(w screen.Window, c *cursorBitmap) error {
+	d, xw, err := x11DisplayWindow(w)
 	if err != nil {
 		return err
 	}
 	if c != nil {
-		return d.setCursor(c)
+		return d.setCursor(xw, c)
 	}
-	return d.unsetCursor()
+	return d.unsetCursor(xw)
 }
 
-type x11Display struct {
-	conn   *xgb.Conn
-	focus  xproto.Window
-	cursor xproto.Cursor // previously set cursor
+func setCursorImage(w screen.Window, m *image.RGBA, hot image.Point) error {
+	d, xw, err := x11DisplayWindow(w)
+	if err != nil {
+		return err
+	}
+	if m != nil {
+		return d.setCursorImage(xw, m, hot)
+	}
+	return d.unsetCursor(xw)
 }
 
-func getX11Display() (*x11Display, error) {
-	if xdpy == nil {
-		conn, err := xgb.NewConn()
-		if err != nil {
-			return nil, err
-		}
-		xdpy = &x11Display{
-			conn:   conn,
-			cursor: xproto.CursorNone,
-		}
+func setSystemCursor(w screen.Window, c SystemCursor) error {
+	d, xw, err := x11DisplayWindow(w)
+	if err != nil {
+		return err
+	}
+	if c != CursorDefault {
+		return d.setGlyphCursor(xw, cursorGlyphs[c])
 	}
-	// TODO(fhs): This is wrong if the window is not in focus.
-	gif, err := xproto.GetInputFocus(xdpy.conn).Reply()
+	return d.unsetCursor(xw)
+}
+
+// CursorGlyphs are the glyphs of the system cursors in the X cursor font.
+// The mask of a glyph is the next glyph.
+var cursorGlyphs = map[SystemCursor]uint16{
+	CursorText:       152, // xterm
+	CursorHand:       60,  // hand2
+	CursorWait:       150, // watch
+	CursorResizeNS:   116, // sb_v_double_arrow
+	CursorResizeEW:   108, // sb_h_double_arrow
+	CursorResizeNWSE: 14,  // bottom_right_corner
+	CursorCrosshair:  34,  // crosshair
+	CursorNotAllowed: 24,  // circle
+}
+
+// X11DisplayWindow returns the X connection and the window id of w.
+func x11DisplayWindow(w screen.Window) (*x11Display, xproto.Window, error) {
+	d, err := getX11Display()
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+	xw := x11Window(w)
+	if xw == 0 {
+		return nil, 0, errors.New("duitdraw: unknown X window")
 	}
-	xdpy.focus = gif.Focus
-	return xdpy, nil
+	return d, xw, nil
 }
 
-func (d *x11Display) freeCursor() {
-	if d.cursor != xproto.CursorNone {
-		xproto.FreeCursor(d.conn, d.cursor)
-		d.cursor = xproto.CursorNone
+// FreeCursor frees the cursor which was set on window xw.
+func (d *x11Display) freeCursor(xw xproto.Window) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if c, ok := d.cursors[xw]; ok {
+		xproto.FreeCursor(d.conn, c)
+		delete(d.cursors, xw)
 	}
 }
 
-func (d *x11Display) unsetCursor() error {
-	err := xproto.ChangeWindowAttributesChecked(d.conn, d.focus,
+func (d *x11Display) unsetCursor(xw xproto.Window) error {
+	err := xproto.ChangeWindowAttributesChecked(d.conn, xw,
 		xproto.CwCursor, []uint32{xproto.CursorNone}).Check()
 	if err != nil {
 		return fmt.Errorf("ChangeWindowAttributesChecked: %v", err)
 	}
-	d.freeCursor()
+	d.freeCursor(xw)
 	return nil
 }
 
-func (d *x11Display) setCursor(c *Cursor) error {
-	var src, mask [2 * 16]byte
-
-	for i := 0; i < 2*16; i++ {
-		src[i] = reverseByte(c.Set[i])
-		mask[i] = reverseByte(c.Set[i] | c.Clr[i])
+func (d *x11Display) setCursor(xw xproto.Window, c *cursorBitmap) error {
+	mask := make([]byte, len(c.set))
+	for i := range mask {
+		mask[i] = c.set[i] | c.clr[i]
 	}
-
-	xsrc, err := createPixmapFromData(d.conn, xproto.Drawable(d.focus), src[:], 16, 16)
+	size := uint16(c.size)
+	xsrc, err := createPixmapFromData(d.conn, xproto.Drawable(xw), c.set, size, size)
 	if err != nil {
 		return fmt.Errorf("createPixmapFromData xsrc: %v", err)
 	}
 	defer xproto.FreePixmap(d.conn, xsrc)
-	xmask, err := createPixmapFromData(d.conn, xproto.Drawable(d.focus), mask[:], 16, 16)
+	xmask, err := createPixmapFromData(d.conn, xproto.Drawable(xw), mask, size, size)
 	if err != nil {
 		return fmt.Errorf("createPixmapFromData xmask: %v", err)
 	}
@@ -104,21 +130,167 @@ func (d *x11Display) setCursor(c *Cursor) error {
 	err = xproto.CreateCursorChecked(d.conn, xc, xsrc, xmask,
 		0, 0, 0, // foreRed, foreGreen, foreblue
 		0xffff, 0xffff, 0xffff, // backRed, backGreen, backBlue
-		uint16(-c.Point.X), uint16(-c.Point.Y),
+		uint16(c.hot.X), uint16(c.hot.Y),
 	).Check()
 	if err != nil {
 		return fmt.Errorf("CreateCursorChecked: %v", err)
 	}
-	err = xproto.ChangeWindowAttributesChecked(d.conn, d.focus,
+	return d.defineCursor(xw, xc)
+}
+
+// DefineCursor sets the cursor xc on window xw, which then owns it.
+func (d *x11Display) defineCursor(xw xproto.Window, xc xproto.Cursor) error {
+	err := xproto.ChangeWindowAttributesChecked(d.conn, xw,
 		xproto.CwCursor, []uint32{uint32(xc)}).Check()
 	if err != nil {
+		xproto.FreeCursor(d.conn, xc)
 		return fmt.Errorf("ChangeWindowAttributesChecked: %v", err)
 	}
-	d.freeCursor()
-	d.cursor = xc
+	d.freeCursor(xw)
+	d.mu.Lock()
+	d.cursors[xw] = xc
+	d.mu.Unlock()
 	return nil
 }
 
+// SetGlyphCursor sets a cursor from the X cursor font, which is opened once.
+func (d *x11Display) setGlyphCursor(xw xproto.Window, glyph uint16) error {
+	d.mu.Lock()
+	font := d.cursorFont
+	if font == 0 {
+		id, err := xproto.NewFontId(d.conn)
+		if err == nil {
+			const name = "cursor"
+			err = xproto.OpenFontChecked(d.conn, id, uint16(len(name)), name).Check()
+		}
+		if err != nil {
+			d.mu.Unlock()
+			return fmt.Errorf("OpenFont cursor: %v", err)
+		}
+		font, d.cursorFont = id, id
+	}
+	d.mu.Unlock()
+	xc, err := xproto.NewCursorId(d.conn)
+	if err != nil {
+		return fmt.Errorf("NewCursorId: %v", err)
+	}
+	err = xproto.CreateGlyphCursorChecked(d.conn, xc, font, font, glyph, glyph+1,
+		0, 0, 0, // foreRed, foreGreen, foreblue
+		0xffff, 0xffff, 0xffff, // backRed, backGreen, backBlue
+	).Check()
+	if err != nil {
+		return fmt.Errorf("CreateGlyphCursorChecked: %v", err)
+	}
+	return d.defineCursor(xw, xc)
+}
+
+// SetCursorImage sets an ARGB cursor, which is created with the RENDER extension.
+func (d *x11Display) setCursorImage(xw xproto.Window, m *image.RGBA, hot image.Point) error {
+	if d.argb == 0 {
+		return errors.New("duitdraw: image cursors need the X RENDER extension")
+	}
+	size := m.Rect.Size()
+	pm, err := xproto.NewPixmapId(d.conn)
+	if err != nil {
+		return fmt.Errorf("NewPixmapId: %v", err)
+	}
+	err = xproto.CreatePixmapChecked(d.conn, 32, pm, xproto.Drawable(xw), uint16(size.X), uint16(size.Y)).Check()
+	if err != nil {
+		return fmt.Errorf("CreatePixmapChecked: %v", err)
+	}
+	defer xproto.FreePixmap(d.conn, pm)
+	gc, err := xproto.NewGcontextId(d.conn)
+	if err != nil {
+		return fmt.Errorf("NewGcontextId: %v", err)
+	}
+	err = xproto.CreateGCChecked(d.conn, gc, xproto.Drawable(pm), 0, nil).Check()
+	if err != nil {
+		return fmt.Errorf("CreateGCChecked: %v", err)
+	}
+	defer xproto.FreeGC(d.conn, gc)
+
+	// Rows are sent in chunks, to stay below the maximum request length.
+	data := argbData(m, xproto.Setup(d.conn).ImageByteOrder == xproto.ImageOrderLSBFirst)
+	stride := 4 * size.X
+	rows := 1 + 0xffff/stride
+	for y := 0; y < size.Y; y += rows {
+		n := rows
+		if y+n > size.Y {
+			n = size.Y - y
+		}
+		err = xproto.PutImageChecked(d.conn, xproto.ImageFormatZPixmap, xproto.Drawable(pm), gc,
+			uint16(size.X), uint16(n),
+			0, int16(y), // DstX, DstY
+			0, 32, // LeftPad, Depth
+			data[y*stride:(y+n)*stride],
+		).Check()
+		if err != nil {
+			return fmt.Errorf("PutImageChecked: %v", err)
+		}
+	}
+
+	pic, err := render.NewPictureId(d.conn)
+	if err != nil {
+		return fmt.Errorf("NewPictureId: %v", err)
+	}
+	err = render.CreatePictureChecked(d.conn, pic, xproto.Drawable(pm), d.argb, 0, nil).Check()
+	if err != nil {
+		return fmt.Errorf("CreatePictureChecked: %v", err)
+	}
+	defer render.FreePicture(d.conn, pic)
+	xc, err := xproto.NewCursorId(d.conn)
+	if err != nil {
+		return fmt.Errorf("NewCursorId: %v", err)
+	}
+	err = render.CreateCursorChecked(d.conn, xc, pic, uint16(hot.X), uint16(hot.Y)).Check()
+	if err != nil {
+		return fmt.Errorf("CreateCursorChecked: %v", err)
+	}
+	return d.defineCursor(xw, xc)
+}
+
+// ArgbFormat returns the 32 bit ARGB picture format of the RENDER extension,
+// or 0 if it is not available.
+func argbFormat(conn *xgb.Conn) render.Pictformat {
+	if render.Init(conn) != nil {
+		return 0
+	}
+	r, err := render.QueryPictFormats(conn).Reply()
+	if err != nil {
+		return 0
+	}
+	for _, f := range r.Formats {
+		x := f.Direct
+		if f.Type == render.PictTypeDirect && f.Depth == 32 &&
+			x.AlphaShift == 24 && x.AlphaMask == 0xff &&
+			x.RedShift == 16 && x.RedMask == 0xff &&
+			x.GreenShift == 8 && x.GreenMask == 0xff &&
+			x.BlueShift == 0 && x.BlueMask == 0xff {
+			return f.Id
+		}
+	}
+	return 0
+}
+
+// ArgbData returns the pixels of m as 32 bit ARGB values,
+// in the byte order of the X server.
+// Both image.RGBA and RENDER cursors use premultiplied alpha.
+func argbData(m *image.RGBA, lsbFirst bool) []byte {
+	size := m.Rect.Size()
+	data := make([]byte, 0, 4*size.X*size.Y)
+	for y := m.Rect.Min.Y; y < m.Rect.Max.Y; y++ {
+		for x := m.Rect.Min.X; x < m.Rect.Max.X; x++ {
+			c := m.RGBAAt(x, y)
+			if lsbFirst {
+				data = append(data, c.B, c.G, c.R, c.A)
+			} else {
+				data = append(data, c.A, c.R, c.G, c.B)
+			}
+		}
+	}
+	return data
+}
+
 func createPixmapFromData(conn *xgb.Conn, drawable xproto.Drawable, data []byte, width, height uint16) (xproto.Pixmap, error) {
 	pm, err := xproto.NewPixmapId(conn)
 	if err != nil {
@@ -138,18 +310,15 @@ func createPixmapFromData(conn *xgb.Conn, drawable xproto.Drawable, data []byte,
 	if err != nil {
 		return 0, fmt.Errorf("CreateGCChecked: %v", err)
 	}
-	// TODO(fhs): Just guessing the pixmap binary layout,
-	// but this seems to make the Edwood boxcursor work.
-	data2 := make([]byte, 0, len(data)*2)
-	for i := 0; i < len(data); i += 2 {
-		data2 = append(data2, data[i:i+2]...)
-		data2 = append(data2, data[i:i+2]...)
-	}
+	defer xproto.FreeGC(conn, gc)
+	setup := xproto.Setup(conn)
+	data = bitmapData(data, int(width), int(setup.BitmapFormatScanlinePad),
+		setup.BitmapFormatBitOrder == xproto.ImageOrderLSBFirst)
 	err = xproto.PutImageChecked(conn, xproto.ImageFormatXYPixmap, xproto.Drawable(pm), gc,
 		width, height,
 		0, 0, // DstX, DstY
 		0, 1, // LeftPad, Depth
-		data2,
+		data,
 	).Check()
 	if err != nil {
 		return 0, fmt.Errorf("PutImageChecked: %v", err)
@@ -157,6 +326,31 @@ func createPixmapFromData(conn *xgb.Conn, drawable xproto.Drawable, data []byte,
 	return pm, nil
 }
 
+// BitmapData converts the rows of a Plan 9 bitmap with the given width
+// to the layout of the X server: each row is padded to a multiple of
+// pad bits, and the bits are reversed if the server stores the
+// leftmost pixel in the least significant bit.
+func bitmapData(data []byte, width, pad int, lsbFirst bool) []byte {
+	row := (width + 7) / 8
+	stride := row
+	if pad >= 8 {
+		stride = (width + pad - 1) / pad * pad / 8
+	}
+	out := make([]byte, 0, len(data)/row*stride)
+	for i := 0; i+row <= len(data); i += row {
+		for _, b := range data[i : i+row] {
+			if lsbFirst {
+				b = reverseByte(b)
+			}
+			out = append(out, b)
+		}
+		for j := row; j < stride; j++ {
+			out = append(out, 0)
+		}
+	}
+	return out
+}
+
 func reverseByte(b byte) byte {
 	var r byte
 
@@ -0,0 +1,587 @@
+package duitdraw
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// This is a minimal D-Bus client, which is used to talk to input methods.
+// Values are represented by Go types depending on the signature:
+//	y byte, b bool, n int16, q uint16, i int32, u uint32, x int64, t uint64,
+//	d float64, s o g string, v dbusVariant,
+//	arrays, structs and dict entries []interface{}.
+
+// DbusVariant is a D-Bus variant value with its signature.
+type dbusVariant struct {
+	sig   string
+	value interface{}
+}
+
+const (
+	dbusMethodCall   = 1
+	dbusMethodReturn = 2
+	dbusError        = 3
+	dbusSignal       = 4
+
+	dbusNoReplyExpected = 1
+)
+
+// DbusMessage is a D-Bus message with the header fields that are used.
+type dbusMessage struct {
+	typ         byte
+	flags       byte
+	serial      uint32
+	path        string
+	iface       string
+	member      string
+	errName     string
+	replySerial uint32
+	dest        string
+	sender      string
+	sig         string
+	body        []interface{}
+}
+
+// DbusNextType splits the first complete type from a signature.
+func dbusNextType(sig string) (string, string, error) {
+	if sig == "" {
+		return "", "", errors.New("dbus: empty signature")
+	}
+	switch sig[0] {
+	case 'a':
+		t, rest, err := dbusNextType(sig[1:])
+		return "a" + t, rest, err
+	case '(', '{':
+		end := byte(')')
+		if sig[0] == '{' {
+			end = '}'
+		}
+		for rest := sig[1:]; rest != ""; {
+			if rest[0] == end {
+				n := len(sig) - len(rest) + 1
+				return sig[:n], sig[n:], nil
+			}
+			var err error
+			if _, rest, err = dbusNextType(rest); err != nil {
+				return "", "", err
+			}
+		}
+		return "", "", fmt.Errorf("dbus: unterminated signature %q", sig)
+	}
+	if !strings.ContainsRune("ybnqiuxtdsogv", rune(sig[0])) {
+		return "", "", fmt.Errorf("dbus: unsupported type %q", sig[0])
+	}
+	return sig[:1], sig[1:], nil
+}
+
+func dbusAlignment(t byte) int {
+	switch t {
+	case 'n', 'q':
+		return 2
+	case 'b', 'i', 'u', 's', 'o', 'a':
+		return 4
+	case 'x', 't', 'd', '(', '{':
+		return 8
+	}
+	return 1
+}
+
+// DbusEncoder writes values in little endian byte order.
+// Offsets are relative to the start of the message.
+type dbusEncoder struct {
+	b []byte
+}
+
+func (e *dbusEncoder) align(n int) {
+	for len(e.b)%n != 0 {
+		e.b = append(e.b, 0)
+	}
+}
+
+func (e *dbusEncoder) uint32(v uint32) {
+	e.align(4)
+	e.b = append(e.b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+// Encode writes the values for the signature sig.
+func (e *dbusEncoder) encode(sig string, values ...interface{}) error {
+	for _, v := range values {
+		t, rest, err := dbusNextType(sig)
+		if err != nil {
+			return err
+		}
+		if err := e.value(t, v); err != nil {
+			return err
+		}
+		sig = rest
+	}
+	if sig != "" {
+		return fmt.Errorf("dbus: missing values for %q", sig)
+	}
+	return nil
+}
+
+func (e *dbusEncoder) value(t string, v interface{}) (err error) {
+	defer func() {
+		// A value with the wrong type panics in the type assertion.
+		if r := recover(); r != nil {
+			err = fmt.Errorf("dbus: cannot encode %T as %s", v, t)
+		}
+	}()
+	e.align(dbusAlignment(t[0]))
+	switch t[0] {
+	case 'y':
+		e.b = append(e.b, v.(byte))
+	case 'b':
+		var u uint32
+		if v.(bool) {
+			u = 1
+		}
+		e.uint32(u)
+	case 'n':
+		e.b = append(e.b, byte(v.(int16)), byte(v.(int16)>>8))
+	case 'q':
+		e.b = append(e.b, byte(v.(uint16)), byte(v.(uint16)>>8))
+	case 'i':
+		e.uint32(uint32(v.(int32)))
+	case 'u':
+		e.uint32(v.(uint32))
+	case 'x', 't', 'd':
+		var b [8]byte
+		switch v := v.(type) {
+		case int64:
+			binary.LittleEndian.PutUint64(b[:], uint64(v))
+		case uint64:
+			binary.LittleEndian.PutUint64(b[:], v)
+		case float64:
+			binary.LittleEndian.PutUint64(b[:], math.Float64bits(v))
+		default:
+			panic(v)
+		}
+		e.b = append(e.b, b[:]...)
+	case 's', 'o':
+		s := v.(string)
+		e.uint32(uint32(len(s)))
+		e.b = append(append(e.b, s...), 0)
+	case 'g':
+		s := v.(string)
+		e.b = append(append(append(e.b, byte(len(s))), s...), 0)
+	case 'v':
+		vv := v.(dbusVariant)
+		e.b = append(append(append(e.b, byte(len(vv.sig))), vv.sig...), 0)
+		return e.value(vv.sig, vv.value)
+	case 'a':
+		e.uint32(0)
+		n := len(e.b)
+		e.align(dbusAlignment(t[1]))
+		start := len(e.b)
+		for _, x := range v.([]interface{}) {
+			if err := e.value(t[1:], x); err != nil {
+				return err
+			}
+		}
+		binary.LittleEndian.PutUint32(e.b[n-4:], uint32(len(e.b)-start))
+	case '(', '{':
+		return e.encode(t[1:len(t)-1], v.([]interface{})...)
+	}
+	return nil
+}
+
+// DbusDecoder reads values from a message.
+type dbusDecoder struct {
+	b     []byte
+	off   int
+	order binary.ByteOrder
+}
+
+var errDBusShort = errors.New("dbus: message too short")
+
+func (d *dbusDecoder) align(n int) error {
+	for d.off%n != 0 {
+		d.off++
+	}
+	if d.off > len(d.b) {
+		return errDBusShort
+	}
+	return nil
+}
+
+func (d *dbusDecoder) next(n int) ([]byte, error) {
+	if d.off+n > len(d.b) {
+		return nil, errDBusShort
+	}
+	p := d.b[d.off : d.off+n]
+	d.off += n
+	return p, nil
+}
+
+// Decode reads the values for the signature sig.
+func (d *dbusDecoder) decode(sig string) ([]interface{}, error) {
+	var values []interface{}
+	for sig != "" {
+		t, rest, err := dbusNextType(sig)
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.value(t)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+		sig = rest
+	}
+	return values, nil
+}
+
+func (d *dbusDecoder) value(t string) (interface{}, error) {
+	if err := d.align(dbusAlignment(t[0])); err != nil {
+		return nil, err
+	}
+	if t[0] == '(' || t[0] == '{' {
+		v, err := d.decode(t[1 : len(t)-1])
+		if v == nil {
+			v = []interface{}{}
+		}
+		return v, err
+	}
+	// Basic values, and the lengths of strings and arrays, are as long as their alignment.
+	p, err := d.next(dbusAlignment(t[0]))
+	if err != nil {
+		return nil, err
+	}
+	switch t[0] {
+	case 'y':
+		return p[0], nil
+	case 'b':
+		return d.order.Uint32(p) != 0, nil
+	case 'n':
+		return int16(d.order.Uint16(p)), nil
+	case 'q':
+		return d.order.Uint16(p), nil
+	case 'i':
+		return int32(d.order.Uint32(p)), nil
+	case 'u':
+		return d.order.Uint32(p), nil
+	case 'x':
+		return int64(d.order.Uint64(p)), nil
+	case 't':
+		return d.order.Uint64(p), nil
+	case 'd':
+		return math.Float64frombits(d.order.Uint64(p)), nil
+	case 's', 'o', 'g', 'v':
+		n := int(p[0])
+		if len(p) == 4 {
+			n = int(d.order.Uint32(p))
+		}
+		s, err := d.next(n + 1)
+		if err != nil {
+			return nil, err
+		}
+		if t[0] != 'v' {
+			return string(s[:n]), nil
+		}
+		sig := string(s[:n])
+		if _, rest, err := dbusNextType(sig); err != nil || rest != "" {
+			return nil, fmt.Errorf("dbus: bad variant signature %q", sig)
+		}
+		v, err := d.value(sig)
+		return dbusVariant{sig, v}, err
+	case 'a':
+		n := int(d.order.Uint32(p))
+		if err := d.align(dbusAlignment(t[1])); err != nil {
+			return nil, err
+		}
+		end := d.off + n
+		if end > len(d.b) {
+			return nil, errDBusShort
+		}
+		a := []interface{}{}
+		for d.off < end {
+			v, err := d.value(t[1:])
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+		return a, nil
+	}
+	return nil, fmt.Errorf("dbus: unsupported type %q", t)
+}
+
+// Marshal encodes the message in little endian byte order.
+func (m *dbusMessage) marshal() ([]byte, error) {
+	var fields []interface{}
+	field := func(code byte, sig, s string) {
+		if s != "" {
+			fields = append(fields, []interface{}{code, dbusVariant{sig, s}})
+		}
+	}
+	field(1, "o", m.path)
+	field(2, "s", m.iface)
+	field(3, "s", m.member)
+	field(4, "s", m.errName)
+	if m.replySerial != 0 {
+		fields = append(fields, []interface{}{byte(5), dbusVariant{"u", m.replySerial}})
+	}
+	field(6, "s", m.dest)
+	field(7, "s", m.sender)
+	field(8, "g", m.sig)
+
+	var body dbusEncoder
+	if err := body.encode(m.sig, m.body...); err != nil {
+		return nil, err
+	}
+	e := dbusEncoder{b: []byte{'l', m.typ, m.flags, 1}}
+	e.uint32(uint32(len(body.b)))
+	e.uint32(m.serial)
+	if err := e.value("a(yv)", fields); err != nil {
+		return nil, err
+	}
+	e.align(8)
+	return append(e.b, body.b...), nil
+}
+
+// ReadDBusMessage reads a message in either byte order.
+func readDBusMessage(r io.Reader) (*dbusMessage, error) {
+	h := make([]byte, 16)
+	if _, err := io.ReadFull(r, h); err != nil {
+		return nil, err
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if h[0] == 'B' {
+		order = binary.BigEndian
+	} else if h[0] != 'l' {
+		return nil, fmt.Errorf("dbus: bad byte order %q", h[0])
+	}
+	bodyLen := int(order.Uint32(h[4:]))
+	fieldsLen := int(order.Uint32(h[12:]))
+	if bodyLen > 1<<26 || fieldsLen > 1<<26 {
+		return nil, errors.New("dbus: message too long")
+	}
+	headerLen := (16 + fieldsLen + 7) &^ 7
+	b := make([]byte, headerLen+bodyLen)
+	copy(b, h)
+	if _, err := io.ReadFull(r, b[16:]); err != nil {
+		return nil, err
+	}
+	m := &dbusMessage{typ: h[1], flags: h[2], serial: order.Uint32(h[8:])}
+	d := dbusDecoder{b: b[:16+fieldsLen], off: 12, order: order}
+	fields, err := d.value("a(yv)")
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range fields.([]interface{}) {
+		f := f.([]interface{})
+		v := f[1].(dbusVariant).value
+		switch s, _ := v.(string); f[0].(byte) {
+		case 1:
+			m.path = s
+		case 2:
+			m.iface = s
+		case 3:
+			m.member = s
+		case 4:
+			m.errName = s
+		case 5:
+			m.replySerial, _ = v.(uint32)
+		case 6:
+			m.dest = s
+		case 7:
+			m.sender = s
+		case 8:
+			m.sig = s
+		}
+	}
+	d = dbusDecoder{b: b[headerLen:], order: order}
+	if m.body, err = d.decode(m.sig); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// DbusConn is a connection to a message bus.
+type dbusConn struct {
+	conn   net.Conn
+	signal func(*dbusMessage) // Called for signals from the read loop.
+
+	mu     sync.Mutex // Protects serial, calls and writes.
+	serial uint32
+	calls  map[uint32]chan *dbusMessage
+	err    error // Read error, after which the connection is closed.
+}
+
+// DbusTimeout is the time to wait for the reply of a method call.
+const dbusTimeout = 2 * time.Second
+
+// DialDBus connects to a bus address such as unix:path=/run/bus or unix:abstract=/tmp/bus.
+// The address may contain alternatives separated by semicolons.
+func dialDBus(addr string) (net.Conn, error) {
+	var err error
+	for _, a := range strings.Split(addr, ";") {
+		if !strings.HasPrefix(a, "unix:") {
+			continue
+		}
+		for _, kv := range strings.Split(a[len("unix:"):], ",") {
+			var c net.Conn
+			if strings.HasPrefix(kv, "path=") {
+				c, err = net.Dial("unix", kv[len("path="):])
+			} else if strings.HasPrefix(kv, "abstract=") {
+				c, err = net.Dial("unix", "@"+kv[len("abstract="):])
+			} else {
+				continue
+			}
+			if err == nil {
+				return c, nil
+			}
+		}
+	}
+	if err == nil {
+		err = fmt.Errorf("dbus: unsupported address %q", addr)
+	}
+	return nil, err
+}
+
+// NewDBusConn authenticates on c and registers with the bus.
+func newDBusConn(c net.Conn, signal func(*dbusMessage)) (*dbusConn, error) {
+	uid := hex.EncodeToString([]byte(strconv.Itoa(os.Getuid())))
+	c.SetDeadline(time.Now().Add(dbusTimeout))
+	r := bufio.NewReader(c)
+	if _, err := io.WriteString(c, "\x00AUTH EXTERNAL "+uid+"\r\n"); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if line, err := r.ReadString('\n'); err != nil || !strings.HasPrefix(line, "OK ") {
+		c.Close()
+		if err == nil {
+			err = fmt.Errorf("dbus: authentication failed: %s", strings.TrimSpace(line))
+		}
+		return nil, err
+	}
+	if _, err := io.WriteString(c, "BEGIN\r\n"); err != nil {
+		c.Close()
+		return nil, err
+	}
+	c.SetDeadline(time.Time{})
+
+	d := &dbusConn{conn: c, signal: signal, calls: make(map[uint32]chan *dbusMessage)}
+	go d.readLoop(r)
+	if _, err := d.call("org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "Hello", ""); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *dbusConn) readLoop(r io.Reader) {
+	for {
+		m, err := readDBusMessage(r)
+		if err != nil {
+			d.mu.Lock()
+			d.err = err
+			for serial, ch := range d.calls {
+				close(ch)
+				delete(d.calls, serial)
+			}
+			d.mu.Unlock()
+			d.conn.Close()
+			return
+		}
+		switch m.typ {
+		case dbusMethodReturn, dbusError:
+			d.mu.Lock()
+			ch := d.calls[m.replySerial]
+			delete(d.calls, m.replySerial)
+			d.mu.Unlock()
+			if ch != nil {
+				ch <- m
+			}
+		case dbusSignal:
+			if d.signal != nil {
+				d.signal(m)
+			}
+		}
+	}
+}
+
+// Send sends a message and returns a channel for the reply,
+// or nil if no reply is expected.
+func (d *dbusConn) send(m *dbusMessage) (chan *dbusMessage, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return nil, d.err
+	}
+	d.serial++
+	m.serial = d.serial
+	b, err := m.marshal()
+	if err != nil {
+		return nil, err
+	}
+	var ch chan *dbusMessage
+	if m.flags&dbusNoReplyExpected == 0 {
+		ch = make(chan *dbusMessage, 1)
+		d.calls[m.serial] = ch
+	}
+	if _, err := d.conn.Write(b); err != nil {
+		delete(d.calls, m.serial)
+		return nil, err
+	}
+	return ch, nil
+}
+
+// Call calls a method and waits for the reply.
+func (d *dbusConn) call(dest, path, iface, member, sig string, args ...interface{}) ([]interface{}, error) {
+	return d.callTimeout(dbusTimeout, dest, path, iface, member, sig, args...)
+}
+
+// CallTimeout calls a method and waits for the reply at most for the timeout.
+// A reply which arrives later is dropped.
+func (d *dbusConn) callTimeout(timeout time.Duration, dest, path, iface, member, sig string, args ...interface{}) ([]interface{}, error) {
+	m := &dbusMessage{typ: dbusMethodCall, dest: dest, path: path, iface: iface, member: member, sig: sig, body: args}
+	ch, err := d.send(m)
+	if err != nil {
+		return nil, err
+	}
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case r, ok := <-ch:
+		if !ok {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if r.typ == dbusError {
+			msg := ""
+			if len(r.body) > 0 {
+				msg, _ = r.body[0].(string)
+			}
+			return nil, fmt.Errorf("dbus: %s: %s", r.errName, msg)
+		}
+		return r.body, nil
+	case <-t.C:
+		d.mu.Lock()
+		delete(d.calls, m.serial)
+		d.mu.Unlock()
+		return nil, fmt.Errorf("dbus: %s: timeout", member)
+	}
+}
+
+// CallNoReply calls a method without waiting for a reply.
+func (d *dbusConn) callNoReply(dest, path, iface, member, sig string, args ...interface{}) error {
+	_, err := d.send(&dbusMessage{typ: dbusMethodCall, flags: dbusNoReplyExpected, dest: dest, path: path, iface: iface, member: member, sig: sig, body: args})
+	return err
+}
+
+func (d *dbusConn) close() error {
+	return d.conn.Close()
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"image"
 	"image/draw"
+	"time"
 
 	"golang.org/x/exp/shiny/screen"
 	"golang.org/x/mobile/event/lifecycle"
@@ -17,9 +18,13 @@ const (
 	Refmesg   = 2
 )
 
-// DefaultDPI is the initial DPI setting for a new display.
-// TODO: should we get DPI settings from the screen?
-// Currently there is no interface in shiny.
+// DefaultDPI is the DPI of a display, if it cannot be queried from the system.
+//
+// On X11, the DPI of a window is the Xft.dpi resource or the physical
+// resolution of the monitor the window is on. The environment variables
+// GDK_SCALE or QT_SCALE_FACTOR override it with a multiple of DefaultDPI.
+// When the DPI changes, Display.DPI and DefaultFont are updated and a value is
+// sent on Mousectl.Resize. Other fonts can be kept up to date with ScaleFont.
 const DefaultDPI = 100
 
 const DefaultFontSize = 10
@@ -35,10 +40,21 @@ type Display struct {
 	Opaque        *Image // Pre-allocated color.
 	Transparent   *Image // Pre-allocated color.
 	KeyTranslator KeyTranslator
+	ControlKeys   map[rune]rune                 // Control characters for Ctrl combinations, a copy of DefaultControlKeys.
+	ModifierKeys  bool                          // Send KeyAlt, KeyShift, KeyCtl and KeyCmd when a modifier key is pressed.
+	Preedit       func(text string, cursor int) // Called with the text of an input method, see SetCaret.
+	KeyOverflow   KeyOverflow                   // What happens if Keyboardctl.C is full, see KeyboardBuffer.
 	mouse         Mousectl
 	keyboard      Keyboardctl
+	compose       composer
+	ime           inputMethod // Nil, if no input method is running.
+	cursorHidden  bool        // HideCursor was called, guarded by ScreenImage.
+	winEvents     chan WindowEvent
+	winEventsOn   int32
 	window        screen.Window
 	buffer        screen.Buffer
+	fontWatches   []*fontWatch
+	start         time.Time // Creation time, for event time stamps.
 }
 
 // AllocImage allocates a new Image on display d. The arguments are:
@@ -101,13 +117,12 @@ func (d *Display) InitMouse() *Mousectl {
 	return &d.mouse
 }
 
-// Moveto moves the mouse cursor to the specified location.
+// Moveto moves the mouse cursor to the specified location,
+// relative to the client area of the window.
 func (d *Display) MoveTo(pt image.Point) error {
-	// Uncomment for cursor calibration:
-	// fmt.Printf("shiny: MoveTo %v\n", pt)
 	d.ScreenImage.Lock()
 	defer d.ScreenImage.Unlock()
-	return moveTo(pt)
+	return moveTo(d.window, pt)
 }
 
 // SetDebug enables debugging for the remote devdraw server.
@@ -129,6 +144,24 @@ func (d *Display) WriteSnarf(data []byte) error {
 	return d.writeSnarf(data)
 }
 
+// ReadClipboard reads the clipboard in the format of a MIME type,
+// e.g. "text/plain", "text/html", "image/png" or "text/uri-list".
+// On X11 any type which the owner of the clipboard offers can be read,
+// on other systems only text/plain.
+// This method is not present in 9fans draw package.
+func (d *Display) ReadClipboard(mime string) ([]byte, error) {
+	return d.readClipboard(mime)
+}
+
+// WriteClipboard writes the data to the clipboard in several formats,
+// keyed by MIME type, e.g. to copy a table as text/plain and text/html.
+// Text/plain is also the snarf buffer.
+// On systems other than X11, only text/plain is written.
+// This method is not present in 9fans draw package.
+func (d *Display) WriteClipboard(data map[string][]byte) error {
+	return d.writeClipboard(data)
+}
+
 func (d *Display) ScaleSize(n int) int {
 	if d == nil || d.DPI <= DefaultDPI {
 		return n
@@ -143,10 +176,166 @@ type Cursor struct {
 	Set [2 * 16]uint8
 }
 
+// Cursor2 describes a single cursor at twice the resolution of Cursor,
+// for high DPI displays.
+type Cursor2 struct {
+	image.Point
+	Clr [4 * 32]uint8
+	Set [4 * 32]uint8
+}
+
+// ScaleCursor returns a Cursor2 with the pixels of c doubled.
+func ScaleCursor(c Cursor) Cursor2 {
+	var c2 Cursor2
+	c2.Point = c.Point.Mul(2)
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 2; x++ {
+			clr, set := double(c.Clr[2*y+x]), double(c.Set[2*y+x])
+			for _, i := range []int{8*y + 2*x, 8*y + 4 + 2*x} {
+				c2.Clr[i], c2.Clr[i+1] = uint8(clr>>8), uint8(clr)
+				c2.Set[i], c2.Set[i+1] = uint8(set>>8), uint8(set)
+			}
+		}
+	}
+	return c2
+}
+
+// Double returns the bits of b, each repeated twice.
+func double(b uint8) uint16 {
+	var r uint16
+	for i := uint(0); i < 8; i++ {
+		if b&(1<<i) != 0 {
+			r |= 3 << (2 * i)
+		}
+	}
+	return r
+}
+
+// CursorBitmap is a cursor of size x size pixels, with one bit per pixel.
+// Rows are stored from the most significant bit, as in Cursor.
+type cursorBitmap struct {
+	size     int
+	hot      image.Point
+	set, clr []uint8
+}
+
 // SetCursor sets the mouse cursor to the specified cursor image.
 // SetCursor(nil) changes the cursor to the standard system cursor.
+// On a high DPI display, the cursor is scaled by 2.
 func (d *Display) SetCursor(c *Cursor) error {
+	return d.SetCursor2(c, nil)
+}
+
+// SetCursor2 sets the mouse cursor to c, or to c2 on a high DPI display,
+// where the DPI is at least 1.5 times DefaultDPI.
+// If c2 is nil, c is scaled by 2 with ScaleCursor.
+// SetCursor2(nil, nil) changes the cursor to the standard system cursor.
+func (d *Display) SetCursor2(c *Cursor, c2 *Cursor2) error {
+	var b *cursorBitmap
+	if c != nil && c2 == nil && d.DPI >= DefaultDPI*3/2 {
+		s := ScaleCursor(*c)
+		c2 = &s
+	}
+	if c2 != nil && (c == nil || d.DPI >= DefaultDPI*3/2) {
+		b = &cursorBitmap{size: 32, hot: c2.Point.Mul(-1), set: c2.Set[:], clr: c2.Clr[:]}
+	} else if c != nil {
+		b = &cursorBitmap{size: 16, hot: c.Point.Mul(-1), set: c.Set[:], clr: c.Clr[:]}
+	}
+	d.ScreenImage.Lock()
+	defer d.ScreenImage.Unlock()
+	return setCursor(d.window, b)
+}
+
+// SetCursorImage sets the mouse cursor to an image with alpha channel.
+// The hot spot is given relative to m.Bounds().Min.
+// The image is not scaled, a program should use a larger image on a high DPI display.
+// SetCursorImage(nil, image.ZP) changes the cursor to the standard system cursor.
+// Image cursors are only supported on X11 with the RENDER extension.
+// This method is not present in 9fans draw package.
+func (d *Display) SetCursorImage(m image.Image, hot image.Point) error {
+	var rgba *image.RGBA
+	if m != nil {
+		r := m.Bounds()
+		if !hot.In(r.Sub(r.Min)) {
+			return fmt.Errorf("SetCursorImage: hot spot %v is outside of the image", hot)
+		}
+		rgba = image.NewRGBA(image.Rectangle{Max: r.Size()})
+		draw.Draw(rgba, rgba.Rect, m, r.Min, draw.Src)
+	}
+	d.ScreenImage.Lock()
+	defer d.ScreenImage.Unlock()
+	return setCursorImage(d.window, rgba, hot)
+}
+
+// SystemCursor is a standard cursor of the system.
+// This type is not present in 9fans draw package.
+type SystemCursor int
+
+// System cursors, which can be set with SetSystemCursor.
+const (
+	CursorDefault    SystemCursor = iota // The standard cursor, as SetCursor(nil).
+	CursorText                           // I-beam for text.
+	CursorHand                           // Pointing hand for links.
+	CursorWait                           // Busy.
+	CursorResizeNS                       // Resize vertically.
+	CursorResizeEW                       // Resize horizontally.
+	CursorResizeNWSE                     // Resize at the bottom right corner.
+	CursorCrosshair                      // Precise selection.
+	CursorNotAllowed                     // Action is not possible.
+)
+
+// SetSystemCursor sets the mouse cursor to a standard cursor of the system.
+// On X11, the cursors are taken from the cursor font.
+// This method is not present in 9fans draw package.
+func (d *Display) SetSystemCursor(c SystemCursor) error {
+	if c < CursorDefault || c > CursorNotAllowed {
+		return fmt.Errorf("SetSystemCursor: unknown cursor %d", c)
+	}
+	d.ScreenImage.Lock()
+	defer d.ScreenImage.Unlock()
+	return setSystemCursor(d.window, c)
+}
+
+// HideCursor hides the mouse cursor, e.g. while the user is typing,
+// until ShowCursor is called.
+// XFixes hides the cursor on the whole screen, not only over the window,
+// so it is shown while the window does not have the focus and hidden
+// again when the window gets it back.
+// It is only supported on X11 with the XFixes extension.
+// This method is not present in 9fans draw package.
+func (d *Display) HideCursor() error {
+	d.ScreenImage.Lock()
+	defer d.ScreenImage.Unlock()
+	d.cursorHidden = true
+	return hideCursor(d.window, true)
+}
+
+// ShowCursor shows the mouse cursor after HideCursor.
+// This method is not present in 9fans draw package.
+func (d *Display) ShowCursor() error {
+	d.ScreenImage.Lock()
+	defer d.ScreenImage.Unlock()
+	d.cursorHidden = false
+	return hideCursor(d.window, false)
+}
+
+// GrabPointer confines the mouse pointer to the rectangle r of the window,
+// e.g. while dragging a scroll bar. If the pointer is outside of r, it is moved inside.
+// Mouse events are delivered as usual.
+// The pointer is released by UngrabPointer, when the window loses the focus,
+// or when it is closed.
+// It is only supported on X11 with the XFixes extension.
+// This method is not present in 9fans draw package.
+func (d *Display) GrabPointer(r image.Rectangle) error {
+	d.ScreenImage.Lock()
+	defer d.ScreenImage.Unlock()
+	return grabPointer(d.window, r)
+}
+
+// UngrabPointer releases the pointer after GrabPointer.
+// This method is not present in 9fans draw package.
+func (d *Display) UngrabPointer() {
 	d.ScreenImage.Lock()
 	defer d.ScreenImage.Unlock()
-	return setCursor(c)
+	ungrabPointer(d.window)
 }
@@ -0,0 +1,104 @@
+package duitdraw
+
+import (
+	"os"
+	"strconv"
+
+	"golang.org/x/exp/shiny/screen"
+)
+
+// DpiEvent is sent to the event loop of a window when its DPI may have
+// changed, e.g. after it moved to another monitor.
+type dpiEvent struct {
+	dpi int
+}
+
+// EnvDPI returns the DPI given by the scale factor in the environment variables
+// GDK_SCALE or QT_SCALE_FACTOR, relative to DefaultDPI.
+func envDPI() (int, bool) {
+	for _, name := range []string{"GDK_SCALE", "QT_SCALE_FACTOR"} {
+		if s, err := strconv.ParseFloat(os.Getenv(name), 64); err == nil && s > 0 {
+			return int(s*DefaultDPI + 0.5), true
+		}
+	}
+	return 0, false
+}
+
+// WindowDPI returns the DPI for a window.
+// The environment overrides the system settings.
+func windowDPI(w screen.Window) int {
+	if dpi, ok := envDPI(); ok {
+		return dpi
+	}
+	if dpi, ok := systemDPI(w); ok {
+		return dpi
+	}
+	return DefaultDPI
+}
+
+// SetDPI changes the DPI of the display and signals a resize,
+// so the application can update its layout.
+// It is called from the event loop, which must not block if the
+// application is not reading Resize. A resize which is already
+// pending also tells about the DPI change.
+func (d *Display) setDPI(dpi int) {
+	if d.rescale(dpi) {
+		select {
+		case d.mouse.Resize <- true:
+		default:
+		}
+	}
+}
+
+// Rescale changes the DPI of the display and updates its fonts.
+// It returns false, if the DPI did not change.
+func (d *Display) rescale(dpi int) bool {
+	if dpi <= 0 || dpi == d.DPI {
+		return false
+	}
+	d.ScreenImage.Lock()
+	d.DPI = dpi
+	if d.DefaultFont != nil {
+		d.DefaultFont = d.DefaultFont.SetDPI(dpi)
+	}
+	watches := make([]*fontWatch, len(d.fontWatches))
+	copy(watches, d.fontWatches)
+	for _, w := range watches {
+		w.font = w.font.SetDPI(dpi)
+	}
+	d.ScreenImage.Unlock()
+
+	for _, w := range watches {
+		w.fn(w.font)
+	}
+	return true
+}
+
+type fontWatch struct {
+	font *Font
+	fn   func(*Font)
+}
+
+// ScaleFont calls fn with the font scaled to the DPI of the display,
+// and again from the window's event loop each time the DPI changes,
+// before the change is signalled on Mousectl.Resize.
+// Calling the returned function stops the updates.
+// The DefaultFont of the display is always rescaled.
+func (d *Display) ScaleFont(f *Font, fn func(*Font)) (stop func()) {
+	w := &fontWatch{font: f.SetDPI(d.DPI), fn: fn}
+	d.ScreenImage.Lock()
+	d.fontWatches = append(d.fontWatches, w)
+	d.ScreenImage.Unlock()
+	fn(w.font)
+
+	return func() {
+		d.ScreenImage.Lock()
+		defer d.ScreenImage.Unlock()
+		for i, v := range d.fontWatches {
+			if v == w {
+				d.fontWatches = append(d.fontWatches[:i], d.fontWatches[i+1:]...)
+				break
+			}
+		}
+	}
+}
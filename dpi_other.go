@@ -0,0 +1,10 @@
+// +build !dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package duitdraw
+
+import "golang.org/x/exp/shiny/screen"
+
+// SystemDPI is not implemented on this platform.
+func systemDPI(w screen.Window) (int, bool) {
+	return 0, false
+}
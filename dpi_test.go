@@ -0,0 +1,85 @@
+package duitdraw
+
+import (
+	"os"
+	"testing"
+)
+
+func TestEnvDPI(t *testing.T) {
+	defer os.Setenv("GDK_SCALE", os.Getenv("GDK_SCALE"))
+	defer os.Setenv("QT_SCALE_FACTOR", os.Getenv("QT_SCALE_FACTOR"))
+	tt := []struct {
+		gdk, qt string
+		dpi     int
+		ok      bool
+	}{
+		{"", "", 0, false},
+		{"2", "", 200, true},
+		{"", "1.5", 150, true},
+		{"2", "1.5", 200, true},
+		{"x", "1.25", 125, true},
+		{"0", "", 0, false},
+	}
+	for _, tc := range tt {
+		os.Setenv("GDK_SCALE", tc.gdk)
+		os.Setenv("QT_SCALE_FACTOR", tc.qt)
+		if dpi, ok := envDPI(); dpi != tc.dpi || ok != tc.ok {
+			t.Errorf("GDK_SCALE=%q QT_SCALE_FACTOR=%q: expected %d %v got %d %v", tc.gdk, tc.qt, tc.dpi, tc.ok, dpi, ok)
+		}
+	}
+}
+
+func TestSetDPI(t *testing.T) {
+	d := Display{DPI: DefaultDPI, ScreenImage: &Image{}}
+	d.mouse.Resize = make(chan bool, 2)
+	d.setDPI(DefaultDPI)
+	d.setDPI(0)
+	if len(d.mouse.Resize) != 0 {
+		t.Fatal("resize without DPI change")
+	}
+	d.setDPI(192)
+	if d.DPI != 192 || len(d.mouse.Resize) != 1 {
+		t.Fatalf("expected DPI 192 and a resize, got %d, %d", d.DPI, len(d.mouse.Resize))
+	}
+	if got := d.ScaleSize(10); got != 19 {
+		t.Fatalf("ScaleSize: expected 19 got %d", got)
+	}
+
+	// A full Resize channel does not block the event loop.
+	d.mouse.Resize <- true
+	d.setDPI(DefaultDPI)
+	if d.DPI != DefaultDPI || len(d.mouse.Resize) != 2 {
+		t.Fatalf("expected DPI %d and two resizes, got %d, %d", DefaultDPI, d.DPI, len(d.mouse.Resize))
+	}
+}
+
+func TestScaleFont(t *testing.T) {
+	d := Display{DPI: DefaultDPI, ScreenImage: &Image{}, DefaultFont: defaultFont}
+	d.mouse.Resize = make(chan bool, 2)
+	f, err := d.OpenFont("@12pt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []*Font
+	stop := d.ScaleFont(f, func(f *Font) { got = append(got, f) })
+	if len(got) != 1 || got[0] != f {
+		t.Fatalf("ScaleFont did not call fn with the font")
+	}
+
+	d.setDPI(2 * DefaultDPI)
+	if len(got) != 2 || got[1].DPI != 2*DefaultDPI || got[1].Size != 12 {
+		t.Fatalf("font was not rescaled: %+v", got)
+	}
+	if d.DefaultFont.DPI != 2*DefaultDPI || d.DefaultFont.Height <= defaultFont.Height {
+		t.Fatalf("DefaultFont was not rescaled: %+v", d.DefaultFont.FaceID)
+	}
+
+	stop()
+	d.setDPI(DefaultDPI)
+	if len(got) != 2 {
+		t.Fatalf("fn called after stop")
+	}
+	if d.DefaultFont.FaceID != defaultFont.FaceID {
+		t.Fatalf("DefaultFont: expected %+v got %+v", defaultFont.FaceID, d.DefaultFont.FaceID)
+	}
+}
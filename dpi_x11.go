@@ -0,0 +1,125 @@
+// +build dragonfly freebsd linux netbsd openbsd solaris
+
+package duitdraw
+
+import (
+	"image"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/xgb/randr"
+	"github.com/BurntSushi/xgb/xproto"
+	"golang.org/x/exp/shiny/screen"
+)
+
+// SystemDPI returns the DPI of the window from the X server.
+// The Xft.dpi resource is a user setting and takes precedence over the
+// physical size of the monitor the window is on, as reported by RandR.
+func systemDPI(w screen.Window) (int, bool) {
+	d, err := getX11Display()
+	if err != nil {
+		return 0, false
+	}
+	if dpi, ok := d.xftDPI(); ok {
+		return dpi, true
+	}
+	if xw := x11Window(w); xw != 0 && d.randr {
+		return d.monitorDPI(xw)
+	}
+	return 0, false
+}
+
+// XftDPI returns the Xft.dpi resource from the RESOURCE_MANAGER property.
+func (d *x11Display) xftDPI() (int, bool) {
+	p, err := xproto.GetProperty(d.conn, false, d.root, xproto.AtomResourceManager,
+		xproto.AtomString, 0, 1<<16).Reply()
+	if err != nil || p.Format != 8 {
+		return 0, false
+	}
+	return parseXftDPI(string(p.Value))
+}
+
+func parseXftDPI(resources string) (int, bool) {
+	for _, line := range strings.Split(resources, "\n") {
+		if !strings.HasPrefix(line, "Xft.dpi:") {
+			continue
+		}
+		dpi, err := strconv.ParseFloat(strings.TrimSpace(line[len("Xft.dpi:"):]), 64)
+		if err != nil || dpi <= 0 {
+			return 0, false
+		}
+		return int(dpi + 0.5), true
+	}
+	return 0, false
+}
+
+// MonitorDPI returns the DPI of the monitor which contains the center of the window.
+func (d *x11Display) monitorDPI(xw xproto.Window) (int, bool) {
+	g, err := xproto.GetGeometry(d.conn, xproto.Drawable(xw)).Reply()
+	if err != nil {
+		return 0, false
+	}
+	t, err := xproto.TranslateCoordinates(d.conn, xw, d.root,
+		int16(g.Width/2), int16(g.Height/2)).Reply()
+	if err != nil {
+		return 0, false
+	}
+	center := image.Pt(int(t.DstX), int(t.DstY))
+
+	res, err := randr.GetScreenResourcesCurrent(d.conn, d.root).Reply()
+	if err != nil {
+		return 0, false
+	}
+	for _, crtc := range res.Crtcs {
+		c, err := randr.GetCrtcInfo(d.conn, crtc, res.ConfigTimestamp).Reply()
+		if err != nil || c.Width == 0 || len(c.Outputs) == 0 {
+			continue
+		}
+		r := image.Rect(int(c.X), int(c.Y), int(c.X)+int(c.Width), int(c.Y)+int(c.Height))
+		if !center.In(r) {
+			continue
+		}
+		o, err := randr.GetOutputInfo(d.conn, c.Outputs[0], res.ConfigTimestamp).Reply()
+		if err != nil || o.MmWidth == 0 {
+			return 0, false
+		}
+		width := c.Width
+		if c.Rotation&(randr.RotationRotate90|randr.RotationRotate270) != 0 {
+			width = c.Height
+		}
+		dpi := int(float64(width)*25.4/float64(o.MmWidth) + 0.5)
+		// Some monitors report their aspect ratio or nonsense as their size.
+		if dpi < 50 || dpi > 1000 {
+			return 0, false
+		}
+		return dpi, true
+	}
+	return 0, false
+}
+
+// UpdateDPI sends the current DPI to the window xw, or to all windows if xw is 0.
+// Updates are delayed, as a moving window receives many events.
+func (d *x11Display) updateDPI(xw xproto.Window) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for w := range d.windows {
+		if xw != 0 && w != xw {
+			continue
+		}
+		if t := d.timers[w]; t != nil {
+			t.Reset(100 * time.Millisecond)
+			continue
+		}
+		w := w
+		d.timers[w] = time.AfterFunc(100*time.Millisecond, func() {
+			d.mu.Lock()
+			dpy := d.windows[w]
+			delete(d.timers, w)
+			d.mu.Unlock()
+			if dpy != nil {
+				dpy.window.Send(dpiEvent{windowDPI(dpy.window)})
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+// +build dragonfly freebsd linux netbsd openbsd solaris
+
+package duitdraw
+
+import "testing"
+
+func TestParseXftDPI(t *testing.T) {
+	tt := []struct {
+		res string
+		dpi int
+		ok  bool
+	}{
+		{"", 0, false},
+		{"Xft.antialias:\t1\nXft.dpi:\t96\nXft.hinting:\t1\n", 96, true},
+		{"Xft.dpi: 144.6", 145, true},
+		{"Xft.dpi:\tlarge\n", 0, false},
+		{"*dpi:\t96\n", 0, false},
+	}
+	for _, tc := range tt {
+		if dpi, ok := parseXftDPI(tc.res); dpi != tc.dpi || ok != tc.ok {
+			t.Errorf("%q: expected %d %v got %d %v", tc.res, tc.dpi, tc.ok, dpi, ok)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package duitdraw
 import (
 	"image"
 	"io"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/mobile/event/key"
@@ -39,33 +40,73 @@ func (d *Display) eventLoop(errch chan<- error) {
 	// Initial resize call, to allocate the buffer.
 	resizeFunc(size.Event{WidthPx: 800, HeightPx: 600})
 
+	// Mouse events are sent by a separate goroutine, which does not block the window.
+	done := make(chan struct{})
+	defer close(done)
+	go d.mouse.deliver(done)
+
 	// Send an initial mouse event to trigger a Redraw.
-	d.mouse.C <- d.mouse.Mouse
+	d.mouse.queue.push(d.mouse.Mouse)
 
 	// Delay and filter resize events.
+	// The timer is started by the first size event and the goroutine
+	// ends with the event loop.
 	resize := make(chan size.Event)
 	go func(se chan size.Event) {
 		var cur size.Event
 		delay := 100 * time.Millisecond
-		t := time.NewTimer(delay)
+		var t *time.Timer
+		var tc <-chan time.Time
 		for {
 			select {
 			case e := <-se:
 				cur = e
-				t.Reset(delay) // Is that safe?
-			case <-t.C:
+				if t == nil {
+					t = time.NewTimer(delay)
+					tc = t.C
+				} else {
+					t.Reset(delay) // Is that safe?
+				}
+			case <-tc:
 				resizeFunc(cur)
+			case <-done:
+				if t != nil {
+					t.Stop()
+				}
+				return
 			}
 		}
 	}(resize)
 
 	for {
-		switch e := w.NextEvent().(type) {
+		ev := w.NextEvent()
+		msec := d.msec(time.Now())
+		switch e := ev.(type) {
 		case lifecycle.Event:
 			if e.To == lifecycle.StageDead {
 				errch <- io.EOF
 				return
 			}
+			switch e.Crosses(lifecycle.StageFocused) {
+			case lifecycle.CrossOn:
+				if d.ime != nil {
+					d.ime.focus(true)
+				}
+				d.ScreenImage.Lock()
+				if d.cursorHidden {
+					hideCursor(w, true)
+				}
+				d.ScreenImage.Unlock()
+				d.sendWindowEvent(FocusIn)
+			case lifecycle.CrossOff:
+				if d.ime != nil {
+					d.ime.focus(false)
+				}
+				ungrabPointer(w)
+				// A hidden cursor would stay hidden over other windows.
+				hideCursor(w, false)
+				d.sendWindowEvent(FocusOut)
+			}
 
 		case paint.Event:
 			if b != nil {
@@ -84,13 +125,17 @@ func (d *Display) eventLoop(errch chan<- error) {
 			}
 			resize <- e
 
+		case dpiEvent:
+			d.setDPI(e.dpi)
+
+		case WindowEvent:
+			d.sendWindowEvent(e)
+
 		case mouse.Event:
 			// Mouse.Buttons stores a bitmask for each button state.
 			// On the other side a mouse.Event arrives, if anything changes.
 			if e.Button > 0 { // TODO: wheel is < 0
 				if e.Direction == mouse.DirPress {
-					// Uncomment for cursorOffset calibration:
-					// fmt.Printf("shiny: mouse click: %f %f\n", e.X, e.Y)
 					mm.Buttons ^= 1 << uint(e.Button-1)
 				} else if e.Direction == mouse.DirRelease {
 					mm.Buttons &= ^(1 << uint(e.Button-1))
@@ -98,51 +143,67 @@ func (d *Display) eventLoop(errch chan<- error) {
 			} else if e.Button < 0 {
 				// For mouse wheel events, we receive a single event
 				// but duit expects two: set the bit and release it.
-				shift := uint(3) // ButtonWheelUp
-				if e.Button == mouse.ButtonWheelDown {
+				// Buttons 4 and 5 scroll vertically, 6 and 7 horizontally.
+				var shift uint
+				switch e.Button {
+				case mouse.ButtonWheelUp:
+					shift = 3
+				case mouse.ButtonWheelDown:
 					shift = 4
+				case mouse.ButtonWheelLeft:
+					shift = 5
+				case mouse.ButtonWheelRight:
+					shift = 6
 				}
 				mm.Buttons ^= 1 << shift
-				d.sendMouseEvent(e, &mm)
+				d.sendMouseEvent(e, &mm, msec)
 				mm.Buttons &= ^(1 << shift)
+				d.sendScroll(e, msec)
 			}
-			d.sendMouseEvent(e, &mm)
+			d.sendMouseEvent(e, &mm, msec)
 
 		case key.Event:
-			if t := d.KeyTranslator; t == nil {
-				// We forward the event for key presses and subsequent events
-				// if the key remains down, but not for releases.
-				var sendKey rune = -1
-				if r := e.Rune; e.Direction != key.DirRelease {
-					if r != -1 {
-						sendKey = r
-					} else {
-						if r, ok := keymap[e.Code]; ok {
-							sendKey = r
-						}
-					}
-
+			// We forward the event for key presses and subsequent events
+			// if the key remains down, but not for releases,
+			// unless a KeyTranslator is installed.
+			if d.ime != nil && d.ime.processKey(e) {
+				d.sendKey(e, -1)
+				continue
+			}
+			if e.Rune == 0 && e.Direction == key.DirPress {
+				if sym := deadKeyOf(d); sym != "" {
+					d.compose.start(sym)
 				}
-				if sendKey != -1 {
-					// Shiny sends \r on Enter, duit expects \n.
-					if sendKey == '\r' {
-						sendKey = '\n'
-					}
-					if e.Modifiers == 0x2 { // Ctrl
-						if r, ok := ctrlMods[sendKey]; ok {
-							sendKey = r
-						}
-					}
-					// fmt.Printf("shiny: key: %x %v\n", sendKey, e)
-					d.keyboard.C <- sendKey
+			}
+			r := d.translateKey(e)
+			if e.Direction == key.DirRelease {
+				if r != -1 && d.KeyTranslator != nil {
+					d.sendRune(r, false)
+				}
+			} else {
+				repeat := d.keyboard.repeat(e)
+				for _, c := range d.compose.key(r) {
+					d.sendRune(c, repeat)
 				}
+			}
+			if r == composeKey {
+				r = -1
+			}
+			d.sendKey(e, r)
 
-				// TODO: what about Shift-KeyLeft/Right
-				// to mark text? This seems to be unsupported in duit right now.
+		case imeCommit:
+			for _, r := range e.text {
+				d.sendRune(r, false)
+			}
 
-			} else if r := t.TranslateKey(e); r != -1 {
-				d.keyboard.C <- r
+		case imePreedit:
+			if d.Preedit != nil {
+				d.Preedit(e.text, e.cursor)
 			}
+
+		case keyRelease:
+			d.sendKeyRelease(e.Key)
+
 		case error:
 			errch <- e
 
@@ -150,13 +211,97 @@ func (d *Display) eventLoop(errch chan<- error) {
 	}
 }
 
-func (d *Display) sendMouseEvent(e mouse.Event, m *Mouse) {
+// TranslateKey returns the rune for a key event, or -1.
+func (d *Display) translateKey(e key.Event) rune {
+	switch t := d.KeyTranslator.(type) {
+	case nil:
+	case *Keymap:
+		return t.translate(e, d.ModifierKeys, d.ControlKeys)
+	default:
+		return t.TranslateKey(e)
+	}
+	return translateKey(e, d.ModifierKeys, d.ControlKeys)
+}
+
+// TranslateKey is the default translation of key events.
+// Modifier key presses are only sent if modifierKeys is set.
+// Control combinations without Alt are translated with controlKeys.
+func translateKey(e key.Event, modifierKeys bool, controlKeys map[rune]rune) rune {
+	sendKey := e.Rune
+	if sendKey == 0 {
+		// Shiny sends 0 for keysyms it does not know, e.g. dead keys.
+		sendKey = -1
+	}
+	if sendKey == -1 {
+		if r, ok := keymap[e.Code]; ok {
+			sendKey = r
+		}
+	}
+	if sendKey == composeKey {
+		return composeKey
+	}
+	if isModifierKey(sendKey) {
+		if !modifierKeys || e.Direction != key.DirPress {
+			return -1
+		}
+		return sendKey
+	}
+	if sendKey != -1 {
+		// Shiny sends \r on Enter, duit expects \n.
+		if sendKey == '\r' {
+			sendKey = '\n'
+		}
+		// Super on X11 and Cmd on macOS is Kcmd as in plan9port.
+		if e.Modifiers&key.ModMeta != 0 && sendKey < 0x100 {
+			return KeyCmd + sendKey
+		}
+		// Windows reports AltGr as Control and Alt, its runes are not translated.
+		if e.Modifiers&(key.ModControl|key.ModAlt) == key.ModControl {
+			if r, ok := controlKeys[sendKey]; ok {
+				sendKey = r
+			}
+		}
+		// fmt.Printf("shiny: key: %x %v\n", sendKey, e)
+	}
+	return sendKey
+}
+
+func (d *Display) sendMouseEvent(e mouse.Event, m *Mouse, msec uint32) {
 	m.Point.X = int(e.X)
 	m.Point.Y = int(e.Y)
-	t := time.Now().UnixNano() / (1000 * 1000) // Milliseconds
-	m.Msec = uint32(t)
+	m.Msec = msec
 
-	d.mouse.C <- *m
-	// Mouse field is racy. See Mousectl documentation.
-	d.mouse.Mouse = *m
+	d.mouse.queue.push(*m)
+}
+
+// Msec returns the milliseconds since the display was created.
+// The clock is monotonic, it does not jump if the system time is changed.
+func (d *Display) msec(t time.Time) uint32 {
+	return uint32(t.Sub(d.start) / time.Millisecond)
+}
+
+// SendScroll sends a wheel event to the Scroll channel, if it is enabled.
+// Events are dropped if the channel is full.
+func (d *Display) sendScroll(e mouse.Event, msec uint32) {
+	if atomic.LoadInt32(&d.mouse.scrollOn) == 0 {
+		return
+	}
+	s := Scroll{
+		Point: image.Point{int(e.X), int(e.Y)},
+		Msec:  msec,
+	}
+	switch e.Button {
+	case mouse.ButtonWheelUp:
+		s.StepY = -1
+	case mouse.ButtonWheelDown:
+		s.StepY = 1
+	case mouse.ButtonWheelLeft:
+		s.StepX = -1
+	case mouse.ButtonWheelRight:
+		s.StepX = 1
+	}
+	select {
+	case d.mouse.scroll <- s:
+	default:
+	}
 }
@@ -0,0 +1,224 @@
+package duitdraw
+
+import (
+	"image"
+	"io"
+	"testing"
+	"time"
+
+	"golang.org/x/exp/shiny/screen"
+	"golang.org/x/mobile/event/key"
+	"golang.org/x/mobile/event/lifecycle"
+	"golang.org/x/mobile/event/mouse"
+)
+
+// FakeScreen and fakeWindow run the event loop without a window system.
+// Methods which are not implemented panic.
+type fakeScreen struct {
+	screen.Screen
+}
+
+func (fakeScreen) NewBuffer(size image.Point) (screen.Buffer, error) {
+	return fakeBuffer{m: image.NewRGBA(image.Rectangle{Max: size})}, nil
+}
+
+type fakeBuffer struct {
+	screen.Buffer
+	m *image.RGBA
+}
+
+func (b fakeBuffer) Release()                {}
+func (b fakeBuffer) Size() image.Point       { return b.m.Rect.Size() }
+func (b fakeBuffer) Bounds() image.Rectangle { return b.m.Rect }
+func (b fakeBuffer) RGBA() *image.RGBA       { return b.m }
+
+type fakeWindow struct {
+	screen.Window
+	events chan interface{}
+}
+
+func (w *fakeWindow) Send(e interface{})                                           { w.events <- e }
+func (w *fakeWindow) NextEvent() interface{}                                       { return <-w.events }
+func (w *fakeWindow) Publish() screen.PublishResult                                { return screen.PublishResult{} }
+func (w *fakeWindow) Upload(dp image.Point, src screen.Buffer, sr image.Rectangle) {}
+
+// StartEventLoop runs the event loop of a new display on a fake window.
+// It returns after the initial resize and mouse events are received.
+// The returned function closes the window.
+func startEventLoop(t *testing.T) (*Display, *fakeWindow, func()) {
+	old := mainScreen
+	mainScreen = fakeScreen{}
+	d, _ := newDisplay("", "", "")
+	w := &fakeWindow{events: make(chan interface{}, 16)}
+	d.window = w
+	errch := make(chan error, 1)
+	go d.eventLoop(errch)
+	<-d.mouse.Resize
+	<-d.mouse.C
+	return d, w, func() {
+		w.Send(lifecycle.Event{To: lifecycle.StageDead})
+		if err := <-errch; err != io.EOF {
+			t.Errorf("event loop returned %v", err)
+		}
+		mainScreen = old
+	}
+}
+
+func readMouse(t *testing.T, d *Display) Mouse {
+	select {
+	case m := <-d.mouse.C:
+		return m
+	case <-time.After(time.Second):
+		t.Fatal("no mouse event")
+	}
+	return Mouse{}
+}
+
+func TestWheel(t *testing.T) {
+	d, w, done := startEventLoop(t)
+	defer done()
+	scroll := d.mouse.ScrollEvents()
+
+	tt := []struct {
+		button mouse.Button
+		bits   int
+		dx, dy int
+	}{
+		{mouse.ButtonWheelUp, 1 << 3, 0, -1},
+		{mouse.ButtonWheelDown, 1 << 4, 0, 1},
+		{mouse.ButtonWheelLeft, 1 << 5, -1, 0},
+		{mouse.ButtonWheelRight, 1 << 6, 1, 0},
+	}
+	for _, tc := range tt {
+		w.Send(mouse.Event{X: 10, Y: 20, Button: tc.button, Direction: mouse.DirStep})
+		if m := readMouse(t, d); m.Buttons != tc.bits || m.Point != image.Pt(10, 20) {
+			t.Errorf("%v: expected buttons %b at (10,20), got %b at %v", tc.button, tc.bits, m.Buttons, m.Point)
+		}
+		if m := readMouse(t, d); m.Buttons != 0 {
+			t.Errorf("%v: button was not released: %b", tc.button, m.Buttons)
+		}
+		select {
+		case s := <-scroll:
+			if s.StepX != tc.dx || s.StepY != tc.dy || s.Point != image.Pt(10, 20) {
+				t.Errorf("%v: expected scroll %v,%v got %+v", tc.button, tc.dx, tc.dy, s)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%v: no scroll event", tc.button)
+		}
+	}
+}
+
+func readKey(t *testing.T, keys <-chan Key) Key {
+	select {
+	case k := <-keys:
+		return k
+	case <-time.After(time.Second):
+		t.Fatal("no key event")
+	}
+	return Key{}
+}
+
+func TestKeyEvents(t *testing.T) {
+	d, w, done := startEventLoop(t)
+	defer done()
+	keys := d.keyboard.KeyEvents()
+
+	press := key.Event{Rune: 'a', Code: key.CodeA, Direction: key.DirPress}
+	release := press
+	release.Direction = key.DirRelease
+	shiftLeft := key.Event{Rune: -1, Code: key.CodeLeftArrow, Modifiers: key.ModShift, Direction: key.DirPress}
+
+	w.Send(press)
+	if r := <-d.keyboard.C; r != 'a' {
+		t.Errorf("expected rune a got %q", r)
+	}
+	if k := readKey(t, keys); k != (Key{Rune: 'a', Code: key.CodeA, Dir: KeyDirPress}) {
+		t.Errorf("press: got %+v", k)
+	}
+
+	// Autorepeat on X11 is a release followed by a press.
+	w.Send(release)
+	w.Send(press)
+	<-d.keyboard.C
+	if k := readKey(t, keys); k.Dir != KeyDirRepeat {
+		t.Errorf("expected repeat got %+v", k)
+	}
+
+	w.Send(shiftLeft)
+	if r := <-d.keyboard.C; r != KeyLeft {
+		t.Errorf("expected KeyLeft got %x", r)
+	}
+	if k := readKey(t, keys); k.Rune != KeyLeft || k.Modifiers != key.ModShift || k.Dir != KeyDirPress {
+		t.Errorf("shift left: got %+v", k)
+	}
+
+	w.Send(release)
+	if k := readKey(t, keys); k.Code != key.CodeA || k.Dir != KeyDirRelease {
+		t.Errorf("expected release of a got %+v", k)
+	}
+	if len(d.keyboard.C) != 0 {
+		t.Errorf("release was sent as rune")
+	}
+}
+
+func TestKeyEventsFull(t *testing.T) {
+	d, w, done := startEventLoop(t)
+	defer done()
+	d.KeyOverflow = KeyOverflowDropOldest
+	keys := d.keyboard.KeyEvents()
+
+	// The event loop calls Preedit after all keys are handled.
+	// It would block, if a full key channel stopped the window.
+	sync := make(chan bool)
+	d.Preedit = func(string, int) { sync <- true }
+	n := cap(keys) + 5
+	go func() {
+		for i := 0; i < n; i++ {
+			w.Send(key.Event{Rune: 'a', Code: key.CodeA, Direction: key.DirPress})
+		}
+		w.Send(imePreedit{})
+	}()
+	select {
+	case <-sync:
+	case <-time.After(time.Second):
+		t.Fatal("event loop blocks on a full key channel")
+	}
+	if len(keys) != cap(keys) {
+		t.Errorf("expected %d buffered key events got %d", cap(keys), len(keys))
+	}
+	if got := d.DroppedKeys(); got != 2*5 {
+		t.Errorf("expected %d dropped keys got %d", 2*5, got)
+	}
+}
+
+func TestWindowEvents(t *testing.T) {
+	d, w, done := startEventLoop(t)
+	defer done()
+
+	// Events are not sent before the channel is requested.
+	// The event loop calls Preedit, after PointerEnter is handled.
+	sync := make(chan bool)
+	d.Preedit = func(string, int) { sync <- true }
+	w.Send(PointerEnter)
+	w.Send(imePreedit{})
+	<-sync
+	c := d.WindowEvents()
+	w.Send(lifecycle.Event{From: lifecycle.StageVisible, To: lifecycle.StageFocused})
+	w.Send(PointerLeave)
+	w.Send(lifecycle.Event{From: lifecycle.StageFocused, To: lifecycle.StageVisible})
+	for _, exp := range []WindowEvent{FocusIn, PointerLeave, FocusOut} {
+		select {
+		case e := <-c:
+			if e != exp {
+				t.Errorf("expected %v got %v", exp, e)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no window event, expected %v", exp)
+		}
+	}
+	select {
+	case m := <-d.mouse.C:
+		t.Errorf("unexpected mouse event %v", m)
+	default:
+	}
+}
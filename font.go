@@ -3,7 +3,9 @@ package duitdraw
 import (
 	"fmt"
 	"image"
+	"image/draw"
 	"io/ioutil"
+	"math"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -17,21 +19,44 @@ import (
 )
 
 type Font struct {
-	FaceID // This field is not present in 9fans draw package.
-	Height int
-	face   font.Face
+	FaceID   // This field is not present in 9fans draw package.
+	Height   int
+	Shaper   Shaper // Shaper for the Shape option, nil is the built-in shaper. Not present in 9fans.
+	Fallback *Font  // Font for runes without a glyph, e.g. an emoji font. Not present in 9fans.
+	face     font.Face
+	file     *fontFile // nil for Plan 9 fonts and registered faces.
 }
 
 type FaceID struct {
 	Name string
 	Size int
 	DPI  int
+	FontOptions
+}
+
+// FontOptions control the rendering of truetype fonts.
+// The zero value gives the default rendering expected by duit.
+// Plan 9 bitmap fonts ignore the options.
+type FontOptions struct {
+	Kern    bool         // Use kerning and fractional advances.
+	Hinting font.Hinting // Vertical hinting is currently the same as full hinting.
+	NoAA    bool         // Disable antialiasing.
+	Gamma   float64      // Gamma applied to glyph coverage, 0 is the same as 1.
+	Shape   bool         // Reorder bidirectional text and shape complex scripts.
 }
 
 // FaceCache stores font.Faces.
 type FaceCache struct {
 	sync.Mutex
-	m map[FaceID]font.Face
+	m     map[FaceID]font.Face
+	files map[string]*fontFile
+}
+
+// FontFile is a parsed truetype font file, which is shared by all faces of the file.
+type fontFile struct {
+	ttf    *truetype.Font
+	color  *colorTables // nil if the font has no color glyphs.
+	layout *otLayout    // nil if the font has no GSUB and GPOS tables.
 }
 
 var faceCache FaceCache
@@ -40,34 +65,107 @@ var faceCache FaceCache
 // Currently Plan 9 bitmap fonts and truetype fonts are supported.
 // Plan 9 font must have filename or extension "font" and truetype font
 // have the syntax "/path/to/font.ttf@12pt".
+//
+// Options for truetype fonts may follow the size, separated by commas,
+// e.g. "/path/to/font.ttf@12pt,kern,hint=full":
+//	kern	use kerning and fractional advances
+//	hint=x	hinting: none, vertical or full
+//	noaa	disable antialiasing
+//	gamma=x	gamma for glyph coverage, values above 1 make text bolder
+//	shape	reorder bidirectional text and shape complex scripts (see Shaper)
+// By default, glyphs advance by whole pixels without kerning, which is what duit expects.
+//
+// As in plan9port, the name of a Plan 9 font may give a second font for
+// high DPI displays after a comma, e.g. "/lib/font/bit/lucsans/euro.8.font,/lib/font/bit/lucsans/euro.16.font".
+// It is used if the DPI is at least 1.5 times DefaultDPI. Without it, the glyphs
+// of the first font are pixel-doubled.
 func (d *Display) OpenFont(name string) (*Font, error) {
-	if s := strings.ToLower(name); filepath.Base(s) == "font" || filepath.Ext(s) == ".font" {
-		return openPlan9Font(FaceID{Name: name})
+	if isPlan9Font(name) {
+		return openPlan9Font(FaceID{Name: name, DPI: d.DPI})
+	}
+	id, err := d.parseFontName(name)
+	if err != nil {
+		return nil, err
 	}
-	size := DefaultFontSize
+	return openFont(id)
+}
+
+// OpenFontOptions is like OpenFont, but uses opt instead of any options
+// given in the font name.
+func (d *Display) OpenFontOptions(name string, opt FontOptions) (*Font, error) {
+	if isPlan9Font(name) {
+		return openPlan9Font(FaceID{Name: name, DPI: d.DPI})
+	}
+	id, err := d.parseFontName(name)
+	if err != nil {
+		return nil, err
+	}
+	id.FontOptions = opt
+	return openFont(id)
+}
+
+func isPlan9Font(name string) bool {
+	s := strings.ToLower(name)
+	return filepath.Base(s) == "font" || filepath.Ext(s) == ".font"
+}
+
+// ParseFontName returns the FaceID of a truetype font name for the display.
+func (d *Display) parseFontName(name string) (FaceID, error) {
+	id := FaceID{Size: DefaultFontSize, DPI: d.DPI}
 	if idx := strings.LastIndex(name, "@"); idx != -1 {
-		ext := name[idx+1:]
-		ext = strings.TrimSuffix(ext, "pt")
-		if n, err := strconv.Atoi(ext); err != nil {
-			return nil, fmt.Errorf("OpenFont: cannot parse font size: %s", name)
-		} else {
-			size = n
+		for i, opt := range strings.Split(name[idx+1:], ",") {
+			var val string
+			if k := strings.Index(opt, "="); k != -1 {
+				opt, val = opt[:k], opt[k+1:]
+			}
+			switch n, err := strconv.Atoi(strings.TrimSuffix(opt, "pt")); {
+			case i == 0 && err == nil:
+				id.Size = n
+			case opt == "kern":
+				id.Kern = true
+			case opt == "noaa":
+				id.NoAA = true
+			case opt == "shape":
+				id.Shape = true
+			case opt == "hint" && val == "none":
+				id.Hinting = font.HintingNone
+			case opt == "hint" && val == "vertical":
+				id.Hinting = font.HintingVertical
+			case opt == "hint" && val == "full":
+				id.Hinting = font.HintingFull
+			case opt == "gamma":
+				g, err := strconv.ParseFloat(val, 64)
+				if err != nil || g <= 0 {
+					return id, fmt.Errorf("OpenFont: cannot parse gamma: %s", name)
+				}
+				id.Gamma = g
+			case i == 0:
+				return id, fmt.Errorf("OpenFont: cannot parse font size: %s", name)
+			default:
+				return id, fmt.Errorf("OpenFont: unknown font option %q: %s", opt, name)
+			}
 		}
 		name = name[:idx]
 	}
-	return openFont(FaceID{Name: name, Size: size, DPI: d.DPI})
+	id.Name = name
+	return id, nil
 }
 
 // RegisterFont adds a font face to the font cache.
+// Glyphs cached for a previous face with the same id are discarded.
 func RegisterFont(id FaceID, face font.Face) {
 	faceCache.Lock()
 	defer faceCache.Unlock()
 	faceCache.m[id] = face
+	glyphs.purge(id)
 }
 
 // OpenFont loads a font from fontCache, from Disk or returns GoRegular
 // if the font name is empty.
 func openFont(id FaceID) (*Font, error) {
+	if id.Gamma == 1 {
+		id.Gamma = 0
+	}
 	faceCache.Lock()
 	defer faceCache.Unlock()
 	if f, ok := faceCache.m[id]; ok {
@@ -77,38 +175,52 @@ func openFont(id FaceID) (*Font, error) {
 			FaceID: id,
 			Height: (m.Ascent + m.Descent).Round(),
 			face:   f,
+			file:   faceCache.files[id.Name],
 		}, nil
 	}
 
-	var ttf []byte
-	if id.Name == "" {
-		ttf = goregular.TTF
-	} else {
-		if b, err := ioutil.ReadFile(id.Name); err != nil {
-			return nil, err
+	file, ok := faceCache.files[id.Name]
+	if !ok {
+		var ttf []byte
+		if id.Name == "" {
+			ttf = goregular.TTF
 		} else {
-			ttf = b
+			if b, err := ioutil.ReadFile(id.Name); err != nil {
+				return nil, err
+			} else {
+				ttf = b
+			}
 		}
-	}
-
-	if f, err := truetype.Parse(ttf); err != nil {
-		return nil, fmt.Errorf("%s: %s", id.Name, err)
-	} else {
-		opt := truetype.Options{
-			Size: float64(id.Size),
-			DPI:  float64(id.DPI),
+		f, err := truetype.Parse(ttf)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", id.Name, err)
 		}
-		face := pixFace{Face: truetype.NewFace(f, &opt)}
-		faceCache.m[id] = face
+		file = &fontFile{ttf: f, color: parseColorTables(ttf), layout: parseLayout(ttf)}
+		faceCache.files[id.Name] = file
+	}
 
-		m := face.Metrics()
-		// TODO(fhs): Remove workaround for wrong m.Height.
-		return &Font{
-			FaceID: id,
-			Height: (m.Ascent + m.Descent).Round(),
-			face:   face,
-		}, nil
+	opt := truetype.Options{
+		Size:    float64(id.Size),
+		DPI:     float64(id.DPI),
+		Hinting: id.Hinting,
+	}
+	var face font.Face = truetype.NewFace(file.ttf, &opt)
+	if id.NoAA || id.Gamma != 0 {
+		face = newMaskFace(face, id.NoAA, id.Gamma)
 	}
+	if !id.Kern {
+		face = pixFace{Face: face}
+	}
+	faceCache.m[id] = face
+
+	m := face.Metrics()
+	// TODO(fhs): Remove workaround for wrong m.Height.
+	return &Font{
+		FaceID: id,
+		Height: (m.Ascent + m.Descent).Round(),
+		face:   face,
+		file:   file,
+	}, nil
 
 	/* TODO: use sfnt/opentype, when it's finished.
 	f, err := sfnt.Parse(ttf)
@@ -132,17 +244,22 @@ func openPlan9Font(id FaceID) (*Font, error) {
 		}, nil
 	}
 
-	fontData, err := ioutil.ReadFile(id.Name)
+	name, scale := plan9FontName(id)
+	fontData, err := ioutil.ReadFile(name)
 	if err != nil {
 		return nil, err
 	}
-	dir := filepath.Dir(id.Name)
-	face, err := plan9font.ParseFont(fontData, func(name string) ([]byte, error) {
+	dir := filepath.Dir(name)
+	var face font.Face
+	face, err = plan9font.ParseFont(fontData, func(name string) ([]byte, error) {
 		return ioutil.ReadFile(filepath.Join(dir, name))
 	})
 	if err != nil {
 		return nil, err
 	}
+	if scale > 1 {
+		face = &scaledFace{Face: face, n: scale}
+	}
 	faceCache.m[id] = face
 
 	return &Font{
@@ -152,33 +269,143 @@ func openPlan9Font(id FaceID) (*Font, error) {
 	}, nil
 }
 
+// Plan9FontName returns the file name of the low or high DPI variant of a
+// Plan 9 font, and the factor its glyphs have to be scaled with.
+func plan9FontName(id FaceID) (string, int) {
+	lo, hi := id.Name, ""
+	if i := strings.Index(lo, ","); i != -1 {
+		lo, hi = lo[:i], lo[i+1:]
+	}
+	if id.DPI < DefaultDPI*3/2 {
+		return lo, 1
+	} else if hi != "" {
+		return hi, 1
+	}
+	return lo, 2
+}
+
+// SetDPI returns the font for another DPI, or f if it cannot be opened.
 func (f *Font) SetDPI(dpi int) *Font {
+	if dpi == f.DPI {
+		return f
+	}
 	id := f.FaceID
 	id.DPI = dpi
-	if font, err := openFont(id); err != nil {
-		return f
+	var font *Font
+	var err error
+	if isPlan9Font(id.Name) {
+		font, err = openPlan9Font(id)
 	} else {
-		return font
+		font, err = openFont(id)
+	}
+	if err != nil {
+		return f
 	}
+	font.Shaper = f.Shaper
+	if f.Fallback != nil {
+		font.Fallback = f.Fallback.SetDPI(dpi)
+	}
+	return font
 }
 
+// StringSize returns the number of horizontal and vertical pixels that would
+// be occupied by the string if it were drawn using the font.
 func (f Font) StringSize(s string) image.Point {
 	dx := f.StringWidth(s)
 	dy := f.Height
 	return image.Point{dx, dy}
 }
 
+// BytesSize returns the number of horizontal and vertical pixels that would
+// be occupied by the byte slice if it were drawn using the font.
+func (f *Font) BytesSize(b []byte) image.Point {
+	return f.StringSize(string(b))
+}
+
+// RunesSize returns the number of horizontal and vertical pixels that would
+// be occupied by the rune slice if it were drawn using the font.
+func (f *Font) RunesSize(r []rune) image.Point {
+	return f.StringSize(string(r))
+}
+
 // StringWidth returns the number of horizontal pixels that would be occupied
 // by the string if it were drawn using the font.
+//
+// The result is the same as the horizontal distance Image.String advances.
+// Without Kern, each advance is rounded to full pixels, so the width of a string is
+// the sum of the widths of its runes.
 func (f *Font) StringWidth(s string) int {
-	dx := 0
+	return f.layout(s, nil).Round()
+}
+
+// Layout calls fn for each glyph of s with its offset from the start of
+// the string, and returns the total advance. With the Shape option, the
+// glyphs are those of the shaper.
+// Image.string draws with layout, so it always agrees with StringWidth.
+func (f *Font) layout(s string, fn func(g Glyph, x fixed.Int26_6)) fixed.Int26_6 {
+	var x fixed.Int26_6
+	if f.Shape {
+		for _, g := range f.shape(s) {
+			if fn != nil {
+				fn(g, x)
+			}
+			x += g.Advance
+		}
+		return x
+	}
+	var pf *Font
+	prev := rune(-1)
 	for _, c := range s {
-		a, ok := f.face.GlyphAdvance(c)
-		if ok {
-			dx += a.Round()
+		g := f.fontFor(c)
+		if prev >= 0 && g == pf {
+			x += g.kern(prev, c)
+		}
+		a, ok := g.advance(c)
+		if !ok {
+			continue
+		}
+		if fn != nil {
+			fn(Glyph{Font: g, Rune: c, Advance: a}, x)
+		}
+		x += a
+		prev, pf = c, g
+	}
+	return x
+}
+
+// FontFor returns the first font of the fallback chain which has a glyph
+// for r, or f if there is none.
+func (f *Font) fontFor(r rune) *Font {
+	if f.Fallback == nil {
+		return f
+	}
+	for g := f; g != nil; g = g.Fallback {
+		if g.hasGlyph(r) {
+			return g
 		}
 	}
-	return dx
+	return f
+}
+
+// StringNWidth returns the number of horizontal pixels that would be occupied
+// by the first n runes of the string if they were drawn using the font.
+func (f *Font) StringNWidth(s string, n int) int {
+	return f.StringWidth(stringN(s, n))
+}
+
+// BytesNWidth returns the number of horizontal pixels that would be occupied
+// by the first n runes of the byte slice if they were drawn using the font.
+func (f *Font) BytesNWidth(b []byte, n int) int {
+	return f.StringWidth(stringN(string(b), n))
+}
+
+// RunesNWidth returns the number of horizontal pixels that would be occupied
+// by the first n runes of the rune slice if they were drawn using the font.
+func (f *Font) RunesNWidth(r []rune, n int) int {
+	if n >= 0 && n < len(r) {
+		r = r[:n]
+	}
+	return f.RunesWidth(r)
 }
 
 // ByteWidth returns the number of horizontal pixels that would be occupied by
@@ -209,12 +436,118 @@ func (f pixFace) Glyph(dot fixed.Point26_6, r rune) (dr image.Rectangle, mask im
 	return
 }
 
+func (f pixFace) GlyphAdvance(r rune) (advance fixed.Int26_6, ok bool) {
+	advance, ok = f.Face.GlyphAdvance(r)
+	advance = 64 * fixed.Int26_6(int(advance+32)/64)
+	return
+}
+
 func (f pixFace) GlyphBounds(r rune) (bounds fixed.Rectangle26_6, advance fixed.Int26_6, ok bool) {
 	bounds, advance, ok = f.Face.GlyphBounds(r)
 	advance = 64 * fixed.Int26_6(int(advance+32)/64)
 	return
 }
 
+// HasGlyph returns if the font has a glyph for r.
+func (f *Font) hasGlyph(r rune) bool {
+	if f.file != nil {
+		return f.file.ttf.Index(r) != 0
+	}
+	_, ok := f.advance(r)
+	return ok
+}
+
+// maskFace wraps a font.Face and maps the coverage of each glyph mask
+// through a table, to disable antialiasing or apply gamma.
+type maskFace struct {
+	font.Face
+	alpha [256]uint8
+}
+
+func newMaskFace(face font.Face, noaa bool, gamma float64) *maskFace {
+	f := maskFace{Face: face}
+	for i := range f.alpha {
+		a := float64(i) / 255
+		if gamma > 0 {
+			a = math.Pow(a, 1/gamma)
+		}
+		if noaa {
+			a = math.Floor(a + 0.5)
+		}
+		f.alpha[i] = uint8(255*a + 0.5)
+	}
+	return &f
+}
+
+func (f *maskFace) Glyph(dot fixed.Point26_6, r rune) (dr image.Rectangle, mask image.Image, maskp image.Point, advance fixed.Int26_6, ok bool) {
+	dr, mask, maskp, advance, ok = f.Face.Glyph(dot, r)
+	if !ok {
+		return
+	}
+	m := image.NewAlpha(dr)
+	draw.Draw(m, dr, mask, maskp, draw.Src)
+	for y := dr.Min.Y; y < dr.Max.Y; y++ {
+		row := m.Pix[m.PixOffset(dr.Min.X, y):m.PixOffset(dr.Max.X, y)]
+		for i, a := range row {
+			row[i] = f.alpha[a]
+		}
+	}
+	return dr, m, dr.Min, advance, true
+}
+
+// scaledFace enlarges the glyphs of a bitmap font by an integer factor.
+type scaledFace struct {
+	font.Face
+	n int
+}
+
+func (f *scaledFace) Metrics() font.Metrics {
+	m := f.Face.Metrics()
+	n := fixed.Int26_6(f.n)
+	m.Height *= n
+	m.Ascent *= n
+	m.Descent *= n
+	m.XHeight *= n
+	m.CapHeight *= n
+	return m
+}
+
+func (f *scaledFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	return f.Face.Kern(r0, r1) * fixed.Int26_6(f.n)
+}
+
+func (f *scaledFace) GlyphAdvance(r rune) (advance fixed.Int26_6, ok bool) {
+	advance, ok = f.Face.GlyphAdvance(r)
+	return advance * fixed.Int26_6(f.n), ok
+}
+
+func (f *scaledFace) GlyphBounds(r rune) (bounds fixed.Rectangle26_6, advance fixed.Int26_6, ok bool) {
+	bounds, advance, ok = f.Face.GlyphBounds(r)
+	n := fixed.Int26_6(f.n)
+	bounds.Min = bounds.Min.Mul(n << 6)
+	bounds.Max = bounds.Max.Mul(n << 6)
+	return bounds, advance * n, ok
+}
+
+func (f *scaledFace) Glyph(dot fixed.Point26_6, r rune) (dr image.Rectangle, mask image.Image, maskp image.Point, advance fixed.Int26_6, ok bool) {
+	sr, src, sp, advance, ok := f.Face.Glyph(fixed.Point26_6{}, r)
+	if !ok {
+		return
+	}
+	n := f.n
+	m := image.NewAlpha(image.Rect(sr.Min.X*n, sr.Min.Y*n, sr.Max.X*n, sr.Max.Y*n))
+	for y := 0; y < sr.Dy(); y++ {
+		for x := 0; x < sr.Dx(); x++ {
+			_, _, _, a := src.At(sp.X+x, sp.Y+y).RGBA()
+			for i := 0; i < n*n; i++ {
+				m.Pix[m.PixOffset(m.Rect.Min.X+n*x+i%n, m.Rect.Min.Y+n*y+i/n)] = uint8(a >> 8)
+			}
+		}
+	}
+	ip := image.Point{dot.X.Round(), dot.Y.Round()}
+	return m.Rect.Add(ip), m, m.Rect.Min, advance * fixed.Int26_6(n), true
+}
+
 // defaultFont is used for new Displays.
 // It is GoRegular at DefaultSize for DefaultDPI.
 var defaultFont *Font
@@ -222,6 +555,7 @@ var defaultFont *Font
 func init() {
 	// DefaultFont is GoRegular which is built-in.
 	faceCache.m = make(map[FaceID]font.Face)
+	faceCache.files = make(map[string]*fontFile)
 	id := FaceID{
 		Name: "",
 		Size: DefaultFontSize,
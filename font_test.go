@@ -1,6 +1,17 @@
 package duitdraw
 
-import "testing"
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
 
 func TestStringWidth(t *testing.T) {
 	tt := []string{
@@ -20,3 +31,196 @@ func TestStringWidth(t *testing.T) {
 		}
 	}
 }
+
+func TestStringNWidth(t *testing.T) {
+	s := "Hello, 世界"
+	for _, n := range []int{-1, 0, 3, 8, 9, 20} {
+		exp := defaultFont.StringWidth(stringN(s, n))
+		if got := defaultFont.StringNWidth(s, n); got != exp {
+			t.Errorf("StringNWidth(%q, %d) is %v; expected %v", s, n, got, exp)
+		}
+		if got := defaultFont.BytesNWidth([]byte(s), n); got != exp {
+			t.Errorf("BytesNWidth(%q, %d) is %v; expected %v", s, n, got, exp)
+		}
+		if got := defaultFont.RunesNWidth([]rune(s), n); got != exp {
+			t.Errorf("RunesNWidth(%q, %d) is %v; expected %v", s, n, got, exp)
+		}
+	}
+	if got, exp := (*defaultFont).StringSize(s), defaultFont.StringSize(s); got != exp {
+		t.Errorf("StringSize of a Font value is %v; expected %v", got, exp)
+	}
+}
+
+func TestStringBg(t *testing.T) {
+	var d Display
+	dst := d.MakeImage(image.NewRGBA(image.Rect(0, 0, 200, 50)))
+	black, _ := d.AllocImage(image.Rect(0, 0, 1, 1), 0, true, Black)
+	bg, _ := d.AllocImage(image.Rect(0, 0, 1, 1), 0, true, Paleyellow)
+
+	s := "Hello world!"
+	pt := image.Pt(10, 10)
+	p := dst.StringBg(pt, black, image.ZP, defaultFont, s, bg, image.ZP)
+	if want := pt.Add(image.Pt(defaultFont.StringWidth(s), 0)); p != want {
+		t.Errorf("StringBg returned %v; expected %v", p, want)
+	}
+	m := dst.m.(*image.RGBA)
+	if c := m.RGBAAt(pt.X, pt.Y); c != Paleyellow.rgba() {
+		t.Errorf("background at %v is %v; expected %v", pt, c, Paleyellow.rgba())
+	}
+	if c := m.RGBAAt(p.X, pt.Y); c == Paleyellow.rgba() {
+		t.Errorf("background extends beyond the string at %v", p)
+	}
+
+	p = dst.StringN(pt, black, image.ZP, defaultFont, s, 5)
+	if want := pt.Add(image.Pt(defaultFont.StringWidth("Hello"), 0)); p != want {
+		t.Errorf("StringN returned %v; expected %v", p, want)
+	}
+	p = dst.RunesN(pt, black, image.ZP, defaultFont, []rune(s), 5)
+	if want := pt.Add(image.Pt(defaultFont.StringWidth("Hello"), 0)); p != want {
+		t.Errorf("RunesN returned %v; expected %v", p, want)
+	}
+}
+
+func TestKernStringWidth(t *testing.T) {
+	d := Display{DPI: DefaultDPI}
+	f, err := d.OpenFont("@13pt,kern")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.Kern || f.Size != 13 {
+		t.Fatalf("OpenFont returned %+v; expected Kern at 13pt", f.FaceID)
+	}
+	dst := d.MakeImage(image.NewRGBA(image.Rect(0, 0, 600, 50)))
+	black, _ := d.AllocImage(image.Rect(0, 0, 1, 1), 0, true, Black)
+	for _, s := range []string{
+		"AVAVAV To Wa Ty",
+		"I can eat glass and it doesn't hurt me.",
+		"iiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiii",
+	} {
+		p := dst.String(image.Pt(1, 1), black, image.ZP, f, s)
+		if dx := f.StringWidth(s); p.X-1 != dx {
+			t.Errorf("String(%q) advanced by %v; StringWidth is %v", s, p.X-1, dx)
+		}
+	}
+	if _, err := d.OpenFont("@13pt,bold"); err == nil {
+		t.Errorf("OpenFont accepted an unknown option")
+	}
+}
+
+func TestFontOptions(t *testing.T) {
+	d := Display{DPI: DefaultDPI}
+	f, err := d.OpenFont("@11pt,noaa,hint=full,gamma=1.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := FontOptions{NoAA: true, Hinting: font.HintingFull, Gamma: 1.5}
+	if f.FontOptions != want {
+		t.Errorf("font options are %+v; expected %+v", f.FontOptions, want)
+	}
+	_, mask, _, _, ok := f.glyph(fixed.Point26_6{}, 'g')
+	if !ok {
+		t.Fatal("no glyph for 'g'")
+	}
+	for _, a := range mask.(*image.Alpha).Pix {
+		if a != 0 && a != 0xff {
+			t.Fatalf("glyph mask of an aliased font has coverage %d", a)
+		}
+	}
+
+	g, err := d.OpenFontOptions("@11pt", FontOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.face == g.face {
+		t.Errorf("fonts with different options share the same face")
+	}
+	for _, name := range []string{"@11pt,hint=some", "@11pt,gamma=x", "@11pt,gamma=-1"} {
+		if _, err := d.OpenFont(name); err == nil {
+			t.Errorf("OpenFont(%q) succeeded; expected an error", name)
+		}
+	}
+}
+
+// WritePlan9Font writes a Plan 9 font with a single glyph for 'a',
+// which is a block of 4x6 pixels scaled by k.
+func writePlan9Font(t *testing.T, dir, name string, k int) string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "compressed\n%11s %11d %11d %11d %11d ", "k1", 0, 0, 4*k, 6*k)
+	fmt.Fprintf(&b, "%11d %11d ", 6*k, 2*6*k)
+	for y := 0; y < 6*k; y++ {
+		b.Write([]byte{0x80, byte(0xff) << uint(8-4*k)})
+	}
+	fmt.Fprintf(&b, "%11d %11d %11d ", 1, 6*k, 5*k)
+	b.Write([]byte{0, 0, 0, byte(6 * k), 0, byte(5 * k)})
+	b.Write([]byte{byte(4 * k), 0, 0, 0, 0, 0})
+	if err := ioutil.WriteFile(filepath.Join(dir, name+".subfont"), b.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(dir, name+".font")
+	data := fmt.Sprintf("%d %d\n0x61 0x61 0 %s.subfont\n", 6*k, 5*k, name)
+	if err := ioutil.WriteFile(file, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestPlan9FontDPI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "duitdraw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	lo := writePlan9Font(t, dir, "lo", 1)
+	hi := writePlan9Font(t, dir, "hi", 2)
+
+	// Count the pixels of a drawn string.
+	pixels := func(f *Font, s string) int {
+		d := Display{DPI: DefaultDPI}
+		dst := d.MakeImage(image.NewRGBA(image.Rect(0, 0, 40, 40)))
+		black, _ := d.AllocImage(image.Rect(0, 0, 1, 1), 0, true, Black)
+		dst.String(image.ZP, black, image.ZP, f, s)
+		n := 0
+		pix := dst.m.(*image.RGBA).Pix
+		for i := 3; i < len(pix); i += 4 {
+			if pix[i] != 0 {
+				n++
+			}
+		}
+		return n
+	}
+
+	tt := []struct {
+		name          string
+		dpi           int
+		height, width int
+	}{
+		{lo, DefaultDPI, 6, 10},
+		{lo, 2 * DefaultDPI, 12, 20},
+		{lo + "," + hi, DefaultDPI, 6, 10},
+		{lo + "," + hi, 2 * DefaultDPI, 12, 20},
+	}
+	for _, tc := range tt {
+		d := Display{DPI: tc.dpi}
+		f, err := d.OpenFont(tc.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Height != tc.height || f.StringWidth("aa") != tc.width {
+			t.Errorf("%s at %d dpi: expected height %d and width %d, got %d and %d",
+				tc.name, tc.dpi, tc.height, tc.width, f.Height, f.StringWidth("aa"))
+		}
+		if n, exp := pixels(f, "a"), 4*6*tc.height*tc.height/36; n != exp {
+			t.Errorf("%s at %d dpi: expected %d pixels got %d", tc.name, tc.dpi, exp, n)
+		}
+	}
+
+	d := Display{DPI: DefaultDPI}
+	f, err := d.OpenFont(lo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g := f.SetDPI(2 * DefaultDPI); g == f || g.Height != 12 {
+		t.Errorf("SetDPI did not rescale the Plan 9 font")
+	}
+}
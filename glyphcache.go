@@ -0,0 +1,279 @@
+package duitdraw
+
+import (
+	"container/list"
+	"image"
+	"image/draw"
+	"sync"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/math/fixed"
+)
+
+// DefaultGlyphCacheSize is the initial number of entries in the glyph cache.
+const DefaultGlyphCacheSize = 8192
+
+// GlyphCache stores rendered glyph masks and advances for all fonts.
+// It is shared by all Displays and bounded by evicting the least recently
+// used entries.
+type glyphCache struct {
+	sync.Mutex
+	max int
+	lru *list.List // Front is the most recently used entry.
+	m   map[interface{}]*list.Element
+}
+
+var glyphs = glyphCache{
+	max: DefaultGlyphCacheSize,
+	lru: list.New(),
+	m:   make(map[interface{}]*list.Element),
+}
+
+type glyphEntry struct {
+	key   interface{}
+	value interface{}
+}
+
+// GlyphKey identifies a glyph mask.
+// Frac is the sub-pixel part of the dot the glyph is drawn at.
+type glyphKey struct {
+	id   FaceID
+	r    rune
+	frac fixed.Point26_6
+}
+
+// AdvanceKey identifies a glyph advance.
+type advanceKey struct {
+	id FaceID
+	r  rune
+}
+
+// KernKey identifies the kerning of a rune pair.
+type kernKey struct {
+	id     FaceID
+	r0, r1 rune
+}
+
+// IndexKey identifies the mask of a glyph drawn by its index in the font file.
+type indexKey struct {
+	id   FaceID
+	g    uint16
+	frac fixed.Point26_6
+}
+
+// IndexAdvanceKey identifies the advance of a glyph by its index.
+type indexAdvanceKey struct {
+	id FaceID
+	g  uint16
+}
+
+// Glyph is a rendered glyph mask with a rectangle relative to the integer dot.
+type glyph struct {
+	dr      image.Rectangle
+	mask    *image.Alpha
+	advance fixed.Int26_6
+	ok      bool
+}
+
+type advance struct {
+	advance fixed.Int26_6
+	ok      bool
+}
+
+// SetGlyphCacheSize sets the maximum number of cached glyph masks and
+// advances. A size of 0 or less disables the cache.
+func SetGlyphCacheSize(n int) {
+	if n < 0 {
+		n = 0
+	}
+	glyphs.Lock()
+	defer glyphs.Unlock()
+	glyphs.max = n
+	glyphs.evict()
+}
+
+func (c *glyphCache) get(key interface{}) (interface{}, bool) {
+	if e, ok := c.m[key]; ok {
+		c.lru.MoveToFront(e)
+		return e.Value.(*glyphEntry).value, true
+	}
+	return nil, false
+}
+
+func (c *glyphCache) put(key, value interface{}) {
+	if e, ok := c.m[key]; ok {
+		e.Value.(*glyphEntry).value = value
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.m[key] = c.lru.PushFront(&glyphEntry{key, value})
+	c.evict()
+}
+
+func (c *glyphCache) evict() {
+	for c.lru.Len() > c.max {
+		e := c.lru.Back()
+		c.lru.Remove(e)
+		delete(c.m, e.Value.(*glyphEntry).key)
+	}
+}
+
+// Purge removes all entries of the face id.
+func (c *glyphCache) purge(id FaceID) {
+	c.Lock()
+	defer c.Unlock()
+	for e := c.lru.Front(); e != nil; {
+		next := e.Next()
+		var eid FaceID
+		switch k := e.Value.(*glyphEntry).key.(type) {
+		case glyphKey:
+			eid = k.id
+		case advanceKey:
+			eid = k.id
+		case kernKey:
+			eid = k.id
+		case colorKey:
+			eid = k.id
+		case indexKey:
+			eid = k.id
+		case indexAdvanceKey:
+			eid = k.id
+		}
+		if eid == id {
+			c.lru.Remove(e)
+			delete(c.m, e.Value.(*glyphEntry).key)
+		}
+		e = next
+	}
+}
+
+// SubpixelMask quantizes the horizontal sub-pixel position of glyphs to
+// a quarter pixel, which limits the number of masks per glyph to 4.
+const subpixelMask = 63 &^ 15
+
+// Glyph returns the glyph for r drawn at dot, like font.Face.Glyph.
+// The mask is rendered once for each sub-pixel position and cached.
+func (f *Font) glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	ip := image.Point{dot.X.Floor(), dot.Y.Floor()}
+	key := glyphKey{
+		id:   f.FaceID,
+		r:    r,
+		frac: fixed.Point26_6{X: dot.X & subpixelMask, Y: dot.Y & 63},
+	}
+
+	glyphs.Lock()
+	defer glyphs.Unlock()
+	if v, ok := glyphs.get(key); ok {
+		g := v.(*glyph)
+		return g.dr.Add(ip), g.mask, g.dr.Min, g.advance, g.ok
+	}
+
+	// The face may reuse its mask buffer for the next call, so we copy it.
+	var g glyph
+	var mask image.Image
+	var maskp image.Point
+	if !f.bitmapOnly() {
+		g.dr, mask, maskp, g.advance, g.ok = f.face.Glyph(key.frac, r)
+	}
+	if g.ok {
+		g.mask = image.NewAlpha(g.dr)
+		draw.Draw(g.mask, g.dr, mask, maskp, draw.Src)
+	}
+	if glyphs.max > 0 {
+		glyphs.put(key, &g)
+	}
+	return g.dr.Add(ip), g.mask, g.dr.Min, g.advance, g.ok
+}
+
+// Advance returns the cached glyph advance for r.
+func (f *Font) advance(r rune) (fixed.Int26_6, bool) {
+	key := advanceKey{id: f.FaceID, r: r}
+
+	glyphs.Lock()
+	defer glyphs.Unlock()
+	if v, ok := glyphs.get(key); ok {
+		a := v.(advance)
+		return a.advance, a.ok
+	}
+
+	var a advance
+	if f.bitmapOnly() {
+		a.advance, a.ok = f.colorAdvance(r)
+	} else {
+		a.advance, a.ok = f.face.GlyphAdvance(r)
+	}
+	if glyphs.max > 0 {
+		glyphs.put(key, a)
+	}
+	return a.advance, a.ok
+}
+
+// Kern returns the cached kerning adjustment for the rune pair.
+func (f *Font) kern(r0, r1 rune) fixed.Int26_6 {
+	key := kernKey{id: f.FaceID, r0: r0, r1: r1}
+
+	glyphs.Lock()
+	defer glyphs.Unlock()
+	if v, ok := glyphs.get(key); ok {
+		return v.(fixed.Int26_6)
+	}
+
+	k := f.face.Kern(r0, r1)
+	if glyphs.max > 0 {
+		glyphs.put(key, k)
+	}
+	return k
+}
+
+// IndexGlyph returns the mask of the glyph with index g drawn at dot.
+// It draws glyphs which the shaper substituted, as the face only
+// draws glyphs for runes.
+func (f *Font) indexGlyph(dot fixed.Point26_6, g uint16) (image.Rectangle, image.Image, image.Point, bool) {
+	ip := image.Point{dot.X.Floor(), dot.Y.Floor()}
+	key := indexKey{
+		id:   f.FaceID,
+		g:    g,
+		frac: fixed.Point26_6{X: dot.X & subpixelMask, Y: dot.Y & 63},
+	}
+
+	glyphs.Lock()
+	defer glyphs.Unlock()
+	if v, ok := glyphs.get(key); ok {
+		m := v.(*glyph)
+		return m.dr.Add(ip), m.mask, m.dr.Min, m.ok
+	}
+
+	var m glyph
+	if f.file != nil && !f.bitmapOnly() {
+		m.dr, m.mask, m.ok = f.renderIndex(g, key.frac)
+	}
+	if glyphs.max > 0 {
+		glyphs.put(key, &m)
+	}
+	return m.dr.Add(ip), m.mask, m.dr.Min, m.ok
+}
+
+// IndexAdvance returns the cached advance of the glyph with index g.
+// Without Kern, it is rounded to full pixels like the advances of runes.
+func (f *Font) indexAdvance(g uint16) fixed.Int26_6 {
+	key := indexAdvanceKey{id: f.FaceID, g: g}
+
+	glyphs.Lock()
+	defer glyphs.Unlock()
+	if v, ok := glyphs.get(key); ok {
+		return v.(fixed.Int26_6)
+	}
+
+	var a fixed.Int26_6
+	var buf truetype.GlyphBuf
+	if f.file != nil && buf.Load(f.file.ttf, f.scale(), truetype.Index(g), f.Hinting) == nil {
+		a = buf.AdvanceWidth
+		if !f.Kern {
+			a = fixed.I(a.Round())
+		}
+	}
+	if glyphs.max > 0 {
+		glyphs.put(key, a)
+	}
+	return a
+}
@@ -0,0 +1,53 @@
+package duitdraw
+
+import (
+	"bytes"
+	"image"
+	"testing"
+)
+
+func TestGlyphCacheEvict(t *testing.T) {
+	defer SetGlyphCacheSize(DefaultGlyphCacheSize)
+	SetGlyphCacheSize(4)
+	for _, c := range "abcdefgh" {
+		defaultFont.advance(c)
+	}
+	if n := glyphs.lru.Len(); n != 4 {
+		t.Errorf("glyph cache has %d entries; expected 4", n)
+	}
+	if _, ok := glyphs.m[advanceKey{defaultFont.FaceID, 'a'}]; ok {
+		t.Errorf("least recently used entry has not been evicted")
+	}
+	if _, ok := glyphs.m[advanceKey{defaultFont.FaceID, 'h'}]; !ok {
+		t.Errorf("most recently used entry is missing")
+	}
+}
+
+func TestGlyphCacheString(t *testing.T) {
+	defer SetGlyphCacheSize(DefaultGlyphCacheSize)
+	draw := func() []byte {
+		var d Display
+		dst := d.MakeImage(image.NewRGBA(image.Rect(0, 0, 200, 50)))
+		black, _ := d.AllocImage(image.Rect(0, 0, 1, 1), 0, true, Black)
+		dst.String(image.Pt(3, 7), black, image.ZP, defaultFont, "Hello, glyph cache!")
+		return dst.m.(*image.RGBA).Pix
+	}
+
+	SetGlyphCacheSize(0)
+	uncached := draw()
+	SetGlyphCacheSize(DefaultGlyphCacheSize)
+	draw() // fill the cache
+	if cached := draw(); !bytes.Equal(cached, uncached) {
+		t.Errorf("cached glyphs differ from uncached glyphs")
+	}
+}
+
+func TestGlyphCacheNegativeSize(t *testing.T) {
+	defer SetGlyphCacheSize(DefaultGlyphCacheSize)
+	defaultFont.advance('a')
+	SetGlyphCacheSize(-1)
+	defaultFont.advance('b')
+	if n := glyphs.lru.Len(); n != 0 {
+		t.Errorf("glyph cache has %d entries; expected 0", n)
+	}
+}
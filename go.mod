@@ -5,7 +5,6 @@ go 1.11
 require (
         github.com/BurntSushi/xgb v0.0.0-20160522181843-27f122750802
         github.com/as/cursor v0.6.7
-        github.com/as/ms v0.1.0
         github.com/atotto/clipboard v0.1.4
         github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0
         github.com/ktye/duitdraw v0.0.0-20190328070634-a54e9bd5a862
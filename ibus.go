@@ -0,0 +1,197 @@
+package duitdraw
+
+import (
+	"bufio"
+	"errors"
+	"image"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/mobile/event/key"
+)
+
+// IBus is an input method which uses the IBus daemon.
+// Fcitx5 provides the same interface with its IBus frontend.
+type ibus struct {
+	conn *dbusConn
+	ic   string            // Path of the input context.
+	send func(interface{}) // Sends events to the window.
+}
+
+const (
+	ibusService      = "org.freedesktop.IBus"
+	ibusInputContext = "org.freedesktop.IBus.InputContext"
+
+	ibusCapPreeditText = 1 << 0
+	ibusCapFocus       = 1 << 3
+	ibusReleaseMask    = 1 << 30
+)
+
+// IbusKeyTimeout is the time the event loop waits for the input method
+// to process a key. If it does not answer in time, the key is handled
+// as if there was no input method.
+const ibusKeyTimeout = 100 * time.Millisecond
+
+// IbusAddress returns the address of the IBus daemon from the environment,
+// or from the file which the daemon writes for the X display.
+func ibusAddress() (string, error) {
+	if addr := os.Getenv("IBUS_ADDRESS"); addr != "" {
+		return addr, nil
+	}
+	display := os.Getenv("DISPLAY")
+	if display == "" {
+		return "", errors.New("ibus: DISPLAY is not set")
+	}
+	host := "unix"
+	if i := strings.LastIndex(display, ":"); i > 0 {
+		host, display = display[:i], display[i+1:]
+	} else {
+		display = strings.TrimPrefix(display, ":")
+	}
+	if i := strings.Index(display, "."); i >= 0 {
+		display = display[:i]
+	}
+	var id []byte
+	var err error
+	for _, name := range []string{"/var/lib/dbus/machine-id", "/etc/machine-id"} {
+		if id, err = ioutil.ReadFile(name); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		dir = filepath.Join(os.Getenv("HOME"), ".config")
+	}
+	name := filepath.Join(dir, "ibus", "bus", strings.TrimSpace(string(id))+"-"+host+"-"+display)
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if line := s.Text(); strings.HasPrefix(line, "IBUS_ADDRESS=") {
+			return line[len("IBUS_ADDRESS="):], nil
+		}
+	}
+	return "", errors.New("ibus: no address in " + name)
+}
+
+// NewIBus creates an input context on the IBus connection c.
+// The events of the input method are passed to send.
+func newIBus(c net.Conn, send func(interface{})) (*ibus, error) {
+	im := &ibus{send: send}
+	var err error
+	if im.conn, err = newDBusConn(c, im.signal); err != nil {
+		return nil, err
+	}
+	r, err := im.conn.call(ibusService, "/org/freedesktop/IBus", ibusService, "CreateInputContext", "s", "duitdraw")
+	if err != nil {
+		im.conn.close()
+		return nil, err
+	}
+	if len(r) != 1 {
+		im.conn.close()
+		return nil, errors.New("ibus: CreateInputContext: no input context")
+	}
+	im.ic, _ = r[0].(string)
+	im.conn.callNoReply("org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "AddMatch", "s",
+		"type='signal',interface='"+ibusInputContext+"',path='"+im.ic+"'")
+	im.call("SetCapabilities", "u", uint32(ibusCapPreeditText|ibusCapFocus))
+	return im, nil
+}
+
+func (im *ibus) call(member, sig string, args ...interface{}) {
+	im.conn.callNoReply(ibusService, im.ic, ibusInputContext, member, sig, args...)
+}
+
+// ProcessKey passes a key event to the input method and waits for the answer,
+// at most for ibusKeyTimeout.
+func (im *ibus) processKey(e key.Event) bool {
+	sym := keysym(e)
+	if sym == 0 {
+		return false
+	}
+	state := keyState(e)
+	if e.Direction == key.DirRelease {
+		state |= ibusReleaseMask
+	}
+	r, err := im.conn.callTimeout(ibusKeyTimeout, ibusService, im.ic, ibusInputContext, "ProcessKeyEvent", "uuu", sym, uint32(0), state)
+	if err != nil || len(r) != 1 {
+		return false
+	}
+	handled, _ := r[0].(bool)
+	return handled
+}
+
+func (im *ibus) setCursorLocation(r image.Rectangle) {
+	im.call("SetCursorLocation", "iiii", int32(r.Min.X), int32(r.Min.Y), int32(r.Dx()), int32(r.Dy()))
+}
+
+func (im *ibus) focus(in bool) {
+	if in {
+		im.call("FocusIn", "")
+	} else {
+		im.call("FocusOut", "")
+	}
+}
+
+func (im *ibus) close() {
+	im.conn.callNoReply(ibusService, im.ic, "org.freedesktop.IBus.Service", "Destroy", "")
+	im.conn.close()
+}
+
+// Signal is called by the D-Bus connection for signals of the input context.
+func (im *ibus) signal(m *dbusMessage) {
+	if m.path != im.ic || m.iface != ibusInputContext {
+		return
+	}
+	switch m.member {
+	case "CommitText":
+		if len(m.body) > 0 {
+			im.send(imeCommit{ibusText(m.body[0])})
+		}
+	case "UpdatePreeditText":
+		if len(m.body) < 3 {
+			return
+		}
+		text := ibusText(m.body[0])
+		cursor, _ := m.body[1].(uint32)
+		if visible, _ := m.body[2].(bool); !visible {
+			text, cursor = "", 0
+		}
+		im.send(imePreedit{text, int(cursor)})
+	case "HidePreeditText":
+		im.send(imePreedit{})
+	case "ForwardKeyEvent":
+		// The input method passes on a key which it does not use.
+		if len(m.body) < 3 {
+			return
+		}
+		sym, _ := m.body[0].(uint32)
+		state, _ := m.body[2].(uint32)
+		if r := keysymRune(sym); r != -1 && state&ibusReleaseMask == 0 {
+			im.send(imeCommit{string(r)})
+		}
+	}
+}
+
+// IbusText returns the string of an IBusText variant,
+// which is a struct of the type name, attachments, the text and attributes.
+func ibusText(v interface{}) string {
+	if vv, ok := v.(dbusVariant); ok {
+		v = vv.value
+	}
+	if s, ok := v.([]interface{}); ok && len(s) > 2 {
+		text, _ := s[2].(string)
+		return text
+	}
+	return ""
+}
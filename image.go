@@ -8,7 +8,6 @@ import (
 	"sync"
 
 	"golang.org/x/exp/shiny/imageutil"
-	"golang.org/x/image/font"
 	"golang.org/x/image/math/fixed"
 )
 
@@ -94,7 +93,7 @@ func (dst *Image) Load(r image.Rectangle, data []byte) (int, error) {
 	if len(data) != 4*w*h {
 		return 0, fmt.Errorf("image Load: wrong data size")
 	}
-	m := &image.RGBA{data, 4 * w, r}
+	m := &image.RGBA{Pix: data, Stride: 4 * w, Rect: r}
 
 	dst.R = r
 	dst.m = m
@@ -103,32 +102,143 @@ func (dst *Image) Load(r image.Rectangle, data []byte) (int, error) {
 	return len(data), nil
 }
 
+// String draws the string in the specified font using SoverD on the image,
+// placing the upper left corner at p. It returns the point just after the
+// last character.
+func (dst *Image) String(pt image.Point, src *Image, sp image.Point, f *Font, s string) image.Point {
+	return dst.string(pt, src, sp, f, s, nil, image.ZP, SoverD)
+}
+
+// StringOp draws the string in the specified font using the specified
+// operation on the image, placing the upper left corner at p.
+func (dst *Image) StringOp(pt image.Point, src *Image, sp image.Point, f *Font, s string, op Op) image.Point {
+	return dst.string(pt, src, sp, f, s, nil, image.ZP, op)
+}
+
+// StringN is like String, but draws at most n runes of s.
+func (dst *Image) StringN(pt image.Point, src *Image, sp image.Point, f *Font, s string, n int) image.Point {
+	return dst.string(pt, src, sp, f, stringN(s, n), nil, image.ZP, SoverD)
+}
+
+// StringBg draws the string in the specified font using SoverD on the image,
+// placing the upper left corner at p. It first fills the background with
+// bg, aligned so bgp corresponds to p.
+func (dst *Image) StringBg(pt image.Point, src *Image, sp image.Point, f *Font, s string, bg *Image, bgp image.Point) image.Point {
+	return dst.string(pt, src, sp, f, s, bg, bgp, SoverD)
+}
+
+// StringBgOp is like StringBg, but uses the specified operation.
+func (dst *Image) StringBgOp(pt image.Point, src *Image, sp image.Point, f *Font, s string, bg *Image, bgp image.Point, op Op) image.Point {
+	return dst.string(pt, src, sp, f, s, bg, bgp, op)
+}
+
+// Runes draws the rune slice in the specified font using SoverD on the
+// image, placing the upper left corner at p.
+func (dst *Image) Runes(pt image.Point, src *Image, sp image.Point, f *Font, r []rune) image.Point {
+	return dst.string(pt, src, sp, f, string(r), nil, image.ZP, SoverD)
+}
+
+// RunesOp is like Runes, but uses the specified operation.
+func (dst *Image) RunesOp(pt image.Point, src *Image, sp image.Point, f *Font, r []rune, op Op) image.Point {
+	return dst.string(pt, src, sp, f, string(r), nil, image.ZP, op)
+}
+
+// RunesN is like Runes, but draws at most n runes of r.
+func (dst *Image) RunesN(pt image.Point, src *Image, sp image.Point, f *Font, r []rune, n int) image.Point {
+	if n >= 0 && n < len(r) {
+		r = r[:n]
+	}
+	return dst.string(pt, src, sp, f, string(r), nil, image.ZP, SoverD)
+}
+
+// RunesBg is like StringBg, but draws a rune slice.
+func (dst *Image) RunesBg(pt image.Point, src *Image, sp image.Point, f *Font, r []rune, bg *Image, bgp image.Point) image.Point {
+	return dst.string(pt, src, sp, f, string(r), bg, bgp, SoverD)
+}
+
+// RunesBgOp is like StringBgOp, but draws a rune slice.
+func (dst *Image) RunesBgOp(pt image.Point, src *Image, sp image.Point, f *Font, r []rune, bg *Image, bgp image.Point, op Op) image.Point {
+	return dst.string(pt, src, sp, f, string(r), bg, bgp, op)
+}
+
+// Bytes draws the byte slice in the specified font using SoverD on the
+// image, placing the upper left corner at p.
 func (dst *Image) Bytes(pt image.Point, src *Image, sp image.Point, f *Font, b []byte) image.Point {
-	return dst.String(pt, src, sp, f, string(b))
+	return dst.string(pt, src, sp, f, string(b), nil, image.ZP, SoverD)
 }
 
-// String draws the string in the specified font using SoverD on the image,
-// placing the upper left corner at p.
-func (dst *Image) String(pt image.Point, src *Image, sp image.Point, f *Font, s string) image.Point {
+// BytesOp is like Bytes, but uses the specified operation.
+func (dst *Image) BytesOp(pt image.Point, src *Image, sp image.Point, f *Font, b []byte, op Op) image.Point {
+	return dst.string(pt, src, sp, f, string(b), nil, image.ZP, op)
+}
+
+// BytesN is like Bytes, but draws at most n runes of b.
+func (dst *Image) BytesN(pt image.Point, src *Image, sp image.Point, f *Font, b []byte, n int) image.Point {
+	return dst.string(pt, src, sp, f, stringN(string(b), n), nil, image.ZP, SoverD)
+}
+
+// BytesBg is like StringBg, but draws a byte slice.
+func (dst *Image) BytesBg(pt image.Point, src *Image, sp image.Point, f *Font, b []byte, bg *Image, bgp image.Point) image.Point {
+	return dst.string(pt, src, sp, f, string(b), bg, bgp, SoverD)
+}
+
+// BytesBgOp is like StringBgOp, but draws a byte slice.
+func (dst *Image) BytesBgOp(pt image.Point, src *Image, sp image.Point, f *Font, b []byte, bg *Image, bgp image.Point, op Op) image.Point {
+	return dst.string(pt, src, sp, f, string(b), bg, bgp, op)
+}
+
+// string is the common implementation of all text drawing functions.
+// If bg is not nil, the rectangle covered by the text is filled with bg first.
+func (dst *Image) string(pt image.Point, src *Image, sp image.Point, f *Font, s string, bg *Image, bgp image.Point, op Op) image.Point {
 	dst.Lock()
 	defer dst.Unlock()
 
 	m := dst.m.(*image.RGBA)
+	type placed struct {
+		g Glyph
+		x fixed.Int26_6
+	}
+	var gs []placed
+	dx := f.layout(s, func(g Glyph, x fixed.Int26_6) {
+		gs = append(gs, placed{g, x})
+	}).Round()
+	if bg != nil {
+		r := image.Rectangle{pt, pt.Add(image.Point{dx, f.Height})}
+		op.draw(m, r, bg.m, bgp, nil, image.ZP)
+	}
+
 	ascent := f.face.Metrics().Ascent
 	dot := fixed.P(pt.X, pt.Y).Add(fixed.Point26_6{Y: ascent})
-
-	drawer := font.Drawer{
-		Dst:  m,
-		Src:  src.m,
-		Face: f.face,
-		Dot:  dot,
+	fg := color.RGBAModel.Convert(src.m.At(sp.X, sp.Y)).(color.RGBA)
+	for _, p := range gs {
+		g := p.g.Font
+		dot := dot.Add(fixed.Point26_6{X: p.x}).Add(p.g.Offset)
+		if p.g.Rune < 0 {
+			if dr, mask, maskp, ok := g.indexGlyph(dot, uint16(p.g.Index)); ok {
+				op.draw(m, dr, src.m, sp.Add(dr.Min.Sub(pt)), mask, maskp)
+			}
+		} else if dr, cm, cp, ok := g.colorGlyph(dot, p.g.Rune, fg); ok {
+			op.draw(m, dr, cm, cp, nil, image.ZP)
+		} else if dr, mask, maskp, _, ok := g.glyph(dot, p.g.Rune); ok {
+			op.draw(m, dr, src.m, sp.Add(dr.Min.Sub(pt)), mask, maskp)
+		}
 	}
-	drawer.DrawString(s)
-	dx := int(drawer.Dot.Sub(dot).X / 64)
-	ret := pt.Add(image.Point{dx, 0})
+	return pt.Add(image.Point{dx, 0})
+}
 
-	// fmt.Printf("shiny: String(%s) to %p at %d,%d => %d %d\n", s, m, pt.X, pt.Y, ret.X, ret.Y) // TODO remove
-	return ret
+// stringN returns the prefix of s containing at most n runes.
+func stringN(s string, n int) string {
+	if n < 0 {
+		return s
+	}
+	i := 0
+	for k := range s {
+		if i == n {
+			return s[:k]
+		}
+		i++
+	}
+	return s
 }
 
 // Line draws a line in the source color from p0 to p1, of thickness
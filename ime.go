@@ -0,0 +1,127 @@
+package duitdraw
+
+import (
+	"image"
+
+	"golang.org/x/mobile/event/key"
+)
+
+// InputMethod composes text from key events, e.g. for Chinese and Japanese.
+// The implementation sends imeCommit and imePreedit to the window's event loop.
+type inputMethod interface {
+	processKey(e key.Event) bool // Reports if the key was used by the input method.
+	setCursorLocation(r image.Rectangle)
+	focus(in bool)
+	close()
+}
+
+// ImeCommit is text from the input method, which is sent on Keyboardctl.C.
+type imeCommit struct {
+	text string
+}
+
+// ImePreedit is the text which is being composed by the input method.
+type imePreedit struct {
+	text   string
+	cursor int // Cursor position in runes.
+}
+
+// SetCaret tells the input method the position of the text cursor in window
+// coordinates, so it can show its candidate window next to it.
+// While text is composed, Display.Preedit is called from the event loop with
+// the text and the cursor position in runes, and with "" when it is done.
+// The committed text is sent on Keyboardctl.C.
+// Input methods are used on X11 with IBus or Fcitx5, if the environment
+// variable DUITDRAW_IME is set to ibus.
+// This method is not present in 9fans draw package.
+func (d *Display) SetCaret(r image.Rectangle) {
+	if d.ime == nil {
+		return
+	}
+	if o, ok := windowOrigin(d.window); ok {
+		d.ime.setCursorLocation(r.Add(o))
+	}
+}
+
+// KeyKeysyms maps key codes without a rune to X keysyms,
+// which are used by input methods.
+var keyKeysyms = map[key.Code]uint32{
+	key.CodeReturnEnter:     0xff0d,
+	key.CodeDeleteBackspace: 0xff08,
+	key.CodeTab:             0xff09,
+	key.CodeEscape:          0xff1b,
+	key.CodeDeleteForward:   0xffff,
+	key.CodeHome:            0xff50,
+	key.CodeLeftArrow:       0xff51,
+	key.CodeUpArrow:         0xff52,
+	key.CodeRightArrow:      0xff53,
+	key.CodeDownArrow:       0xff54,
+	key.CodePageUp:          0xff55,
+	key.CodePageDown:        0xff56,
+	key.CodeEnd:             0xff57,
+	key.CodeInsert:          0xff63,
+	key.CodeKeypadEnter:     0xff8d,
+	key.CodeLeftShift:       0xffe1,
+	key.CodeRightShift:      0xffe2,
+	key.CodeLeftControl:     0xffe3,
+	key.CodeRightControl:    0xffe4,
+	key.CodeLeftAlt:         0xffe9,
+	key.CodeRightAlt:        0xffea,
+	key.CodeLeftGUI:         0xffeb,
+	key.CodeRightGUI:        0xffec,
+}
+
+// Keysym returns the X keysym of a key event, or 0.
+func keysym(e key.Event) uint32 {
+	if k, ok := keyKeysyms[e.Code]; ok {
+		return k
+	}
+	if key.CodeF1 <= e.Code && e.Code <= key.CodeF12 {
+		return 0xffbe + uint32(e.Code-key.CodeF1)
+	}
+	switch r := e.Rune; {
+	case r >= 0x20 && r < 0x7f || r >= 0xa0 && r < 0x100:
+		return uint32(r)
+	case r >= 0x100:
+		return 0x01000000 | uint32(r)
+	}
+	return 0
+}
+
+// KeysymRune returns the rune of an X keysym, as it is sent on Keyboardctl.C, or -1.
+func keysymRune(sym uint32) rune {
+	switch {
+	case sym >= 0x20 && sym < 0x7f || sym >= 0xa0 && sym < 0x100:
+		return rune(sym)
+	case sym&0xff000000 == 0x01000000:
+		return rune(sym & 0xffffff)
+	case sym >= 0xffbe && sym < 0xffbe+12:
+		return KeyF1 + rune(sym-0xffbe)
+	}
+	for c, k := range keyKeysyms {
+		if k == sym {
+			if r, ok := keymap[c]; ok && !isModifierKey(r) {
+				return r
+			}
+		}
+	}
+	return -1
+}
+
+// KeyState returns the X modifier state of a key event.
+func keyState(e key.Event) uint32 {
+	var s uint32
+	if e.Modifiers&key.ModShift != 0 {
+		s |= 1
+	}
+	if e.Modifiers&key.ModControl != 0 {
+		s |= 4
+	}
+	if e.Modifiers&key.ModAlt != 0 {
+		s |= 8
+	}
+	if e.Modifiers&key.ModMeta != 0 {
+		s |= 64
+	}
+	return s
+}
@@ -0,0 +1,187 @@
+package duitdraw
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/mobile/event/key"
+)
+
+func TestDBusMessage(t *testing.T) {
+	m := &dbusMessage{
+		typ:    dbusSignal,
+		serial: 7,
+		path:   "/a/b",
+		iface:  "x.y",
+		member: "Z",
+		sig:    "ybsvua{sv}(io)d",
+		body: []interface{}{
+			byte(3), true, "hello",
+			dbusVariant{"(sa{sv}sv)", []interface{}{"IBusText", []interface{}{}, "日本", dbusVariant{"u", uint32(1)}}},
+			uint32(42),
+			[]interface{}{[]interface{}{"k", dbusVariant{"x", int64(-1)}}},
+			[]interface{}{int32(-5), "/o"},
+			1.5,
+		},
+	}
+	b, err := m.marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := readDBusMessage(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, m) {
+		t.Errorf("expected %+v\ngot %+v", m, got)
+	}
+	if s := ibusText(got.body[3]); s != "日本" {
+		t.Errorf("ibus text: got %q", s)
+	}
+	if _, err := (&dbusMessage{sig: "s", body: []interface{}{1}}).marshal(); err == nil {
+		t.Error("expected error for wrong type")
+	}
+}
+
+// FakeIBus answers the calls of an IBus client on c.
+// Key a updates the preedit text, Return commits it.
+func fakeIBus(t *testing.T, c net.Conn, cursor chan<- []interface{}) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	if line, err := r.ReadString('\n'); err != nil || !strings.HasPrefix(line, "\x00AUTH EXTERNAL ") {
+		t.Errorf("auth: %q %v", line, err)
+		return
+	}
+	c.Write([]byte("OK 0123456789abcdef\r\n"))
+	if line, _ := r.ReadString('\n'); line != "BEGIN\r\n" {
+		t.Errorf("expected BEGIN got %q", line)
+		return
+	}
+	var serial uint32 = 100
+	write := func(m *dbusMessage) {
+		serial++
+		m.serial = serial
+		b, err := m.marshal()
+		if err != nil {
+			t.Error(err)
+		}
+		c.Write(b)
+	}
+	reply := func(m *dbusMessage, sig string, body ...interface{}) {
+		write(&dbusMessage{typ: dbusMethodReturn, replySerial: m.serial, sig: sig, body: body})
+	}
+	signal := func(member, sig string, body ...interface{}) {
+		write(&dbusMessage{typ: dbusSignal, path: "/ic/1", iface: ibusInputContext, member: member, sig: sig, body: body})
+	}
+	text := func(s string) dbusVariant {
+		return dbusVariant{"(sa{sv}sv)", []interface{}{"IBusText", []interface{}{}, s, dbusVariant{"u", uint32(0)}}}
+	}
+	for {
+		m, err := readDBusMessage(r)
+		if err != nil {
+			return
+		}
+		switch m.member {
+		case "Hello":
+			reply(m, "s", ":1.1")
+		case "CreateInputContext":
+			reply(m, "o", "/ic/1")
+		case "SetCursorLocation":
+			cursor <- m.body
+		case "ProcessKeyEvent":
+			switch m.body[0].(uint32) {
+			case 'a':
+				signal("UpdatePreeditText", "vub", text("あ"), uint32(1), true)
+				reply(m, "b", true)
+			case 0xff0d:
+				signal("CommitText", "v", text("亜"))
+				reply(m, "b", true)
+			case 'x':
+				// No reply, the key is handled after a timeout.
+			default:
+				reply(m, "b", false)
+			}
+		}
+	}
+}
+
+func TestIBus(t *testing.T) {
+	d, w, done := startEventLoop(t)
+	defer done()
+
+	client, server := net.Pipe()
+	cursor := make(chan []interface{}, 1)
+	go fakeIBus(t, server, cursor)
+	im, err := newIBus(client, w.Send)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer im.close()
+
+	preedit := make(chan string, 2)
+	d.Preedit = func(text string, cursor int) { preedit <- text }
+	d.ime = im
+
+	w.Send(key.Event{Rune: 'a', Code: key.CodeA, Direction: key.DirPress})
+	select {
+	case s := <-preedit:
+		if s != "あ" {
+			t.Errorf("expected preedit あ got %q", s)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no preedit")
+	}
+	w.Send(key.Event{Rune: '\r', Code: key.CodeReturnEnter, Direction: key.DirPress})
+	if r := <-d.keyboard.C; r != '亜' {
+		t.Errorf("expected commit 亜 got %q", r)
+	}
+	w.Send(key.Event{Rune: 'b', Code: key.CodeB, Direction: key.DirPress})
+	if r := <-d.keyboard.C; r != 'b' {
+		t.Errorf("unhandled key: expected b got %q", r)
+	}
+	w.Send(key.Event{Rune: 'x', Code: key.CodeX, Direction: key.DirPress})
+	select {
+	case r := <-d.keyboard.C:
+		if r != 'x' {
+			t.Errorf("key without reply: expected x got %q", r)
+		}
+	case <-time.After(time.Second):
+		t.Error("key without reply is not sent")
+	}
+
+	im.setCursorLocation(image.Rect(10, 20, 12, 36))
+	if c := <-cursor; !reflect.DeepEqual(c, []interface{}{int32(10), int32(20), int32(2), int32(16)}) {
+		t.Errorf("cursor location: got %v", c)
+	}
+}
+
+func TestKeysym(t *testing.T) {
+	tt := []struct {
+		e   key.Event
+		sym uint32
+		r   rune
+	}{
+		{key.Event{Rune: 'a', Code: key.CodeA}, 'a', 'a'},
+		{key.Event{Rune: 'é'}, 0xe9, 'é'},
+		{key.Event{Rune: '日'}, 0x010065e5, '日'},
+		{key.Event{Rune: '\r', Code: key.CodeReturnEnter}, 0xff0d, '\n'},
+		{key.Event{Rune: -1, Code: key.CodeLeftArrow}, 0xff51, KeyLeft},
+		{key.Event{Rune: -1, Code: key.CodeF2}, 0xffbf, KeyF2},
+		{key.Event{Rune: -1, Code: key.CodeLeftShift}, 0xffe1, -1},
+		{key.Event{Rune: 0}, 0, -1},
+	}
+	for _, tc := range tt {
+		if sym := keysym(tc.e); sym != tc.sym {
+			t.Errorf("%v: expected keysym %#x got %#x", tc.e, tc.sym, sym)
+		}
+		if r := keysymRune(tc.sym); r != tc.r {
+			t.Errorf("%#x: expected rune %#x got %#x", tc.sym, tc.r, r)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+// +build dragonfly freebsd linux netbsd openbsd solaris
+
+package duitdraw
+
+import "os"
+
+// StartIME connects to the IBus daemon, if DUITDRAW_IME is set to ibus
+// and the daemon is running.
+func startIME(d *Display) inputMethod {
+	if os.Getenv("DUITDRAW_IME") != "ibus" {
+		return nil
+	}
+	addr, err := ibusAddress()
+	if err != nil {
+		return nil
+	}
+	c, err := dialDBus(addr)
+	if err != nil {
+		return nil
+	}
+	im, err := newIBus(c, d.window.Send)
+	if err != nil {
+		return nil
+	}
+	im.focus(true)
+	return im
+}
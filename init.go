@@ -10,9 +10,11 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"golang.org/x/exp/shiny/driver"
 	"golang.org/x/exp/shiny/screen"
+	"golang.org/x/mobile/event/key"
 )
 
 // mainScreen stores the screen which is initialized for the first window.
@@ -113,7 +115,9 @@ func newDisplay(label, winsize, fontname string) (*Display, screen.NewWindowOpti
 	}
 
 	dpy := Display{
-		DPI: DefaultDPI,
+		DPI:         DefaultDPI,
+		ControlKeys: copyControlKeys(DefaultControlKeys),
+		start:       time.Now(),
 	}
 	dpy.Black = &Image{
 		Display: &dpy,
@@ -146,10 +150,23 @@ func newDisplay(label, winsize, fontname string) (*Display, screen.NewWindowOpti
 	} else {
 		dpy.DefaultFont = f
 	}
+	if name := os.Getenv(keymapEnv); name != "" {
+		if km, err := LoadKeymap(name); err != nil {
+			log.Print(err)
+		} else {
+			dpy.KeyTranslator = km
+		}
+	}
 	dpy.mouse.C = make(chan Mouse, 0)
 	dpy.mouse.Resize = make(chan bool, 2) // Why 2? (copied from InitMouse).
 	dpy.mouse.Display = &dpy
-	dpy.keyboard.C = make(chan rune, 20)
+	dpy.mouse.scroll = make(chan Scroll, 32)
+	dpy.mouse.queue.wake = make(chan struct{}, 1)
+	dpy.winEvents = make(chan WindowEvent, 16)
+	dpy.keyboard.C = make(chan rune, KeyboardBuffer)
+	dpy.keyboard.keys = make(chan Key, KeyboardBuffer)
+	dpy.keyboard.down = make(map[key.Code]bool)
+	dpy.keyboard.release = make(map[key.Code]Key)
 
 	return &dpy, opt
 }
@@ -174,6 +191,12 @@ func createWindow(d *Display, opt screen.NewWindowOptions, errch chan<- error) {
 
 	d.window = w
 	d.buffer = b
+	d.rescale(windowDPI(w))
+	watchWindow(d)
+	defer unwatchWindow(d)
+	if d.ime = startIME(d); d.ime != nil {
+		defer d.ime.close()
+	}
 	d.eventLoop(errch)
 }
 
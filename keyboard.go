@@ -1,34 +1,58 @@
 package duitdraw
 
-import "golang.org/x/mobile/event/key"
+import (
+	"sync/atomic"
+	"time"
 
-// Uncommented Key constants are defined for plan9 but not used by duit.
+	"golang.org/x/mobile/event/key"
+)
+
+// Key constants have the values of plan9port's keyboard.h.
+// KeyDown and KeyView share the same value, as in Plan 9.
 
 const (
 	KeyFn = '\uF000'
 
-	KeyHome   = KeyFn | 0x0D
-	KeyUp     = KeyFn | 0x0E
-	KeyPageUp = KeyFn | 0xF
-	//KeyPrint     = KeyFn | 0x10
-	KeyLeft  = KeyFn | 0x11
-	KeyRight = KeyFn | 0x12
-	KeyDown  = 0x80
-	//KeyView      = 0x80
-	KeyPageDown = KeyFn | 0x13
-	KeyInsert   = KeyFn | 0x14
-	KeyEnd      = KeyFn | 0x18
-	//KeyAlt       = KeyFn | 0x15
-	//KeyShift     = KeyFn | 0x16
-	//KeyCtl       = KeyFn | 0x17
+	KeyHome      = KeyFn | 0x0D
+	KeyUp        = KeyFn | 0x0E
+	KeyPageUp    = KeyFn | 0xF
+	KeyPrint     = KeyFn | 0x10
+	KeyLeft      = KeyFn | 0x11
+	KeyRight     = KeyFn | 0x12
+	KeyDown      = 0x80
+	KeyView      = 0x80
+	KeyPageDown  = KeyFn | 0x13
+	KeyInsert    = KeyFn | 0x14
+	KeyEnd       = KeyFn | 0x18
+	KeyAlt       = KeyFn | 0x15
+	KeyShift     = KeyFn | 0x16
+	KeyCtl       = KeyFn | 0x17
 	KeyBackspace = 0x08
 	KeyDelete    = 0x7F
 	KeyEscape    = 0x1b
-	//KeyEOF       = 0x04
-	KeyCmd = 0xF100
+	KeyEOF       = 0x04
+	KeyCmd       = 0xF100
+)
+
+// Function keys F1 to F12 are KeyFn|1 to KeyFn|12.
+const (
+	KeyF1 = KeyFn | (iota + 1)
+	KeyF2
+	KeyF3
+	KeyF4
+	KeyF5
+	KeyF6
+	KeyF7
+	KeyF8
+	KeyF9
+	KeyF10
+	KeyF11
+	KeyF12
 )
 
 // Keymap maps from key event codes to runes, that duit expects.
+// Shiny does not report the Print key on X11 or Windows,
+// so KeyPrint is never sent by default.
 var keymap = map[key.Code]rune{
 	key.CodeHome:            KeyHome,
 	key.CodeUpArrow:         KeyUp,
@@ -40,26 +64,256 @@ var keymap = map[key.Code]rune{
 	key.CodeInsert:          KeyInsert,
 	key.CodeEnd:             KeyEnd,
 	key.CodeDeleteBackspace: KeyBackspace,
-	//key.CodeDelete:     KeyDelete,
-	key.CodeDeleteForward: KeyDelete,
-	key.CodeEscape:        KeyEscape,
-	//key.CodeCmd:        KeyCmd,
-	key.CodeReturnEnter: '\n',
-	key.CodeTab:         '\t',
+	key.CodeDeleteForward:   KeyDelete,
+	key.CodeEscape:          KeyEscape,
+	key.CodeReturnEnter:     '\n',
+	key.CodeTab:             '\t',
+	key.CodeCompose:         composeKey,
+
+	key.CodeF1:  KeyF1,
+	key.CodeF2:  KeyF2,
+	key.CodeF3:  KeyF3,
+	key.CodeF4:  KeyF4,
+	key.CodeF5:  KeyF5,
+	key.CodeF6:  KeyF6,
+	key.CodeF7:  KeyF7,
+	key.CodeF8:  KeyF8,
+	key.CodeF9:  KeyF9,
+	key.CodeF10: KeyF10,
+	key.CodeF11: KeyF11,
+	key.CodeF12: KeyF12,
+
+	// Keypad keys usually come with a rune.
+	// These are used if they don't, e.g. on Windows.
+	key.CodeKeypadEnter:       '\n',
+	key.CodeKeypadSlash:       '/',
+	key.CodeKeypadAsterisk:    '*',
+	key.CodeKeypadHyphenMinus: '-',
+	key.CodeKeypadPlusSign:    '+',
+	key.CodeKeypadFullStop:    '.',
+	key.CodeKeypadEqualSign:   '=',
+	key.CodeKeypad0:           '0',
+	key.CodeKeypad1:           '1',
+	key.CodeKeypad2:           '2',
+	key.CodeKeypad3:           '3',
+	key.CodeKeypad4:           '4',
+	key.CodeKeypad5:           '5',
+	key.CodeKeypad6:           '6',
+	key.CodeKeypad7:           '7',
+	key.CodeKeypad8:           '8',
+	key.CodeKeypad9:           '9',
+
+	// Modifier keys are only sent if Display.ModifierKeys is set.
+	key.CodeLeftAlt:      KeyAlt,
+	key.CodeRightAlt:     KeyAlt,
+	key.CodeLeftShift:    KeyShift,
+	key.CodeRightShift:   KeyShift,
+	key.CodeLeftControl:  KeyCtl,
+	key.CodeRightControl: KeyCtl,
+	key.CodeLeftGUI:      KeyCmd,
+	key.CodeRightGUI:     KeyCmd,
 }
 
-var ctrlMods = map[rune]rune{
-	'a': 0x01, // ^a: beginning of line
-	'e': 0x05, // ^e: end of line
-	'f': 0x06, // ^f: complete
-	'h': 0x08, // ^h: erase character
-	'u': 0x15, // ^u: erase line
-	'w': 0x17, // ^w: erase word
+// IsModifierKey returns true for the runes of modifier key presses.
+func isModifierKey(r rune) bool {
+	switch r {
+	case KeyAlt, KeyShift, KeyCtl, KeyCmd:
+		return true
+	}
+	return false
 }
 
+// DefaultControlKeys maps runes typed with the Control key to control characters.
+// It contains the ASCII control set from Ctrl-@ (0x00) to Ctrl-_ (0x1F)
+// with lower case letters, Ctrl-Space for NUL and Ctrl-? for Delete.
+// It is used for any combination of modifiers which includes Control but not Alt,
+// as Windows reports AltGr as Control and Alt, unless a KeyTranslator is set.
+// Earlier versions only mapped Ctrl-A, E, F, H, U and W and only without other modifiers.
+// Each new Display copies the table to Display.ControlKeys, changing it has
+// no effect on existing displays.
+// This variable is not present in 9fans draw package.
+var DefaultControlKeys = func() map[rune]rune {
+	m := map[rune]rune{
+		' ': 0x00,
+		'?': 0x7F,
+	}
+	for c := '@'; c <= '_'; c++ {
+		m[c] = c & 0x1F
+	}
+	for c := 'a'; c <= 'z'; c++ {
+		m[c] = c & 0x1F
+	}
+	return m
+}()
+
+// KeyboardBuffer is the size of Keyboardctl.C for new displays.
+// What happens when it is full is set by Display.KeyOverflow.
+// This variable is not present in 9fans draw package.
+var KeyboardBuffer = 20
+
+// KeyOverflow tells what happens to a key, which is typed while Keyboardctl.C is full.
+// This type is not present in 9fans draw package.
+type KeyOverflow int
+
+const (
+	KeyOverflowBlock           KeyOverflow = iota // Wait until the program reads a key, this stops the window.
+	KeyOverflowDropOldest                         // Drop the oldest key in the buffer.
+	KeyOverflowCoalesceRepeats                    // Drop the key if it is repeated while held down, otherwise wait.
+)
+
 // Keyboardctl is the source of keyboard events.
 type Keyboardctl struct {
 	C chan rune // Channel on which keyboard characters are delivered.
+
+	keys    chan Key
+	keysOn  int32
+	down    map[key.Code]bool // Keys which are pressed.
+	release map[key.Code]Key  // Delayed releases.
+	dropped uint64            // Number of dropped runes and key events.
+}
+
+// SendRune sends a rune on C, following the overflow policy of the display.
+// Repeat tells if the rune is from a key which is held down.
+func (d *Display) sendRune(r rune, repeat bool) {
+	kc := &d.keyboard
+	select {
+	case kc.C <- r:
+		return
+	default:
+	}
+	switch d.KeyOverflow {
+	case KeyOverflowDropOldest:
+		for {
+			select {
+			case <-kc.C:
+				atomic.AddUint64(&kc.dropped, 1)
+			default:
+			}
+			select {
+			case kc.C <- r:
+				return
+			default:
+			}
+		}
+	case KeyOverflowCoalesceRepeats:
+		if repeat {
+			atomic.AddUint64(&kc.dropped, 1)
+			return
+		}
+	}
+	kc.C <- r
+}
+
+// DroppedKeys returns the number of runes and key events, which were not delivered
+// on Keyboardctl.C or the KeyEvents channel, because it was full.
+// This method is not present in 9fans draw package.
+func (d *Display) DroppedKeys() uint64 {
+	return atomic.LoadUint64(&d.keyboard.dropped)
+}
+
+// Repeat reports if a key event repeats a key which is held down.
+func (kc *Keyboardctl) repeat(e key.Event) bool {
+	switch e.Direction {
+	case key.DirNone:
+		return true
+	case key.DirPress:
+		_, pending := kc.release[e.Code]
+		return pending || kc.down[e.Code]
+	}
+	return false
+}
+
+// Key is a keyboard event with modifiers.
+// This type is not present in 9fans draw package.
+type Key struct {
+	Rune      rune          // Rune for the key as sent on Keyboardctl.C, or -1.
+	Code      key.Code      // Key code, which does not depend on the keyboard layout.
+	Modifiers key.Modifiers // E.g. key.ModShift|key.ModControl.
+	Dir       KeyDir
+}
+
+// KeyDir tells if a key is pressed, repeated while it is down or released.
+type KeyDir int
+
+const (
+	KeyDirPress KeyDir = iota
+	KeyDirRepeat
+	KeyDirRelease
+)
+
+// KeyEvents returns a channel which receives a Key for each key press,
+// repeat and release, in addition to the runes on C.
+// The channel has the same buffer size as C. Events which arrive while it is full
+// are dropped and counted by DroppedKeys, the window never waits for the reader.
+// This method is not present in 9fans draw package.
+func (kc *Keyboardctl) KeyEvents() <-chan Key {
+	atomic.StoreInt32(&kc.keysOn, 1)
+	return kc.keys
+}
+
+// KeyRepeatDelay is the time a key release is delayed.
+// X11 reports autorepeat as a release followed by a press,
+// which are combined to a repeat.
+const keyRepeatDelay = 10 * time.Millisecond
+
+// KeyRelease is sent to the event loop for a delayed release.
+type keyRelease struct {
+	Key
+}
+
+// SendKey sends a key event on the Key channel, if it is enabled.
+// It keeps track of the keys which are held down in any case.
+func (d *Display) sendKey(e key.Event, r rune) {
+	kc := &d.keyboard
+	k := Key{Rune: r, Code: e.Code, Modifiers: e.Modifiers}
+	if kc.repeat(e) {
+		k.Dir = KeyDirRepeat
+	}
+	switch e.Direction {
+	case key.DirRelease:
+		k.Dir = KeyDirRelease
+		kc.release[e.Code] = k
+		time.AfterFunc(keyRepeatDelay, func() {
+			d.window.Send(keyRelease{k})
+		})
+		return
+	case key.DirPress:
+		delete(kc.release, e.Code)
+	}
+	kc.down[e.Code] = true
+	kc.sendKey(k)
+}
+
+// SendKeyRelease sends a delayed release, if the key was not pressed again.
+func (d *Display) sendKeyRelease(k Key) {
+	kc := &d.keyboard
+	if _, ok := kc.release[k.Code]; !ok {
+		return
+	}
+	delete(kc.release, k.Code)
+	delete(kc.down, k.Code)
+	kc.sendKey(k)
+}
+
+// SendKey sends k on the Key channel, if it is enabled and not full.
+func (kc *Keyboardctl) sendKey(k Key) {
+	if atomic.LoadInt32(&kc.keysOn) == 0 {
+		return
+	}
+	select {
+	case kc.keys <- k:
+	default:
+		atomic.AddUint64(&kc.dropped, 1)
+	}
+}
+
+// CopyControlKeys returns a copy of m.
+func copyControlKeys(m map[rune]rune) map[rune]rune {
+	c := make(map[rune]rune, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
 }
 
 // InitKeyboard connects to the keyboard and returns a Keyboardctl to listen to it.
@@ -70,6 +324,8 @@ func (d *Display) InitKeyboard() *Keyboardctl {
 // KeyTranslator translates a key.Event to a rune.
 // If present, it overwrites the default mechanism.
 // If TranslateKey returns -1, the key event is ignored.
+// New displays use the Keymap given by the environment variable
+// DUITDRAW_KEYMAP, which is a preset name (emacs or plan9) or a file name.
 type KeyTranslator interface {
 	TranslateKey(key.Event) rune
 }
@@ -0,0 +1,111 @@
+package duitdraw
+
+import (
+	"testing"
+
+	"golang.org/x/mobile/event/key"
+)
+
+func TestControlKeys(t *testing.T) {
+	tt := []struct {
+		r    rune
+		mods key.Modifiers
+		exp  rune
+	}{
+		{'c', 0, 'c'},
+		{'c', key.ModControl, 0x03},
+		{'C', key.ModControl | key.ModShift, 0x03},
+		{'d', key.ModControl | key.ModAlt, 'd'},
+		{'@', key.ModControl | key.ModAlt, '@'}, // AltGr on Windows.
+		{'z', key.ModControl, 0x1A},
+		{'@', key.ModControl | key.ModShift, 0x00},
+		{' ', key.ModControl, 0x00},
+		{'[', key.ModControl, 0x1B},
+		{'_', key.ModControl | key.ModShift, 0x1F},
+		{'?', key.ModControl | key.ModShift, 0x7F},
+		{'1', key.ModControl, '1'},
+		{'c', key.ModAlt, 'c'},
+	}
+	d := Display{ControlKeys: copyControlKeys(DefaultControlKeys)}
+	for _, tc := range tt {
+		e := key.Event{Rune: tc.r, Modifiers: tc.mods, Direction: key.DirPress}
+		if got := d.translateKey(e); got != tc.exp {
+			t.Errorf("%q with modifiers %v: expected %#x got %#x", tc.r, tc.mods, tc.exp, got)
+		}
+	}
+
+	// The table of a display is a copy, it can be changed independently.
+	d.ControlKeys[' '] = ' '
+	if got := d.translateKey(key.Event{Rune: ' ', Modifiers: key.ModControl, Direction: key.DirPress}); got != ' ' {
+		t.Errorf("Ctrl-Space after change: expected ' ' got %#x", got)
+	}
+	if DefaultControlKeys[' '] != 0x00 {
+		t.Errorf("DefaultControlKeys was changed")
+	}
+}
+
+func TestKeymap(t *testing.T) {
+	tt := []struct {
+		e   key.Event
+		mod bool // Display.ModifierKeys
+		exp rune
+	}{
+		{key.Event{Rune: -1, Code: key.CodeF1}, false, KeyF1},
+		{key.Event{Rune: -1, Code: key.CodeF5}, false, KeyFn | 5},
+		{key.Event{Rune: -1, Code: key.CodeF12}, false, KeyFn | 12},
+		{key.Event{Rune: -1, Code: key.CodeKeypadEnter}, false, '\n'},
+		{key.Event{Rune: '\r', Code: key.CodeKeypadEnter}, false, '\n'},
+		{key.Event{Rune: -1, Code: key.CodeKeypad7}, false, '7'},
+		{key.Event{Rune: -1, Code: key.CodeLeftAlt}, false, -1},
+		{key.Event{Rune: -1, Code: key.CodeLeftAlt}, true, KeyAlt},
+		{key.Event{Rune: -1, Code: key.CodeRightShift}, true, KeyShift},
+		{key.Event{Rune: -1, Code: key.CodeLeftControl, Modifiers: key.ModControl}, true, KeyCtl},
+		{key.Event{Rune: -1, Code: key.CodeLeftGUI}, true, KeyCmd},
+		{key.Event{Rune: -1, Code: key.CodeLeftAlt, Direction: key.DirRelease}, true, -1},
+		{key.Event{Rune: 'c', Code: key.CodeC, Modifiers: key.ModMeta}, false, KeyCmd + 'c'},
+		{key.Event{Rune: -1, Code: key.CodeLeftArrow, Modifiers: key.ModMeta}, false, KeyLeft},
+	}
+	for _, tc := range tt {
+		d := Display{ModifierKeys: tc.mod}
+		if tc.e.Direction == key.DirNone {
+			tc.e.Direction = key.DirPress
+		}
+		if got := d.translateKey(tc.e); got != tc.exp {
+			t.Errorf("%v (modifier keys %v): expected %#x got %#x", tc.e, tc.mod, tc.exp, got)
+		}
+	}
+}
+
+func TestKeyOverflow(t *testing.T) {
+	defer func(n int) { KeyboardBuffer = n }(KeyboardBuffer)
+	KeyboardBuffer = 2
+
+	tt := []struct {
+		policy KeyOverflow
+		dirs   []key.Direction
+		exp    string
+		drops  uint64
+	}{
+		{KeyOverflowDropOldest, []key.Direction{key.DirPress, key.DirPress, key.DirPress, key.DirPress}, "cd", 2},
+		{KeyOverflowCoalesceRepeats, []key.Direction{key.DirPress, key.DirNone, key.DirNone, key.DirNone}, "ab", 2},
+	}
+	for _, tc := range tt {
+		d, w, done := startEventLoop(t)
+		d.KeyOverflow = tc.policy
+		sync := make(chan bool)
+		d.Preedit = func(string, int) { sync <- true }
+		for i, dir := range tc.dirs {
+			w.Send(key.Event{Rune: 'a' + rune(i), Code: key.CodeA + key.Code(i), Direction: dir})
+		}
+		// The event loop calls Preedit, after the keys are handled.
+		w.Send(imePreedit{})
+		<-sync
+		if got := string([]rune{<-d.keyboard.C, <-d.keyboard.C}); got != tc.exp {
+			t.Errorf("policy %d: expected %q got %q", tc.policy, tc.exp, got)
+		}
+		if n := d.DroppedKeys(); n != tc.drops {
+			t.Errorf("policy %d: expected %d dropped keys got %d", tc.policy, tc.drops, n)
+		}
+		done()
+	}
+}
@@ -0,0 +1,223 @@
+package duitdraw
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mobile/event/key"
+)
+
+// Keymap is a KeyTranslator which rebinds keys as given by a keymap file.
+// Keys which are not in the keymap are translated as by default.
+// This type is not present in 9fans draw package.
+//
+// Each line of a keymap file binds a key to a rune:
+//	# Comment
+//	C-a        Home
+//	C-S-f      'F'
+//	M-v        PageUp
+//	F1         0xF001
+//	Insert     none
+// The key is the name of a key.Code without the Code prefix, e.g. A, F1,
+// LeftArrow or ReturnEnter, in any case. It may be prefixed by the modifiers
+// C- (Control), S- (Shift), M- (Alt) and s- (Super or Cmd), which must all match.
+// The rune is a key name (Home, End, Up, Down, Left, Right, PageUp, PageDown,
+// Insert, Backspace, Delete, Escape, Enter, Tab, Print, View, EOF, Alt, Shift,
+// Ctl, Cmd, F1 to F12), compose to start a compose sequence, a quoted Go rune
+// literal, a number, or none to ignore the key.
+type Keymap struct {
+	m map[keyBinding]rune
+}
+
+type keyBinding struct {
+	code key.Code
+	mods key.Modifiers
+}
+
+const keymapModifiers = key.ModShift | key.ModControl | key.ModAlt | key.ModMeta
+
+// KeymapPresets are the keymaps which can be loaded by name.
+var keymapPresets = map[string]string{
+	"emacs": `# Emacs cursor movement.
+C-a Home
+C-e End
+C-b Left
+C-f Right
+C-p Up
+C-n Down
+C-v PageDown
+M-v PageUp
+C-d Delete
+C-h Backspace
+C-g Escape
+`,
+	"plan9": `# Plan 9: Alt starts a compose sequence, Delete interrupts,
+# the down arrow scrolls and there is no Insert key.
+LeftAlt compose
+RightAlt compose
+DeleteForward Delete
+DownArrow View
+Insert none
+`,
+}
+
+// KeymapEnv is the environment variable which selects the keymap of new displays.
+const keymapEnv = "DUITDRAW_KEYMAP"
+
+// LoadKeymap returns the preset keymap "emacs" or "plan9",
+// or loads the keymap file with the given name.
+// This function is not present in 9fans draw package.
+func LoadKeymap(name string) (*Keymap, error) {
+	if s, ok := keymapPresets[name]; ok {
+		return ParseKeymap(strings.NewReader(s))
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseKeymap(f)
+}
+
+// ParseKeymap reads a keymap file.
+// This function is not present in 9fans draw package.
+func ParseKeymap(r io.Reader) (*Keymap, error) {
+	km := &Keymap{m: make(map[keyBinding]rune)}
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		f := strings.Fields(line)
+		if len(f) != 2 {
+			return nil, fmt.Errorf("keymap:%d: expected key and rune: %s", n, line)
+		}
+		b, err := parseKeyBinding(f[0])
+		if err != nil {
+			return nil, fmt.Errorf("keymap:%d: %s", n, err)
+		}
+		r, err := parseKeyRune(f[1])
+		if err != nil {
+			return nil, fmt.Errorf("keymap:%d: %s", n, err)
+		}
+		km.m[b] = r
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return km, nil
+}
+
+// KeyCodes maps lower case key names to codes.
+var keyCodes = func() map[string]key.Code {
+	m := make(map[string]key.Code)
+	for c := key.Code(0); c < 0x100; c++ {
+		if s := c.String(); strings.HasPrefix(s, "Code") && !strings.HasPrefix(s, "Code(") {
+			m[strings.ToLower(s[len("Code"):])] = c
+		}
+	}
+	m["compose"] = key.CodeCompose
+	return m
+}()
+
+func parseKeyBinding(s string) (keyBinding, error) {
+	var b keyBinding
+	name := s
+	for len(name) > 2 && name[1] == '-' {
+		switch name[0] {
+		case 'C':
+			b.mods |= key.ModControl
+		case 'S':
+			b.mods |= key.ModShift
+		case 'M':
+			b.mods |= key.ModAlt
+		case 's':
+			b.mods |= key.ModMeta
+		default:
+			return b, fmt.Errorf("unknown modifier %q in %s", name[:2], s)
+		}
+		name = name[2:]
+	}
+	c, ok := keyCodes[strings.ToLower(name)]
+	if !ok {
+		return b, fmt.Errorf("unknown key %q", name)
+	}
+	b.code = c
+	return b, nil
+}
+
+// KeyNames maps lower case names to runes for the keymap file.
+var keyNames = map[string]rune{
+	"home":      KeyHome,
+	"end":       KeyEnd,
+	"up":        KeyUp,
+	"down":      KeyDown,
+	"left":      KeyLeft,
+	"right":     KeyRight,
+	"pageup":    KeyPageUp,
+	"pagedown":  KeyPageDown,
+	"insert":    KeyInsert,
+	"backspace": KeyBackspace,
+	"delete":    KeyDelete,
+	"escape":    KeyEscape,
+	"enter":     '\n',
+	"tab":       '\t',
+	"print":     KeyPrint,
+	"view":      KeyView,
+	"eof":       KeyEOF,
+	"alt":       KeyAlt,
+	"shift":     KeyShift,
+	"ctl":       KeyCtl,
+	"cmd":       KeyCmd,
+	"compose":   composeKey,
+	"none":      -1,
+}
+
+func parseKeyRune(s string) (rune, error) {
+	if r, ok := keyNames[strings.ToLower(s)]; ok {
+		return r, nil
+	}
+	if len(s) > 1 && (s[0] == 'f' || s[0] == 'F') {
+		if n, err := strconv.Atoi(s[1:]); err == nil && n >= 1 && n <= 12 {
+			return KeyFn | rune(n), nil
+		}
+	}
+	if len(s) > 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		r, _, tail, err := strconv.UnquoteChar(s[1:len(s)-1], '\'')
+		if err == nil && tail == "" {
+			return r, nil
+		}
+	}
+	if n, err := strconv.ParseInt(s, 0, 32); err == nil && n >= 0 {
+		return rune(n), nil
+	}
+	return 0, fmt.Errorf("unknown rune %q", s)
+}
+
+// TranslateKey returns the rune bound to the key event, or translates it
+// as by default. Modifier key presses are only sent if they are bound.
+// Control combinations, which are not bound, are translated with DefaultControlKeys.
+func (km *Keymap) TranslateKey(e key.Event) rune {
+	return km.translate(e, false, DefaultControlKeys)
+}
+
+func (km *Keymap) translate(e key.Event, modifierKeys bool, controlKeys map[rune]rune) rune {
+	if e.Direction == key.DirRelease {
+		return -1
+	}
+	mods := e.Modifiers & keymapModifiers
+	r, ok := km.m[keyBinding{e.Code, mods}]
+	if !ok && isModifierKey(keymap[e.Code]) {
+		// The modifier may already be set while its key is pressed.
+		r, ok = km.m[keyBinding{e.Code, 0}]
+	}
+	if ok {
+		return r
+	}
+	return translateKey(e, modifierKeys, controlKeys)
+}
@@ -0,0 +1,77 @@
+package duitdraw
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/mobile/event/key"
+)
+
+func TestParseKeymap(t *testing.T) {
+	km, err := ParseKeymap(strings.NewReader(`# test
+C-a      Home
+C-S-f    'F'
+s-c      '\n'
+F1       0xF00D
+insert   none
+LeftAlt  Alt
+M-v      f3
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tt := []struct {
+		code key.Code
+		r    rune
+		mods key.Modifiers
+		dir  key.Direction
+		exp  rune
+	}{
+		{key.CodeA, 'a', key.ModControl, key.DirPress, KeyHome},
+		{key.CodeA, 'a', key.ModControl | key.ModShift, key.DirPress, 0x01},
+		{key.CodeA, 'a', key.ModControl, key.DirRelease, -1},
+		{key.CodeF, 'F', key.ModControl | key.ModShift, key.DirPress, 'F'},
+		{key.CodeC, 'c', key.ModMeta, key.DirPress, '\n'},
+		{key.CodeF1, -1, 0, key.DirNone, KeyHome},
+		{key.CodeInsert, -1, 0, key.DirPress, -1},
+		{key.CodeLeftAlt, -1, 0, key.DirPress, KeyAlt},
+		{key.CodeLeftAlt, -1, key.ModAlt, key.DirPress, KeyAlt},
+		{key.CodeRightAlt, -1, 0, key.DirPress, -1},
+		{key.CodeV, 'v', key.ModAlt, key.DirPress, KeyF3},
+		{key.CodeB, 'b', 0, key.DirPress, 'b'},
+	}
+	for _, tc := range tt {
+		e := key.Event{Rune: tc.r, Code: tc.code, Modifiers: tc.mods, Direction: tc.dir}
+		if got := km.TranslateKey(e); got != tc.exp {
+			t.Errorf("%v: expected %#x got %#x", e, tc.exp, got)
+		}
+	}
+}
+
+func TestParseKeymapErrors(t *testing.T) {
+	for _, s := range []string{
+		"C-a",
+		"X-a Home",
+		"Nokey Home",
+		"a Nothing",
+		"a 'ab'",
+		"a Home extra",
+	} {
+		if _, err := ParseKeymap(strings.NewReader(s)); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+func TestKeymapPresets(t *testing.T) {
+	for name := range keymapPresets {
+		if _, err := LoadKeymap(name); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	km, _ := LoadKeymap("emacs")
+	d := Display{KeyTranslator: km}
+	if r := d.translateKey(key.Event{Rune: 'e', Code: key.CodeE, Modifiers: key.ModControl, Direction: key.DirPress}); r != KeyEnd {
+		t.Errorf("emacs C-e: expected KeyEnd got %#x", r)
+	}
+}
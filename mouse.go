@@ -2,9 +2,16 @@ package duitdraw
 
 import (
 	"image"
+	"sync"
+	"sync/atomic"
 )
 
 // Mouse is the structure describing the current state of the mouse.
+// The scroll wheel presses and releases button 4 (up) and 5 (down),
+// and 6 (left) and 7 (right) for horizontal scrolling.
+// Msec counts the milliseconds since the Display was created with a
+// monotonic clock. Shiny does not report the time of an event, so it is
+// taken when the window receives the event, before it is queued for delivery.
 type Mouse struct {
 	image.Point        // Location.
 	Buttons     int    // Buttons; bit 0 is button 1, bit 1 is button 2, etc.
@@ -12,6 +19,16 @@ type Mouse struct {
 
 }
 
+// Scroll is a single wheel step with its direction.
+// Shiny reports no scroll distances, so high resolution wheels and
+// touchpads send a sequence of steps.
+// This type is not present in 9fans draw package.
+type Scroll struct {
+	image.Point         // Location.
+	StepX, StepY int    // Direction of the step, -1, 0 or 1; positive values scroll right and down.
+	Msec         uint32 // Time stamp in milliseconds.
+}
+
 // TODO: Mouse field is racy but okay.
 
 // Mousectl holds the interface to receive mouse events.
@@ -19,11 +36,18 @@ type Mouse struct {
 // have the wrong value if the sending goroutine blocks during send.
 // This means that programs should receive into Mousectl.Mouse
 // if they want full synchrony.
+// Events are queued, so the window does not block if they are not read.
+// While the program is busy, motion events are combined to the latest one,
+// but button presses and releases are delivered with their location.
 type Mousectl struct {
 	Mouse              // Store Mouse events here.
 	C       chan Mouse // Channel of Mouse events.
 	Resize  chan bool  // Each received value signals a window resize (see the display.Attach method).
 	Display *Display
+
+	scroll   chan Scroll
+	scrollOn int32
+	queue    mouseQueue
 }
 
 // Read returns the next mouse event.
@@ -34,3 +58,79 @@ func (mc *Mousectl) Read() Mouse {
 	mc.Mouse = m
 	return m
 }
+
+// ScrollEvents returns a channel which receives a Scroll for each wheel step,
+// in addition to the button events on C.
+// Events are dropped if the channel is not read.
+// This method is not present in 9fans draw package.
+func (mc *Mousectl) ScrollEvents() <-chan Scroll {
+	atomic.StoreInt32(&mc.scrollOn, 1)
+	return mc.scroll
+}
+
+// MouseQueue holds the mouse events, which are not yet received from Mousectl.C.
+type mouseQueue struct {
+	mu      sync.Mutex
+	pending []Mouse
+	last    Mouse         // Last event taken from the queue.
+	wake    chan struct{} // Signals new events to the delivering goroutine.
+}
+
+// Push adds a mouse event to the queue.
+// If it and the last queued event are both motion events,
+// which do not change the buttons, the last one is replaced.
+func (q *mouseQueue) push(m Mouse) {
+	q.mu.Lock()
+	n := len(q.pending)
+	prev := q.last
+	if n > 1 {
+		prev = q.pending[n-2]
+	}
+	if n > 0 && q.pending[n-1].Buttons == m.Buttons && prev.Buttons == m.Buttons {
+		q.pending[n-1] = m
+	} else {
+		q.pending = append(q.pending, m)
+	}
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Pop removes the first event from the queue.
+func (q *mouseQueue) pop() (Mouse, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) == 0 {
+		return Mouse{}, false
+	}
+	m := q.pending[0]
+	q.pending = q.pending[1:]
+	q.last = m
+	return m, true
+}
+
+// Deliver sends the queued mouse events on C until done is closed.
+func (mc *Mousectl) deliver(done <-chan struct{}) {
+	for {
+		select {
+		case <-mc.queue.wake:
+		case <-done:
+			return
+		}
+		for {
+			m, ok := mc.queue.pop()
+			if !ok {
+				break
+			}
+			select {
+			case mc.C <- m:
+				// Mouse field is racy. See Mousectl documentation.
+				mc.Mouse = m
+			case <-done:
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package duitdraw
+
+import (
+	"image"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/mobile/event/key"
+	"golang.org/x/mobile/event/mouse"
+)
+
+func TestMouseQueue(t *testing.T) {
+	q := mouseQueue{wake: make(chan struct{}, 1)}
+	m := func(x, buttons int) Mouse {
+		return Mouse{Point: image.Pt(x, 0), Buttons: buttons}
+	}
+	for _, e := range []Mouse{
+		m(1, 0), m(2, 0), m(3, 0), // Motion is combined.
+		m(4, 1), m(5, 1), m(6, 1), // The press is kept.
+		m(7, 0), m(8, 0), m(9, 0), // The release is kept.
+		m(10, 4), m(10, 0), // A click of button 3.
+	} {
+		q.push(e)
+	}
+	var got []Mouse
+	for {
+		e, ok := q.pop()
+		if !ok {
+			break
+		}
+		got = append(got, e)
+	}
+	exp := []Mouse{m(3, 0), m(4, 1), m(6, 1), m(7, 0), m(9, 0), m(10, 4), m(10, 0)}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected %v\ngot %v", exp, got)
+	}
+
+	// A motion event after the last delivered one may be replaced.
+	q.push(m(11, 0))
+	q.push(m(12, 0))
+	if e, _ := q.pop(); e != m(12, 0) {
+		t.Errorf("expected %v got %v", m(12, 0), e)
+	}
+}
+
+func TestMouseNonBlocking(t *testing.T) {
+	d, w, done := startEventLoop(t)
+	defer done()
+
+	for i := 0; i < 100; i++ {
+		w.Send(mouse.Event{X: float32(i), Y: 1})
+	}
+	w.Send(mouse.Event{X: 100, Y: 1, Button: mouse.ButtonLeft, Direction: mouse.DirPress})
+	w.Send(mouse.Event{X: 101, Y: 1, Button: mouse.ButtonLeft, Direction: mouse.DirRelease})
+
+	// The window still handles key events, while the mouse is not read.
+	w.Send(key.Event{Rune: 'a', Code: key.CodeA, Direction: key.DirPress})
+	select {
+	case <-d.keyboard.C:
+	case <-time.After(time.Second):
+		t.Fatal("event loop is blocked")
+	}
+
+	var buttons []int
+	for {
+		m := readMouse(t, d)
+		buttons = append(buttons, m.Buttons)
+		if m.X == 101 {
+			break
+		}
+	}
+	if n := len(buttons); n < 3 || buttons[n-2] != 1 || buttons[n-1] != 0 {
+		t.Errorf("click was not delivered: %v", buttons)
+	}
+}
+
+func TestMouseMsec(t *testing.T) {
+	d, w, done := startEventLoop(t)
+	defer done()
+
+	time.Sleep(20 * time.Millisecond)
+	w.Send(mouse.Event{X: 1, Y: 1})
+	m := readMouse(t, d)
+	after := time.Since(d.start)
+	if ms := time.Duration(m.Msec) * time.Millisecond; ms < 20*time.Millisecond || ms > after {
+		t.Errorf("expected msec between 20ms and %v got %v", after, ms)
+	}
+
+	// Events which are not read in time keep the time they arrived.
+	w.Send(mouse.Event{X: 2, Y: 1, Button: mouse.ButtonLeft, Direction: mouse.DirPress})
+	sent := time.Since(d.start)
+	time.Sleep(100 * time.Millisecond)
+	if m := readMouse(t, d); time.Duration(m.Msec)*time.Millisecond > sent+50*time.Millisecond {
+		t.Errorf("press was stamped when it was read: %v, sent at %v", time.Duration(m.Msec)*time.Millisecond, sent)
+	}
+}
@@ -0,0 +1,90 @@
+package duitdraw
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// Op represents a Porter-Duff compositing operator.
+// All operators are supported. S and SoverD are drawn with image/draw,
+// the others pixel by pixel, which is slower.
+type Op int
+
+const (
+	// Zero and one are sufficient to describe the operations.
+	Clear Op = 0
+	SinD  Op = 8
+	DinS  Op = 4
+	SoutD Op = 2
+	DoutS Op = 1
+
+	S      = SinD | SoutD
+	SoverD = SinD | SoutD | DoutS
+	SatopD = SinD | DoutS
+	SxorD  = SoutD | DoutS
+
+	D      = DinS | DoutS
+	DoverS = DinS | DoutS | SoutD
+	DatopS = DinS | SoutD
+	DxorS  = DoutS | SoutD
+)
+
+// Draw draws src in mask on dst with op, as draw.DrawMask does:
+// the source is multiplied by the mask before it is composited.
+// S and SoverD use image/draw, the other operators are composited
+// pixel by pixel with Fs and Fd of the Porter-Duff model.
+func (op Op) draw(dst draw.Image, r image.Rectangle, src image.Image, sp image.Point, mask image.Image, mp image.Point) {
+	switch op {
+	case S:
+		draw.DrawMask(dst, r, src, sp, mask, mp, draw.Src)
+		return
+	case SoverD:
+		draw.DrawMask(dst, r, src, sp, mask, mp, draw.Over)
+		return
+	}
+
+	orig := r.Min
+	r = r.Intersect(dst.Bounds()).Intersect(src.Bounds().Add(orig.Sub(sp)))
+	if mask != nil {
+		r = r.Intersect(mask.Bounds().Add(orig.Sub(mp)))
+	}
+	if r.Empty() {
+		return
+	}
+	sp = sp.Add(r.Min.Sub(orig))
+	mp = mp.Add(r.Min.Sub(orig))
+
+	const m = 0xffff
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			sr, sg, sb, sa := src.At(sp.X+x-r.Min.X, sp.Y+y-r.Min.Y).RGBA()
+			if mask != nil {
+				_, _, _, ma := mask.At(mp.X+x-r.Min.X, mp.Y+y-r.Min.Y).RGBA()
+				sr, sg, sb, sa = sr*ma/m, sg*ma/m, sb*ma/m, sa*ma/m
+			}
+			dr, dg, db, da := dst.At(x, y).RGBA()
+			var fs, fd uint32
+			if op&SinD != 0 {
+				fs += da
+			}
+			if op&SoutD != 0 {
+				fs += m - da
+			}
+			if op&DinS != 0 {
+				fd += sa
+			}
+			if op&DoutS != 0 {
+				fd += m - sa
+			}
+			c := func(s, d uint32) uint16 {
+				v := (uint64(s)*uint64(fs) + uint64(d)*uint64(fd)) / m
+				if v > m {
+					v = m
+				}
+				return uint16(v)
+			}
+			dst.Set(x, y, color.RGBA64{c(sr, dr), c(sg, dg), c(sb, db), c(sa, da)})
+		}
+	}
+}
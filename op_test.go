@@ -0,0 +1,50 @@
+package duitdraw
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestOp(t *testing.T) {
+	red := color.RGBA{0xff, 0, 0, 0xff}
+	blue := color.RGBA{0, 0, 0xff, 0xff}
+	half := color.RGBA{0, 0x80, 0, 0x80}
+	tt := []struct {
+		op       Op
+		src, dst color.RGBA
+		exp      color.RGBA
+	}{
+		{SoverD, half, blue, color.RGBA{0, 0x80, 0x7f, 0xff}},
+		{S, half, blue, half},
+		{D, red, blue, blue},
+		{Clear, red, blue, color.RGBA{}},
+		{SinD, red, color.RGBA{}, color.RGBA{}},
+		{SoutD, red, color.RGBA{}, red},
+		{DinS, half, blue, color.RGBA{0, 0, 0x80, 0x80}},
+		{DoutS, half, blue, color.RGBA{0, 0, 0x7f, 0x7f}},
+		{DoverS, half, color.RGBA{}, half},
+		{SatopD, half, blue, color.RGBA{0, 0x80, 0x7f, 0xff}},
+		{DatopS, half, blue, color.RGBA{0, 0, 0x80, 0x80}},
+		{SxorD, red, color.RGBA{}, red},
+	}
+	for _, tc := range tt {
+		dst := image.NewRGBA(image.Rect(0, 0, 2, 1))
+		dst.Set(0, 0, tc.dst)
+		dst.Set(1, 0, tc.dst)
+		// The mask covers the first pixel, the source is transparent on the second.
+		mask := image.NewAlpha(image.Rect(0, 0, 2, 1))
+		mask.SetAlpha(0, 0, color.Alpha{0xff})
+		tc.op.draw(dst, dst.Bounds(), image.NewUniform(tc.src), image.ZP, mask, image.ZP)
+		if got := dst.RGBAAt(0, 0); got != tc.exp {
+			t.Errorf("op %d: expected %v got %v", tc.op, tc.exp, got)
+		}
+		var transparent color.RGBA
+		if tc.op&DoutS != 0 {
+			transparent = tc.dst
+		}
+		if got := dst.RGBAAt(1, 0); got != transparent {
+			t.Errorf("op %d outside of the mask: expected %v got %v", tc.op, transparent, got)
+		}
+	}
+}
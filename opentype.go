@@ -0,0 +1,1044 @@
+package duitdraw
+
+import (
+	"math/bits"
+	"sort"
+	"sync"
+)
+
+// OpenType layout tables are read from the font file, as freetype only
+// supports the kern table:
+//	GDEF: glyph classes, mark attachment classes and mark glyph sets
+//	GSUB: glyph substitution, lookup types 1 to 8
+//	GPOS: glyph positioning, lookup types 1 to 9
+// Device tables and font variations are ignored.
+
+// OtLayout holds the layout tables of a font file.
+type otLayout struct {
+	gdef, gsub, gpos []byte
+
+	mu    sync.Mutex
+	plans map[string]*otPlan // By script tag and kerning.
+}
+
+// ParseLayout returns the layout tables of a truetype file, or nil if it has none.
+func parseLayout(ttf []byte) *otLayout {
+	l := otLayout{
+		gdef:  fontTable(ttf, "GDEF"),
+		gsub:  fontTable(ttf, "GSUB"),
+		gpos:  fontTable(ttf, "GPOS"),
+		plans: make(map[string]*otPlan),
+	}
+	if l.gsub == nil && l.gpos == nil {
+		return nil
+	}
+	return &l
+}
+
+// FontTable returns the table with the given tag of a truetype file, or nil.
+func fontTable(ttf []byte, tag string) []byte {
+	n := count(ttf, int(u16(ttf, 4)), 12, 16)
+	for i := 0; i < n; i++ {
+		x := 12 + 16*i
+		if string(ttf[x:x+4]) == tag {
+			return sub(ttf, int(u32(ttf, x+8)), int(u32(ttf, x+12)))
+		}
+	}
+	return nil
+}
+
+func s16(b []byte, i int) int {
+	return int(int16(u16(b, i)))
+}
+
+// Off16 returns the offset at x relative to base, or -1 for a null offset.
+func off16(b []byte, base, x int) int {
+	o := u16(b, x)
+	if o == 0 {
+		return -1
+	}
+	return base + int(o)
+}
+
+// Coverage returns the coverage index of glyph g in the coverage table at x, or -1.
+func coverage(t []byte, x int, g uint16) int {
+	switch u16(t, x) {
+	case 1:
+		n := count(t, int(u16(t, x+2)), x+4, 2)
+		i := sort.Search(n, func(i int) bool { return u16(t, x+4+2*i) >= g })
+		if i < n && u16(t, x+4+2*i) == g {
+			return i
+		}
+	case 2:
+		n := count(t, int(u16(t, x+2)), x+4, 6)
+		i := sort.Search(n, func(i int) bool { return u16(t, x+4+6*i+2) >= g })
+		if r := x + 4 + 6*i; i < n && u16(t, r) <= g {
+			return int(u16(t, r+4)) + int(g-u16(t, r))
+		}
+	}
+	return -1
+}
+
+// ClassOf returns the class of glyph g in the class definition table at x.
+func classOf(t []byte, x int, g uint16) int {
+	switch u16(t, x) {
+	case 1:
+		start := u16(t, x+2)
+		n := count(t, int(u16(t, x+4)), x+6, 2)
+		if g >= start && int(g-start) < n {
+			return int(u16(t, x+6+2*int(g-start)))
+		}
+	case 2:
+		n := count(t, int(u16(t, x+2)), x+4, 6)
+		i := sort.Search(n, func(i int) bool { return u16(t, x+4+6*i+2) >= g })
+		if r := x + 4 + 6*i; i < n && u16(t, r) <= g {
+			return int(u16(t, r+4))
+		}
+	}
+	return 0
+}
+
+// HasGlyphClasses reports if the GDEF table classifies the glyphs.
+func (l *otLayout) hasGlyphClasses() bool {
+	return l != nil && u16(l.gdef, 4) != 0
+}
+
+// GlyphClass returns the GDEF class of a glyph:
+// 1 base, 2 ligature, 3 mark, 4 component, or 0.
+func (l *otLayout) glyphClass(g uint16) uint8 {
+	return uint8(classOf(l.gdef, off16(l.gdef, 0, 4), g))
+}
+
+func (l *otLayout) markAttachClass(g uint16) int {
+	return classOf(l.gdef, off16(l.gdef, 0, 10), g)
+}
+
+// InMarkSet reports if glyph g is in the mark glyph set i of the GDEF table.
+func (l *otLayout) inMarkSet(i int, g uint16) bool {
+	if u16(l.gdef, 2) < 2 {
+		return false
+	}
+	x := off16(l.gdef, 0, 12)
+	if x < 0 || i >= count(l.gdef, int(u16(l.gdef, x+2)), x+4, 4) {
+		return false
+	}
+	return coverage(l.gdef, x+int(u32(l.gdef, x+4+4*i)), g) >= 0
+}
+
+// OtFeature is a feature of a shaper, which applies to the glyphs with the mask.
+type otFeature struct {
+	tag  string
+	mask uint32
+}
+
+// OtLookupRef is a lookup of the features of a shaping stage.
+type otLookupRef struct {
+	index int
+	mask  uint32
+}
+
+// LangSys returns the offset of the default language system of the first
+// script of the table in scripts, and its tag, or -1.
+func langSys(t []byte, scripts []string) (int, string) {
+	list := off16(t, 0, 4)
+	if list < 0 {
+		return -1, ""
+	}
+	n := count(t, int(u16(t, list)), list+2, 6)
+	for _, tag := range scripts {
+		for i := 0; i < n; i++ {
+			r := list + 2 + 6*i
+			if string(t[r:r+4]) != tag {
+				continue
+			}
+			s := list + int(u16(t, r+4))
+			if x := off16(t, s, s); x >= 0 {
+				return x, tag
+			}
+			if u16(t, s+2) > 0 {
+				return s + int(u16(t, s+8)), tag
+			}
+		}
+	}
+	return -1, ""
+}
+
+// Lookups returns the lookups of the features of a language system,
+// sorted by lookup index. Lookups of several features get their masks combined.
+// The required feature of the language system is added with mask required.
+func lookups(t []byte, ls int, features []otFeature, required uint32) []otLookupRef {
+	if ls < 0 {
+		return nil
+	}
+	list := off16(t, 0, 6)
+	nf := count(t, int(u16(t, list)), list+2, 6)
+	masks := make(map[int]uint32)
+	add := func(fi int, mask uint32) {
+		if fi >= nf || list < 0 {
+			return
+		}
+		x := list + int(u16(t, list+2+6*fi+4))
+		n := count(t, int(u16(t, x+2)), x+4, 2)
+		for k := 0; k < n; k++ {
+			masks[int(u16(t, x+4+2*k))] |= mask
+		}
+	}
+	if fi := u16(t, ls+2); fi != 0xFFFF && required != 0 {
+		add(int(fi), required)
+	}
+	n := count(t, int(u16(t, ls+4)), ls+6, 2)
+	for k := 0; k < n; k++ {
+		fi := int(u16(t, ls+6+2*k))
+		if fi >= nf {
+			continue
+		}
+		r := list + 2 + 6*fi
+		for _, f := range features {
+			if string(t[r:r+4]) == f.tag {
+				add(fi, f.mask)
+			}
+		}
+	}
+	refs := make([]otLookupRef, 0, len(masks))
+	for i, m := range masks {
+		refs = append(refs, otLookupRef{i, m})
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].index < refs[j].index })
+	return refs
+}
+
+// OtLookup is a lookup table of GSUB or GPOS.
+type otLookup struct {
+	typ       uint16 // Type of the subtables, after resolving extensions.
+	flag      uint16
+	markSet   int   // Mark filtering set, if flag has 0x10.
+	subtables []int // Offsets in the table.
+}
+
+// Lookup flags.
+const (
+	otRightToLeft = 0x1
+	otIgnoreBases = 0x2
+	otIgnoreLigs  = 0x4
+	otIgnoreMarks = 0x8
+	otUseMarkSet  = 0x10
+)
+
+func lookup(t []byte, i int, gpos bool) otLookup {
+	list := off16(t, 0, 8)
+	if list < 0 || i >= count(t, int(u16(t, list)), list+2, 2) {
+		return otLookup{}
+	}
+	x := list + int(u16(t, list+2+2*i))
+	lk := otLookup{typ: u16(t, x), flag: u16(t, x+2)}
+	ext := uint16(7)
+	if gpos {
+		ext = 9
+	}
+	n := count(t, int(u16(t, x+4)), x+6, 2)
+	typ := lk.typ
+	for k := 0; k < n; k++ {
+		s := x + int(u16(t, x+6+2*k))
+		if lk.typ == ext {
+			typ = u16(t, s+2)
+			s += int(u32(t, s+4))
+		}
+		lk.subtables = append(lk.subtables, s)
+	}
+	lk.typ = typ
+	if lk.flag&otUseMarkSet != 0 {
+		lk.markSet = int(u16(t, x+6+2*n))
+	}
+	return lk
+}
+
+// OtGlyph is a glyph in the buffer of the shaper.
+type otGlyph struct {
+	id       uint16
+	r        rune   // Rune of the glyph, if it is not substituted.
+	cluster  int    // Index of the first rune of the glyph in the string.
+	mask     uint32 // Features which apply to the glyph.
+	class    uint8  // GDEF class: 1 base, 2 ligature, 3 mark, 4 component.
+	subst    bool   // The glyph was substituted and is drawn by its index.
+	ligated  bool   // The glyph is a ligature.
+	ligID    uint16 // Ligature of a ligature glyph, or of a mark between its components.
+	ligComp  uint8  // Component of the ligature a mark belongs to, from 1.
+	syllable uint16 // Indic syllable, lookups do not match across syllables.
+	cat, pos uint8  // Indic category and position.
+
+	// Positioning in font units.
+	xAdv, xOff, yOff int
+	attach           int  // Offset to the glyph a mark or cursive glyph is attached to.
+	cursive          bool // The attachment is cursive.
+}
+
+// OtContext applies the lookups of GSUB or GPOS to a glyph buffer.
+type otContext struct {
+	l         *otLayout
+	t         []byte
+	gpos      bool
+	rtl       bool // The buffer is right-to-left text in logical order.
+	syllables bool // Lookups do not match across syllables.
+	buf       []otGlyph
+	depth     int // Nesting of contextual lookups.
+	ligID     uint16
+}
+
+// MaxNesting limits recursion of contextual lookups.
+const maxNesting = 8
+
+// Apply applies the lookups to the glyphs which have one of their masks.
+func (c *otContext) apply(refs []otLookupRef) {
+	for _, ref := range refs {
+		lk := lookup(c.t, ref.index, c.gpos)
+		if !c.gpos && lk.typ == 8 {
+			for i := len(c.buf) - 1; i >= 0; i-- {
+				if c.buf[i].mask&ref.mask != 0 && !c.ignored(&lk, i) {
+					c.applyAt(&lk, i)
+				}
+			}
+			continue
+		}
+		for i := 0; i < len(c.buf); {
+			n := len(c.buf)
+			if c.buf[i].mask&ref.mask != 0 && !c.ignored(&lk, i) {
+				if next, ok := c.applyAt(&lk, i); ok && (next > i || len(c.buf) < n) {
+					i = next
+					continue
+				}
+			}
+			i++
+		}
+	}
+}
+
+// ApplyAt applies the first matching subtable of the lookup at glyph i.
+// It returns the index of the glyph to continue with.
+func (c *otContext) applyAt(lk *otLookup, i int) (int, bool) {
+	if i < 0 || i >= len(c.buf) {
+		return i, false
+	}
+	for _, s := range lk.subtables {
+		var next int
+		var ok bool
+		if c.gpos {
+			next, ok = c.position(lk, s, i)
+		} else {
+			next, ok = c.substitute(lk, s, i)
+		}
+		if ok {
+			return next, true
+		}
+	}
+	return i, false
+}
+
+// Ignored reports if glyph i is skipped by the lookup flags.
+func (c *otContext) ignored(lk *otLookup, i int) bool {
+	g := &c.buf[i]
+	switch g.class {
+	case 1:
+		return lk.flag&otIgnoreBases != 0
+	case 2:
+		return lk.flag&otIgnoreLigs != 0
+	case 3:
+		if lk.flag&otIgnoreMarks != 0 {
+			return true
+		}
+		if lk.flag&otUseMarkSet != 0 {
+			return !c.l.inMarkSet(lk.markSet, g.id)
+		}
+		if t := int(lk.flag >> 8); t != 0 {
+			return c.l.markAttachClass(g.id) != t
+		}
+	}
+	return false
+}
+
+// Next returns the next glyph after i which is not ignored, or -1.
+func (c *otContext) next(lk *otLookup, i int) int {
+	for j := i + 1; j < len(c.buf); j++ {
+		if c.syllables && c.buf[j].syllable != c.buf[i].syllable {
+			return -1
+		}
+		if !c.ignored(lk, j) {
+			return j
+		}
+	}
+	return -1
+}
+
+// Prev returns the previous glyph before i which is not ignored, or -1.
+func (c *otContext) prev(lk *otLookup, i int) int {
+	for j := i - 1; j >= 0; j-- {
+		if c.syllables && c.buf[j].syllable != c.buf[i].syllable {
+			return -1
+		}
+		if !c.ignored(lk, j) {
+			return j
+		}
+	}
+	return -1
+}
+
+// MatchInput matches the n-1 glyphs following glyph i, and returns the
+// positions of all n glyphs.
+func (c *otContext) matchInput(lk *otLookup, i, n int, match func(k, j int) bool) ([]int, bool) {
+	pos := make([]int, n)
+	pos[0] = i
+	for k, j := 1, i; k < n; k++ {
+		if j = c.next(lk, j); j < 0 || !match(k, j) {
+			return nil, false
+		}
+		pos[k] = j
+	}
+	return pos, true
+}
+
+// MatchBacktrack matches n glyphs before glyph i, going backwards.
+func (c *otContext) matchBacktrack(lk *otLookup, i, n int, match func(k, j int) bool) bool {
+	for k, j := 0, i; k < n; k++ {
+		if j = c.prev(lk, j); j < 0 || !match(k, j) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchLookahead matches n glyphs after glyph i.
+func (c *otContext) matchLookahead(lk *otLookup, i, n int, match func(k, j int) bool) bool {
+	for k, j := 0, i; k < n; k++ {
+		if j = c.next(lk, j); j < 0 || !match(k, j) {
+			return false
+		}
+	}
+	return true
+}
+
+// SetGlyph replaces the glyph id of glyph i.
+func (c *otContext) setGlyph(i int, id uint16) {
+	g := &c.buf[i]
+	g.id = id
+	g.subst = true
+	if c.l.hasGlyphClasses() {
+		g.class = c.l.glyphClass(id)
+	}
+}
+
+func (c *otContext) substitute(lk *otLookup, s, i int) (int, bool) {
+	t := c.t
+	g := c.buf[i].id
+	switch lk.typ {
+	case 1: // Single.
+		k := coverage(t, off16(t, s, s+2), g)
+		if k < 0 {
+			return i, false
+		}
+		switch u16(t, s) {
+		case 1:
+			c.setGlyph(i, g+u16(t, s+4))
+		case 2:
+			if k >= count(t, int(u16(t, s+4)), s+6, 2) {
+				return i, false
+			}
+			c.setGlyph(i, u16(t, s+6+2*k))
+		default:
+			return i, false
+		}
+		return i + 1, true
+
+	case 2, 3: // Multiple and alternate: a sequence or a set of glyphs.
+		k := coverage(t, off16(t, s, s+2), g)
+		if k < 0 || k >= count(t, int(u16(t, s+4)), s+6, 2) {
+			return i, false
+		}
+		x := s + int(u16(t, s+6+2*k))
+		n := count(t, int(u16(t, x)), x+2, 2)
+		if n == 0 {
+			return i, false
+		}
+		if lk.typ == 3 {
+			c.setGlyph(i, u16(t, x+2)) // The first alternate.
+			return i + 1, true
+		}
+		ids := make([]uint16, n)
+		for k := range ids {
+			ids[k] = u16(t, x+2+2*k)
+		}
+		c.multiple(i, ids)
+		return i + n, true
+
+	case 4: // Ligature.
+		k := coverage(t, off16(t, s, s+2), g)
+		if k < 0 || k >= count(t, int(u16(t, s+4)), s+6, 2) {
+			return i, false
+		}
+		set := s + int(u16(t, s+6+2*k))
+		nl := count(t, int(u16(t, set)), set+2, 2)
+		for l := 0; l < nl; l++ {
+			lig := set + int(u16(t, set+2+2*l))
+			n := int(u16(t, lig+2))
+			if n == 0 {
+				continue
+			}
+			pos, ok := c.matchInput(lk, i, n, func(k, j int) bool {
+				return c.buf[j].id == u16(t, lig+4+2*(k-1))
+			})
+			if ok {
+				c.ligate(pos, u16(t, lig))
+				return i + 1, true
+			}
+		}
+		return i, false
+
+	case 5:
+		return c.context(lk, s, i)
+
+	case 6:
+		return c.chainContext(lk, s, i)
+
+	case 8: // Reverse chaining contextual single.
+		k := coverage(t, off16(t, s, s+2), g)
+		if k < 0 {
+			return i, false
+		}
+		nb := int(u16(t, s+4))
+		x := s + 6 + 2*nb
+		nl := int(u16(t, x))
+		y := x + 2 + 2*nl
+		if k >= count(t, int(u16(t, y)), y+2, 2) {
+			return i, false
+		}
+		if !c.matchBacktrack(lk, i, nb, func(k, j int) bool {
+			return coverage(t, off16(t, s, s+6+2*k), c.buf[j].id) >= 0
+		}) || !c.matchLookahead(lk, i, nl, func(k, j int) bool {
+			return coverage(t, off16(t, s, x+2+2*k), c.buf[j].id) >= 0
+		}) {
+			return i, false
+		}
+		c.setGlyph(i, u16(t, y+2+2*k))
+		return i, true
+	}
+	return i, false
+}
+
+// Multiple replaces glyph i by a sequence of glyphs.
+func (c *otContext) multiple(i int, ids []uint16) {
+	gs := make([]otGlyph, len(ids))
+	for k, id := range ids {
+		gs[k] = c.buf[i]
+		gs[k].id = id
+		gs[k].subst = true
+		gs[k].ligated = false
+		if c.l.hasGlyphClasses() {
+			gs[k].class = c.l.glyphClass(id)
+		}
+	}
+	buf := make([]otGlyph, 0, len(c.buf)+len(ids)-1)
+	buf = append(buf, c.buf[:i]...)
+	buf = append(buf, gs...)
+	c.buf = append(buf, c.buf[i+1:]...)
+}
+
+// Ligate replaces the glyphs at pos by a ligature.
+// Marks which were skipped between the components stay after the ligature,
+// and remember the component they belong to for mark-to-ligature attachment.
+func (c *otContext) ligate(pos []int, id uint16) {
+	c.ligID++
+	marks := true
+	for _, j := range pos {
+		if c.buf[j].class != 3 {
+			marks = false
+		}
+	}
+	for k := 1; k < len(pos); k++ {
+		for j := pos[k-1] + 1; j < pos[k]; j++ {
+			if c.buf[j].class == 3 {
+				c.buf[j].ligID = c.ligID
+				c.buf[j].ligComp = uint8(k)
+			}
+		}
+	}
+	c.setGlyph(pos[0], id)
+	g := &c.buf[pos[0]]
+	g.ligated = true
+	if !c.l.hasGlyphClasses() && !marks {
+		g.class = 2
+	}
+	if !marks {
+		g.ligID, g.ligComp = c.ligID, 0
+	}
+	for k := len(pos) - 1; k >= 1; k-- {
+		c.buf = append(c.buf[:pos[k]], c.buf[pos[k]+1:]...)
+	}
+}
+
+// ApplyRecords applies the sequence lookup records at x to the matched glyphs.
+// It returns the index after the matched input.
+func (c *otContext) applyRecords(pos []int, x, n int) (int, bool) {
+	end := pos[len(pos)-1] + 1
+	if c.depth >= maxNesting {
+		return end, true
+	}
+	c.depth++
+	defer func() { c.depth-- }()
+	for r := 0; r < n; r++ {
+		seq := int(u16(c.t, x+4*r))
+		if seq >= len(pos) || pos[seq] < 0 || pos[seq] >= len(c.buf) {
+			continue
+		}
+		lk := lookup(c.t, int(u16(c.t, x+4*r+2)), c.gpos)
+		before := len(c.buf)
+		c.applyAt(&lk, pos[seq])
+		if d := len(c.buf) - before; d != 0 {
+			for k := seq + 1; k < len(pos); k++ {
+				pos[k] += d
+			}
+			end += d
+		}
+	}
+	return end, true
+}
+
+// Context applies a sequence context subtable (GSUB 5, GPOS 7).
+func (c *otContext) context(lk *otLookup, s, i int) (int, bool) {
+	t := c.t
+	g := c.buf[i].id
+	switch format := u16(t, s); format {
+	case 1, 2:
+		k := coverage(t, off16(t, s, s+2), g)
+		if k < 0 {
+			return i, false
+		}
+		def, sets := -1, s+4
+		if format == 2 {
+			def, sets = off16(t, s, s+4), s+6
+			k = classOf(t, def, g)
+		}
+		value := func(j int) uint16 {
+			if format == 1 {
+				return c.buf[j].id
+			}
+			return uint16(classOf(t, def, c.buf[j].id))
+		}
+		if k >= count(t, int(u16(t, sets)), sets+2, 2) {
+			return i, false
+		}
+		set := off16(t, s, sets+2+2*k)
+		if set < 0 {
+			return i, false
+		}
+		nr := count(t, int(u16(t, set)), set+2, 2)
+		for r := 0; r < nr; r++ {
+			rule := set + int(u16(t, set+2+2*r))
+			n, nrec := int(u16(t, rule)), int(u16(t, rule+2))
+			if n == 0 {
+				continue
+			}
+			pos, ok := c.matchInput(lk, i, n, func(k, j int) bool {
+				return value(j) == u16(t, rule+4+2*(k-1))
+			})
+			if ok {
+				return c.applyRecords(pos, rule+4+2*(n-1), nrec)
+			}
+		}
+
+	case 3:
+		n, nrec := int(u16(t, s+2)), int(u16(t, s+4))
+		if n == 0 || coverage(t, off16(t, s, s+6), g) < 0 {
+			return i, false
+		}
+		pos, ok := c.matchInput(lk, i, n, func(k, j int) bool {
+			return coverage(t, off16(t, s, s+6+2*k), c.buf[j].id) >= 0
+		})
+		if ok {
+			return c.applyRecords(pos, s+6+2*n, nrec)
+		}
+	}
+	return i, false
+}
+
+// ChainContext applies a chained sequence context subtable (GSUB 6, GPOS 8).
+func (c *otContext) chainContext(lk *otLookup, s, i int) (int, bool) {
+	t := c.t
+	g := c.buf[i].id
+	switch format := u16(t, s); format {
+	case 1, 2:
+		k := coverage(t, off16(t, s, s+2), g)
+		if k < 0 {
+			return i, false
+		}
+		defs := [3]int{-1, -1, -1} // Backtrack, input and lookahead classes.
+		sets := s + 4
+		if format == 2 {
+			for d := range defs {
+				defs[d] = off16(t, s, s+4+2*d)
+			}
+			sets = s + 10
+			k = classOf(t, defs[1], g)
+		}
+		value := func(d, j int) uint16 {
+			if format == 1 {
+				return c.buf[j].id
+			}
+			return uint16(classOf(t, defs[d], c.buf[j].id))
+		}
+		if k >= count(t, int(u16(t, sets)), sets+2, 2) {
+			return i, false
+		}
+		set := off16(t, s, sets+2+2*k)
+		if set < 0 {
+			return i, false
+		}
+		nr := count(t, int(u16(t, set)), set+2, 2)
+		for r := 0; r < nr; r++ {
+			x := set + int(u16(t, set+2+2*r))
+			nb := int(u16(t, x))
+			b := x + 2
+			x = b + 2*nb
+			n := int(u16(t, x))
+			in := x + 2
+			x = in + 2*(n-1)
+			nl := int(u16(t, x))
+			la := x + 2
+			x = la + 2*nl
+			nrec := int(u16(t, x))
+			if n == 0 {
+				continue
+			}
+			pos, ok := c.matchInput(lk, i, n, func(k, j int) bool {
+				return value(1, j) == u16(t, in+2*(k-1))
+			})
+			if !ok || !c.matchBacktrack(lk, i, nb, func(k, j int) bool {
+				return value(0, j) == u16(t, b+2*k)
+			}) || !c.matchLookahead(lk, pos[n-1], nl, func(k, j int) bool {
+				return value(2, j) == u16(t, la+2*k)
+			}) {
+				continue
+			}
+			return c.applyRecords(pos, x+2, nrec)
+		}
+
+	case 3:
+		nb := int(u16(t, s+2))
+		b := s + 4
+		x := b + 2*nb
+		n := int(u16(t, x))
+		in := x + 2
+		x = in + 2*n
+		nl := int(u16(t, x))
+		la := x + 2
+		x = la + 2*nl
+		nrec := int(u16(t, x))
+		if n == 0 || coverage(t, off16(t, s, in), g) < 0 {
+			return i, false
+		}
+		cov := func(x, j int) bool {
+			return coverage(t, off16(t, s, x), c.buf[j].id) >= 0
+		}
+		pos, ok := c.matchInput(lk, i, n, func(k, j int) bool { return cov(in+2*k, j) })
+		if !ok || !c.matchBacktrack(lk, i, nb, func(k, j int) bool {
+			return cov(b+2*k, j)
+		}) || !c.matchLookahead(lk, pos[n-1], nl, func(k, j int) bool {
+			return cov(la+2*k, j)
+		}) {
+			return i, false
+		}
+		return c.applyRecords(pos, x+2, nrec)
+	}
+	return i, false
+}
+
+// ValueSize returns the size of a value record of the given format.
+func valueSize(format uint16) int {
+	return 2 * bits.OnesCount16(format&0xFF)
+}
+
+// AddValue adds the value record at x to glyph i. Device tables are ignored.
+func (c *otContext) addValue(i, x int, format uint16) {
+	g := &c.buf[i]
+	if format&1 != 0 {
+		g.xOff += s16(c.t, x)
+		x += 2
+	}
+	if format&2 != 0 {
+		g.yOff += s16(c.t, x)
+		x += 2
+	}
+	if format&4 != 0 {
+		g.xAdv += s16(c.t, x)
+	}
+}
+
+func anchor(t []byte, x int) (int, int) {
+	return s16(t, x+2), s16(t, x+4)
+}
+
+// MarkRecord returns the class and anchor of the mark with coverage index k
+// in the mark array at x.
+func markRecord(t []byte, x, k int) (int, int, int, bool) {
+	if x < 0 || k >= count(t, int(u16(t, x)), x+2, 4) {
+		return 0, 0, 0, false
+	}
+	a := off16(t, x, x+2+4*k+2)
+	if a < 0 {
+		return 0, 0, 0, false
+	}
+	mx, my := anchor(t, a)
+	return int(u16(t, x+2+4*k)), mx, my, true
+}
+
+// AttachMark attaches mark i to glyph j, with their anchors at the same point.
+func (c *otContext) attachMark(i, j, dx, dy int) {
+	g := &c.buf[i]
+	g.xOff, g.yOff = dx, dy
+	g.attach, g.cursive = j-i, false
+}
+
+func (c *otContext) position(lk *otLookup, s, i int) (int, bool) {
+	t := c.t
+	g := c.buf[i].id
+	switch lk.typ {
+	case 1: // Single.
+		k := coverage(t, off16(t, s, s+2), g)
+		if k < 0 {
+			return i, false
+		}
+		format := u16(t, s+4)
+		switch u16(t, s) {
+		case 1:
+			c.addValue(i, s+6, format)
+		case 2:
+			if k >= int(u16(t, s+6)) {
+				return i, false
+			}
+			c.addValue(i, s+8+k*valueSize(format), format)
+		default:
+			return i, false
+		}
+		return i + 1, true
+
+	case 2: // Pair.
+		k := coverage(t, off16(t, s, s+2), g)
+		j := c.next(lk, i)
+		if k < 0 || j < 0 {
+			return i, false
+		}
+		f1, f2 := u16(t, s+4), u16(t, s+6)
+		s1, s2 := valueSize(f1), valueSize(f2)
+		var x int
+		switch u16(t, s) {
+		case 1:
+			if k >= count(t, int(u16(t, s+8)), s+10, 2) {
+				return i, false
+			}
+			set := s + int(u16(t, s+10+2*k))
+			size := 2 + s1 + s2
+			n := count(t, int(u16(t, set)), set+2, size)
+			g2 := c.buf[j].id
+			r := sort.Search(n, func(r int) bool { return u16(t, set+2+size*r) >= g2 })
+			if r == n || u16(t, set+2+size*r) != g2 {
+				return i, false
+			}
+			x = set + 2 + size*r + 2
+		case 2:
+			c1 := classOf(t, off16(t, s, s+8), g)
+			c2 := classOf(t, off16(t, s, s+10), c.buf[j].id)
+			n1, n2 := int(u16(t, s+12)), int(u16(t, s+14))
+			if c1 >= n1 || c2 >= n2 {
+				return i, false
+			}
+			x = s + 16 + (c1*n2+c2)*(s1+s2)
+			if x+s1+s2 > len(t) {
+				return i, false
+			}
+		default:
+			return i, false
+		}
+		c.addValue(i, x, f1)
+		c.addValue(j, x+s1, f2)
+		if f2 != 0 {
+			return j + 1, true
+		}
+		return j, true
+
+	case 3: // Cursive.
+		return c.cursive(lk, s, i)
+
+	case 4, 5: // Mark-to-base and mark-to-ligature.
+		mk := coverage(t, off16(t, s, s+2), g)
+		if mk < 0 {
+			return i, false
+		}
+		j := i - 1
+		for j >= 0 && c.buf[j].class == 3 {
+			j--
+		}
+		if j < 0 {
+			return i, false
+		}
+		bk := coverage(t, off16(t, s, s+4), c.buf[j].id)
+		nc := int(u16(t, s+6))
+		class, mx, my, ok := markRecord(t, off16(t, s, s+8), mk)
+		array := off16(t, s, s+10)
+		if bk < 0 || !ok || class >= nc || array < 0 {
+			return i, false
+		}
+		if lk.typ == 5 {
+			if bk >= count(t, int(u16(t, array)), array+2, 2) {
+				return i, false
+			}
+			array += int(u16(t, array+2+2*bk))
+			n := count(t, int(u16(t, array)), array+2, 2*nc)
+			if n == 0 {
+				return i, false
+			}
+			comp := n - 1
+			if m := c.buf[i]; m.ligID != 0 && m.ligID == c.buf[j].ligID && m.ligComp > 0 && int(m.ligComp) <= n {
+				comp = int(m.ligComp) - 1
+			}
+			bk = comp
+		} else if bk >= count(t, int(u16(t, array)), array+2, 2*nc) {
+			return i, false
+		}
+		a := off16(t, array, array+2+2*(bk*nc+class))
+		if a < 0 {
+			return i, false
+		}
+		bx, by := anchor(t, a)
+		c.attachMark(i, j, bx-mx, by-my)
+		return i + 1, true
+
+	case 6: // Mark-to-mark.
+		mk := coverage(t, off16(t, s, s+2), g)
+		j := c.prev(lk, i)
+		if mk < 0 || j < 0 || c.buf[j].class != 3 {
+			return i, false
+		}
+		m1, m2 := c.buf[i], c.buf[j]
+		if m1.ligID == m2.ligID {
+			if m1.ligID != 0 && m1.ligComp != m2.ligComp {
+				return i, false
+			}
+		} else if !(m1.ligID > 0 && m1.ligComp == 0 || m2.ligID > 0 && m2.ligComp == 0) {
+			return i, false
+		}
+		bk := coverage(t, off16(t, s, s+4), m2.id)
+		nc := int(u16(t, s+6))
+		class, mx, my, ok := markRecord(t, off16(t, s, s+8), mk)
+		array := off16(t, s, s+10)
+		if bk < 0 || !ok || class >= nc || array < 0 || bk >= count(t, int(u16(t, array)), array+2, 2*nc) {
+			return i, false
+		}
+		a := off16(t, array, array+2+2*(bk*nc+class))
+		if a < 0 {
+			return i, false
+		}
+		bx, by := anchor(t, a)
+		c.attachMark(i, j, bx-mx, by-my)
+		return i + 1, true
+
+	case 7:
+		return c.context(lk, s, i)
+
+	case 8:
+		return c.chainContext(lk, s, i)
+	}
+	return i, false
+}
+
+// Cursive connects the entry anchor of glyph i to the exit anchor of the
+// glyph before it, as HarfBuzz does.
+func (c *otContext) cursive(lk *otLookup, s, i int) (int, bool) {
+	t := c.t
+	entryExit := func(j int) (int, int) {
+		k := coverage(t, off16(t, s, s+2), c.buf[j].id)
+		if k < 0 || k >= count(t, int(u16(t, s+4)), s+6, 4) {
+			return -1, -1
+		}
+		return off16(t, s, s+6+4*k), off16(t, s, s+6+4*k+2)
+	}
+	entry, _ := entryExit(i)
+	if entry < 0 {
+		return i, false
+	}
+	j := c.prev(lk, i)
+	if j < 0 {
+		return i, false
+	}
+	_, exit := entryExit(j)
+	if exit < 0 {
+		return i, false
+	}
+	exitX, exitY := anchor(t, exit)
+	entryX, entryY := anchor(t, entry)
+	prev, cur := &c.buf[j], &c.buf[i]
+	if !c.rtl {
+		prev.xAdv = exitX + prev.xOff
+		d := entryX + cur.xOff
+		cur.xAdv -= d
+		cur.xOff -= d
+	} else {
+		d := exitX + prev.xOff
+		prev.xAdv -= d
+		prev.xOff -= d
+		cur.xAdv = entryX + cur.xOff
+	}
+
+	child, parent := j, i
+	dy := entryY - exitY
+	if lk.flag&otRightToLeft == 0 {
+		child, parent = i, j
+		dy = -dy
+	}
+	c.reverseCursive(child, parent)
+	c.buf[child].attach = parent - child
+	c.buf[child].cursive = true
+	c.buf[child].yOff = dy
+	return i + 1, true
+}
+
+// ReverseCursive reverses the cursive attachment chain of glyph i,
+// so it can become the child of another glyph.
+func (c *otContext) reverseCursive(i, parent int) {
+	g := &c.buf[i]
+	if g.attach == 0 || !g.cursive {
+		return
+	}
+	j := i + g.attach
+	g.attach = 0
+	if j == parent {
+		return
+	}
+	c.reverseCursive(j, parent)
+	c.buf[j].yOff = -g.yOff
+	c.buf[j].attach = i - j
+	c.buf[j].cursive = true
+}
+
+// WouldSubstitute reports if the lookups change the glyph sequence,
+// which tells the shaper if a font has a form, e.g. a below-base
+// form of a consonant.
+func (l *otLayout) wouldSubstitute(refs []otLookupRef, ids ...uint16) bool {
+	if l == nil || len(refs) == 0 {
+		return false
+	}
+	c := otContext{l: l, t: l.gsub, buf: make([]otGlyph, len(ids))}
+	for k, id := range ids {
+		c.buf[k] = otGlyph{id: id, mask: ^uint32(0), class: l.glyphClass(id)}
+	}
+	all := make([]otLookupRef, len(refs))
+	for k, r := range refs {
+		all[k] = otLookupRef{r.index, ^uint32(0)}
+	}
+	c.apply(all)
+	if len(c.buf) != len(ids) {
+		return true
+	}
+	for k, g := range c.buf {
+		if g.id != ids[k] {
+			return true
+		}
+	}
+	return false
+}
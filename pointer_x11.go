@@ -0,0 +1,171 @@
+// +build dragonfly freebsd linux netbsd openbsd solaris
+
+package duitdraw
+
+import (
+	"errors"
+	"fmt"
+	"image"
+
+	"github.com/BurntSushi/xgb/xfixes"
+	"github.com/BurntSushi/xgb/xproto"
+	"golang.org/x/exp/shiny/screen"
+)
+
+// The pointer cannot be grabbed with GrabPointer by our connection: while a button is
+// pressed, shiny's connection holds an implicit grab and the request fails.
+// Instead the pointer is confined by XFixes pointer barriers, and shiny
+// continues to receive the mouse events.
+
+var errNoXFixes = errors.New("duitdraw: the X server does not support XFixes 5")
+
+func hideCursor(w screen.Window, hide bool) error {
+	d, xw, err := x11DisplayWindow(w)
+	if err != nil {
+		return err
+	}
+	if !d.xfixes {
+		return errNoXFixes
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.hidden[xw] == hide {
+		return nil // XFixes counts hide requests.
+	}
+	if hide {
+		err = xfixes.HideCursorChecked(d.conn, xw).Check()
+		d.hidden[xw] = true
+	} else {
+		err = xfixes.ShowCursorChecked(d.conn, xw).Check()
+		delete(d.hidden, xw)
+	}
+	return err
+}
+
+func grabPointer(w screen.Window, r image.Rectangle) error {
+	d, xw, err := x11DisplayWindow(w)
+	if err != nil {
+		return err
+	}
+	if !d.xfixes {
+		return errNoXFixes
+	}
+	if r.Empty() {
+		return fmt.Errorf("GrabPointer: empty rectangle %v", r)
+	}
+	p, err := xproto.QueryPointer(d.conn, xw).Reply()
+	if err != nil {
+		return fmt.Errorf("QueryPointer: %v", err)
+	}
+	if pt := image.Pt(int(p.WinX), int(p.WinY)); !pt.In(r) {
+		pt = clampPoint(pt, r)
+		xproto.WarpPointer(d.conn, xproto.WindowNone, xw, 0, 0, 0, 0, int16(pt.X), int16(pt.Y))
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.grabs[xw] = &pointerGrab{r: r}
+	return d.confine(xw)
+}
+
+func ungrabPointer(w screen.Window) {
+	xw := x11Window(w)
+	if xw == 0 {
+		return
+	}
+	d, err := getX11Display()
+	if err != nil {
+		return
+	}
+	d.mu.Lock()
+	d.ungrab(xw)
+	d.mu.Unlock()
+}
+
+// PointerGrab is the confinement of the pointer to a rectangle of a window.
+type pointerGrab struct {
+	r        image.Rectangle // In window coordinates.
+	barriers []xfixes.Barrier
+}
+
+// Confine creates the barriers of the grab of window xw at the current position
+// of the window. It is called again, when the window moves.
+// The caller holds d.mu.
+func (d *x11Display) confine(xw xproto.Window) error {
+	g := d.grabs[xw]
+	if g == nil {
+		return nil
+	}
+	d.deleteBarriers(g)
+	t, err := xproto.TranslateCoordinates(d.conn, xw, d.root, 0, 0).Reply()
+	if err != nil {
+		delete(d.grabs, xw)
+		return fmt.Errorf("TranslateCoordinates: %v", err)
+	}
+	for _, l := range barrierLines(g.r.Add(image.Pt(int(t.DstX), int(t.DstY)))) {
+		b, err := xfixes.NewBarrierId(d.conn)
+		if err == nil {
+			err = xfixes.CreatePointerBarrierChecked(d.conn, b, d.root,
+				uint16(l.Min.X), uint16(l.Min.Y), uint16(l.Max.X), uint16(l.Max.Y),
+				0, 0, nil, // Block all directions for all devices.
+			).Check()
+		}
+		if err != nil {
+			d.ungrab(xw)
+			return fmt.Errorf("CreatePointerBarrier: %v", err)
+		}
+		g.barriers = append(g.barriers, b)
+	}
+	return nil
+}
+
+// Ungrab releases the grab of window xw. The caller holds d.mu.
+func (d *x11Display) ungrab(xw xproto.Window) {
+	if g := d.grabs[xw]; g != nil {
+		d.deleteBarriers(g)
+		delete(d.grabs, xw)
+	}
+}
+
+func (d *x11Display) deleteBarriers(g *pointerGrab) {
+	for _, b := range g.barriers {
+		xfixes.DeletePointerBarrier(d.conn, b)
+	}
+	g.barriers = nil
+}
+
+// BarrierLines returns the barriers which keep the pointer inside r.
+// A pointer which moves in positive direction stops in front of a barrier,
+// and in negative direction on it.
+func barrierLines(r image.Rectangle) [4]image.Rectangle {
+	return [4]image.Rectangle{
+		{r.Min, image.Pt(r.Min.X, r.Max.Y)}, // Left.
+		{image.Pt(r.Max.X, r.Min.Y), r.Max}, // Right.
+		{r.Min, image.Pt(r.Max.X, r.Min.Y)}, // Top.
+		{image.Pt(r.Min.X, r.Max.Y), r.Max}, // Bottom.
+	}
+}
+
+// ClampPoint returns the point of r which is closest to p.
+func clampPoint(p image.Point, r image.Rectangle) image.Point {
+	if p.X < r.Min.X {
+		p.X = r.Min.X
+	} else if p.X >= r.Max.X {
+		p.X = r.Max.X - 1
+	}
+	if p.Y < r.Min.Y {
+		p.Y = r.Min.Y
+	} else if p.Y >= r.Max.Y {
+		p.Y = r.Max.Y - 1
+	}
+	return p
+}
+
+// InitXFixes initializes the XFixes extension.
+// Version 5 is needed for pointer barriers.
+func initXFixes(d *x11Display) bool {
+	if xfixes.Init(d.conn) != nil {
+		return false
+	}
+	v, err := xfixes.QueryVersion(d.conn, 5, 0).Reply()
+	return err == nil && v.MajorVersion >= 5
+}
@@ -0,0 +1,576 @@
+package duitdraw
+
+import (
+	"math"
+	"sort"
+	"unicode"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/math/fixed"
+)
+
+// A Glyph is a glyph of a shaped string.
+// This type is not present in 9fans draw package.
+type Glyph struct {
+	Font    *Font           // Font of the glyph, f or a font of its fallback chain.
+	Index   int             // Glyph index in the font file, 0 for Plan 9 fonts and registered faces.
+	Rune    rune            // Rune the glyph is drawn for, or -1 if it is drawn by Index.
+	Advance fixed.Int26_6   // Horizontal advance.
+	Offset  fixed.Point26_6 // Offset from the pen position, y grows downwards.
+}
+
+// A Shaper converts a string to glyphs for a font with the Shape option.
+// Shape returns the glyphs in visual order, from left to right.
+// This type is not present in 9fans draw package.
+//
+// The built-in shaper reorders bidirectional text with the Unicode
+// bidirectional algorithm and applies the OpenType GSUB and GPOS
+// tables of truetype fonts. Arabic, Syriac and N'Ko text is joined
+// with the isol, fina, medi and init features, and Indic text from
+// Devanagari to Malayalam is reordered by syllable as described in
+// the OpenType specification for Indic scripts. The built-in shaper
+// does not support pre-base reordering consonants (pref), and shapes
+// fonts with old Indic script tags like fonts with new ones.
+//
+// Fonts without GSUB features for Arabic fall back to the Unicode
+// presentation forms, if the font has glyphs for them.
+type Shaper interface {
+	Shape(f *Font, s string) []Glyph
+}
+
+type builtinShaper struct{}
+
+// Shape returns the glyphs of s in visual order.
+func (f *Font) shape(s string) []Glyph {
+	if f.Shaper != nil {
+		return f.Shaper.Shape(f, s)
+	}
+	return builtinShaper{}.Shape(f, s)
+}
+
+func (builtinShaper) Shape(f *Font, s string) []Glyph {
+	rs := []rune(s)
+	levels := make([]int8, len(rs))
+	if hasRTL(s) {
+		levels, _, _ = bidiLevels(rs, -1)
+	}
+	forms := joiningForms(rs)
+
+	var out []Glyph
+	for start := 0; start < len(rs); {
+		end := start
+		for end < len(rs) && bidiClassOf(rs[end]) != bidiB {
+			end++
+		}
+		runs := itemize(f, rs, levels, start, end)
+		rl := make([]int8, len(runs))
+		for i, r := range runs {
+			rl[i] = r.level
+		}
+		for _, i := range bidiReorder(rl) {
+			out = append(out, runs[i].shape(rs, forms)...)
+		}
+		// The paragraph separator stays at the end of its paragraph.
+		if end < len(rs) {
+			for _, run := range itemize(f, rs, levels, end, end+1) {
+				out = append(out, run.shape(rs, forms)...)
+			}
+			end++
+		}
+		start = end
+	}
+	return out
+}
+
+// A shapeRun is a sequence of runes with the same embedding level,
+// script and font.
+type shapeRun struct {
+	font       *Font
+	start, end int
+	level      int8
+	script     *otScript
+}
+
+// Itemize splits the runes of a paragraph into runs.
+// Runes of no particular script, like marks and punctuation,
+// join the previous run if its font has a glyph for them.
+func itemize(f *Font, rs []rune, levels []int8, start, end int) []shapeRun {
+	var runs []shapeRun
+	for i := start; i < end; i++ {
+		r := rs[i]
+		g, sc := f.fontFor(r), scriptOf(r)
+		if n := len(runs); n > 0 {
+			last := &runs[n-1]
+			if last.level == levels[i] && (sc == nil || last.script == nil || sc == last.script) &&
+				(g == last.font || sc == nil && (last.font.hasGlyph(r) || isIgnorable(r))) {
+				if last.script == nil {
+					last.script = sc
+				}
+				last.end = i + 1
+				continue
+			}
+		}
+		runs = append(runs, shapeRun{font: g, start: i, end: i + 1, level: levels[i], script: sc})
+	}
+	return runs
+}
+
+// IsIgnorable reports if r is a format character, like a joiner,
+// which is not drawn if the font has no glyph for it.
+func isIgnorable(r rune) bool {
+	return unicode.Is(unicode.Cf, r)
+}
+
+// Kinds of shapers.
+const (
+	shapeDefault = iota
+	shapeArabic
+	shapeIndic
+)
+
+// OtScript is a script with its OpenType tags and shaper.
+type otScript struct {
+	tags  []string // Script tags, the preferred first.
+	kind  int
+	indic *indicScript
+}
+
+var (
+	scriptLatin = &otScript{tags: []string{"latn"}}
+
+	otScripts = []struct {
+		table  *unicode.RangeTable
+		script *otScript
+	}{
+		{unicode.Latin, scriptLatin},
+		{unicode.Greek, &otScript{tags: []string{"grek"}}},
+		{unicode.Cyrillic, &otScript{tags: []string{"cyrl"}}},
+		{unicode.Armenian, &otScript{tags: []string{"armn"}}},
+		{unicode.Hebrew, &otScript{tags: []string{"hebr"}}},
+		{unicode.Arabic, &otScript{tags: []string{"arab"}, kind: shapeArabic}},
+		{unicode.Syriac, &otScript{tags: []string{"syrc"}, kind: shapeArabic}},
+		{unicode.Thaana, &otScript{tags: []string{"thaa"}}},
+		{unicode.Nko, &otScript{tags: []string{"nko "}, kind: shapeArabic}},
+		{unicode.Devanagari, &otScript{tags: []string{"dev2", "deva"}, kind: shapeIndic, indic: &indicDevanagari}},
+		{unicode.Bengali, &otScript{tags: []string{"bng2", "beng"}, kind: shapeIndic, indic: &indicBengali}},
+		{unicode.Gurmukhi, &otScript{tags: []string{"gur2", "guru"}, kind: shapeIndic, indic: &indicGurmukhi}},
+		{unicode.Gujarati, &otScript{tags: []string{"gjr2", "gujr"}, kind: shapeIndic, indic: &indicGujarati}},
+		{unicode.Oriya, &otScript{tags: []string{"ory2", "orya"}, kind: shapeIndic, indic: &indicOriya}},
+		{unicode.Tamil, &otScript{tags: []string{"tml2", "taml"}, kind: shapeIndic, indic: &indicTamil}},
+		{unicode.Telugu, &otScript{tags: []string{"tel2", "telu"}, kind: shapeIndic, indic: &indicTelugu}},
+		{unicode.Kannada, &otScript{tags: []string{"knd2", "knda"}, kind: shapeIndic, indic: &indicKannada}},
+		{unicode.Malayalam, &otScript{tags: []string{"mlm2", "mlym"}, kind: shapeIndic, indic: &indicMalayalam}},
+		{unicode.Thai, &otScript{tags: []string{"thai"}}},
+		{unicode.Lao, &otScript{tags: []string{"lao "}}},
+		{unicode.Georgian, &otScript{tags: []string{"geor"}}},
+		{unicode.Hangul, &otScript{tags: []string{"hang"}}},
+		{unicode.Hiragana, &otScript{tags: []string{"kana"}}},
+		{unicode.Katakana, &otScript{tags: []string{"kana"}}},
+		{unicode.Han, &otScript{tags: []string{"hani"}}},
+	}
+)
+
+// ScriptOf returns the script of r, or nil for runes which are used with
+// several scripts, and for scripts which are shaped with the default tags.
+func scriptOf(r rune) *otScript {
+	if r < 0x80 {
+		if unicode.IsLetter(r) {
+			return scriptLatin
+		}
+		return nil
+	}
+	for _, s := range otScripts {
+		if unicode.Is(s.table, r) {
+			return s.script
+		}
+	}
+	return nil
+}
+
+// Feature masks. Global features apply to all glyphs,
+// the others to glyphs selected by the script shaper.
+const (
+	maskGlobal = 1 << iota
+	maskIsol
+	maskFina
+	maskMedi
+	maskInit
+	maskRphf
+	maskHalf
+	maskPost // Below-base, above-base and post-base forms.
+)
+
+// OtPlan holds the lookups for a script of a font file, by shaping stage.
+type otPlan struct {
+	kind     int
+	gsub     [][]otLookupRef
+	gpos     []otLookupRef
+	marks    bool // GPOS positions marks.
+	kern     bool // GPOS has kerning.
+	fallback bool // Arabic joining uses presentation forms.
+	newSpec  bool // The font has new Indic script tags.
+
+	// Lookups of Indic features, to find which forms the font has.
+	rphf, blwf, pstf []otLookupRef
+	consonants       map[uint16]uint8 // Consonant positions by glyph.
+}
+
+func globalFeatures(tags ...string) []otFeature {
+	fs := make([]otFeature, len(tags))
+	for i, t := range tags {
+		fs[i] = otFeature{t, maskGlobal}
+	}
+	return fs
+}
+
+// Plan returns the shaping plan of a script for the layout tables.
+// L may be nil, which gives a plan without lookups.
+func (l *otLayout) plan(sc *otScript, kern bool) *otPlan {
+	kind := shapeDefault
+	var tags []string
+	if sc != nil {
+		kind, tags = sc.kind, sc.tags
+	}
+	if l == nil {
+		return &otPlan{kind: kind, fallback: true, newSpec: true}
+	}
+	key := "DFLT"
+	if len(tags) > 0 {
+		key = tags[0]
+	}
+	if kern {
+		key += "+kern"
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if p, ok := l.plans[key]; ok {
+		return p
+	}
+
+	tags = append(tags[:len(tags):len(tags)], "DFLT", "dflt", "latn")
+	gsub, gsubTag := langSys(l.gsub, tags)
+	gpos, gposTag := langSys(l.gpos, tags)
+	p := &otPlan{kind: kind, consonants: make(map[uint16]uint8)}
+	stage := func(fs ...otFeature) []otLookupRef {
+		refs := lookups(l.gsub, gsub, fs, maskGlobal)
+		p.gsub = append(p.gsub, refs)
+		return refs
+	}
+	positioning := []otFeature{{"abvm", maskGlobal}, {"blwm", maskGlobal}, {"curs", maskGlobal},
+		{"dist", maskGlobal}, {"mark", maskGlobal}, {"mkmk", maskGlobal}}
+	switch kind {
+	case shapeDefault:
+		stage(globalFeatures("ccmp", "locl", "rlig", "calt", "clig", "liga", "rclt")...)
+	case shapeArabic:
+		stage(globalFeatures("ccmp", "locl")...)
+		n := len(stage(otFeature{"isol", maskIsol})) + len(stage(otFeature{"fina", maskFina})) +
+			len(stage(otFeature{"medi", maskMedi})) + len(stage(otFeature{"init", maskInit}))
+		p.fallback = n == 0
+		stage(globalFeatures("rlig")...)
+		stage(globalFeatures("calt")...)
+		stage(globalFeatures("liga", "clig", "mset", "rclt")...)
+	case shapeIndic:
+		tag := gsubTag
+		if gsub < 0 {
+			tag = gposTag
+		}
+		p.newSpec = tag == "" || tag == sc.tags[0]
+		stage(globalFeatures("locl", "ccmp")...)
+		stage(globalFeatures("nukt")...)
+		stage(globalFeatures("akhn")...)
+		p.rphf = stage(otFeature{"rphf", maskRphf})
+		stage(globalFeatures("rkrf")...)
+		p.blwf = stage(otFeature{"blwf", maskPost})
+		stage(otFeature{"abvf", maskPost})
+		stage(otFeature{"half", maskHalf})
+		p.pstf = stage(otFeature{"pstf", maskPost})
+		stage(globalFeatures("vatu")...)
+		stage(globalFeatures("cjct")...)
+		stage(append(globalFeatures("pres", "abvs", "blws", "psts", "haln", "calt", "clig", "liga", "rclt"),
+			otFeature{"init", maskInit})...)
+	}
+	if kern {
+		positioning = append(positioning, otFeature{"kern", maskGlobal})
+		p.kern = len(lookups(l.gpos, gpos, []otFeature{{"kern", maskGlobal}}, 0)) > 0
+	}
+	p.gpos = lookups(l.gpos, gpos, positioning, maskGlobal)
+	p.marks = len(lookups(l.gpos, gpos, []otFeature{{"mark", maskGlobal}}, 0)) > 0
+	l.plans[key] = p
+	return p
+}
+
+// Layout returns the layout tables of the font file, or nil.
+func (f *Font) otLayout() *otLayout {
+	if f.file == nil {
+		return nil
+	}
+	return f.file.layout
+}
+
+// Index returns the glyph index of r in the font file, or 0.
+func (f *Font) index(r rune) uint16 {
+	if f.file == nil {
+		return 0
+	}
+	return uint16(f.file.ttf.Index(r))
+}
+
+// Shape returns the glyphs of the run in visual order.
+func (run *shapeRun) shape(rs []rune, forms []uint8) []Glyph {
+	f := run.font
+	l := f.otLayout()
+	rtl := run.level&1 != 0
+	p := l.plan(run.script, f.Kern)
+
+	buf := make([]otGlyph, 0, run.end-run.start)
+	for i := run.start; i < run.end; i++ {
+		r := rs[i]
+		if rtl {
+			if m := mirrorRune(r); m != r && f.hasGlyph(m) {
+				r = m
+			}
+		}
+		g := otGlyph{r: r, cluster: i, mask: maskGlobal}
+		if forms != nil {
+			g.mask |= formMasks[forms[i]]
+		}
+		buf = append(buf, g)
+	}
+	if p.kind == shapeIndic {
+		buf = indicDecompose(buf)
+	}
+	for i := range buf {
+		buf[i].id = f.index(buf[i].r)
+		buf[i].class = glyphClass(l, buf[i].id, buf[i].r)
+	}
+
+	c := otContext{l: l, rtl: rtl, buf: buf}
+	if l != nil {
+		c.t = l.gsub
+	}
+	switch p.kind {
+	case shapeIndic:
+		p.shapeIndic(f, &c, rs, run.script.indic)
+	case shapeArabic:
+		if p.fallback {
+			c.buf = arabicFallback(f, c.buf)
+		}
+		fallthrough
+	default:
+		for _, refs := range p.gsub {
+			c.apply(refs)
+		}
+	}
+	return p.position(f, &c)
+}
+
+// GlyphClass returns the GDEF class of a glyph, or a class derived from
+// the general category of r if the font has no GDEF glyph classes.
+func glyphClass(l *otLayout, id uint16, r rune) uint8 {
+	if l.hasGlyphClasses() {
+		return l.glyphClass(id)
+	}
+	if unicode.In(r, unicode.Mn, unicode.Me) {
+		return 3
+	}
+	return 1
+}
+
+// Position applies GPOS to the substituted glyphs and returns them in visual order.
+func (p *otPlan) position(f *Font, c *otContext) []Glyph {
+	var upem int
+	h := make([]int, len(c.buf))
+	if f.file != nil {
+		upem = int(f.file.ttf.FUnitsPerEm())
+		for i := range c.buf {
+			h[i] = int(f.file.ttf.HMetric(fixed.Int26_6(upem), truetype.Index(c.buf[i].id)).AdvanceWidth)
+			c.buf[i].xAdv = h[i]
+		}
+	}
+	if c.l != nil {
+		c.t, c.gpos, c.syllables = c.l.gpos, true, false
+		c.apply(p.gpos)
+	}
+	units := func(v int) fixed.Int26_6 {
+		if upem == 0 {
+			return 0
+		}
+		return fixed.Int26_6(math.Round(float64(v) * float64(f.scale()) / float64(upem)))
+	}
+
+	n := len(c.buf)
+	adv := make([]fixed.Int26_6, n)
+	for i, g := range c.buf {
+		var a fixed.Int26_6
+		if g.subst {
+			a = f.indexAdvance(g.id)
+		} else {
+			a, _ = f.advance(g.r)
+		}
+		if d := units(g.xAdv - h[i]); !f.Kern {
+			a += fixed.I(d.Round())
+		} else {
+			a += d
+		}
+		if p.kind != shapeIndic && g.class == 3 && (c.l == nil || c.l.hasGlyphClasses()) {
+			if !p.marks && g.attach == 0 {
+				c.buf[i].xOff -= g.xAdv
+			}
+			a = 0
+		}
+		adv[i] = a
+	}
+
+	// Pen positions of the glyphs relative to the start of the run,
+	// which is the right end of right-to-left runs.
+	pen := make([]fixed.Int26_6, n)
+	for i := 1; i < n; i++ {
+		pen[i] = pen[i-1] + adv[i-1]
+	}
+	if c.rtl {
+		var x fixed.Int26_6
+		for i := n - 1; i >= 0; i-- {
+			pen[i] = x
+			x += adv[i]
+		}
+	}
+
+	// Offsets of attached glyphs are relative to the glyph they are attached to.
+	off := make([]fixed.Point26_6, n)
+	done := make([]bool, n)
+	var resolve func(i int)
+	resolve = func(i int) {
+		if done[i] {
+			return
+		}
+		done[i] = true
+		g := c.buf[i]
+		off[i] = fixed.Point26_6{X: units(g.xOff), Y: units(g.yOff)}
+		j := i + g.attach
+		if g.attach == 0 || j < 0 || j >= n {
+			return
+		}
+		resolve(j)
+		off[i].Y += off[j].Y
+		if !g.cursive {
+			off[i].X += off[j].X + pen[j] - pen[i]
+		}
+	}
+
+	// Right-to-left glyphs are reversed. Unless GPOS positions them,
+	// marks stay after their base, where fonts draw them.
+	order := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		order = append(order, i)
+	}
+	if c.rtl {
+		order = order[:0]
+		for i := n - 1; i >= 0; i-- {
+			j := i
+			for j > 0 && !p.marks && adv[j] == 0 && c.buf[j].class == 3 && c.buf[j].attach == 0 {
+				j--
+			}
+			for k := j; k <= i; k++ {
+				order = append(order, k)
+			}
+			i = j
+		}
+	}
+
+	out := make([]Glyph, 0, n)
+	for _, i := range order {
+		resolve(i)
+		g := c.buf[i]
+		if !g.subst && (isBidiControl(g.r) || isIgnorable(g.r) && !f.hasGlyph(g.r)) {
+			continue
+		}
+		gl := Glyph{
+			Font:    f,
+			Index:   int(g.id),
+			Rune:    g.r,
+			Advance: adv[i],
+			Offset:  fixed.Point26_6{X: off[i].X, Y: -fixed.I(off[i].Y.Round())},
+		}
+		if g.subst {
+			gl.Rune = -1
+		}
+		if m := len(out); m > 0 && !p.kern && gl.Rune >= 0 && out[m-1].Rune >= 0 {
+			out[m-1].Advance += f.kern(out[m-1].Rune, gl.Rune)
+		}
+		out = append(out, gl)
+	}
+	return out
+}
+
+type joining uint8
+
+const (
+	joinU joining = iota // Non-joining.
+	joinR                // Joins the previous letter.
+	joinL                // Joins the next letter.
+	joinD                // Joins both sides.
+	joinC                // Join causing, like tatweel and zero width joiner.
+	joinT                // Transparent, like marks.
+)
+
+// JoiningOf returns the joining type of r.
+func joiningOf(r rune) joining {
+	i := sort.Search(len(joiningTypes), func(i int) bool { return joiningTypes[i].hi >= r })
+	if i < len(joiningTypes) && joiningTypes[i].lo <= r {
+		return joiningTypes[i].typ
+	}
+	if unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) {
+		return joinT
+	}
+	return joinU
+}
+
+// Arabic joining forms.
+const (
+	formNone = iota
+	formIsol
+	formFina
+	formMedi
+	formInit
+)
+
+var formMasks = [...]uint32{0, maskIsol, maskFina, maskMedi, maskInit}
+
+// JoiningForms returns the joining form of each rune, or nil if s has
+// no joining letters. Transparent runes are skipped, so marks do not
+// break joining.
+func joiningForms(rs []rune) []uint8 {
+	var forms []uint8
+	prev := -1 // The previous rune which is not transparent.
+	for i, r := range rs {
+		jt := joiningOf(r)
+		if jt == joinT {
+			continue
+		}
+		if forms == nil && jt != joinU {
+			forms = make([]uint8, len(rs))
+		}
+		if prev >= 0 && forms != nil {
+			pt := joiningOf(rs[prev])
+			if (pt == joinD || pt == joinL || pt == joinC) && (jt == joinD || jt == joinR || jt == joinC) {
+				// Prev joins its next letter and r joins its previous one.
+				switch forms[prev] {
+				case formIsol:
+					forms[prev] = formInit
+				case formFina:
+					forms[prev] = formMedi
+				}
+				if jt != joinC {
+					forms[i] = formFina
+				}
+				prev = i
+				continue
+			}
+		}
+		if jt == joinD || jt == joinR || jt == joinL {
+			forms[i] = formIsol
+		}
+		prev = i
+	}
+	return forms
+}
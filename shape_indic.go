@@ -0,0 +1,548 @@
+package duitdraw
+
+import (
+	"sort"
+	"unicode"
+)
+
+// Indic categories of runes.
+const (
+	indicX     uint8 = iota // Other.
+	indicC                  // Consonant, or placeholder.
+	indicRa                 // Ra, which may become a reph.
+	indicV                  // Independent vowel.
+	indicN                  // Nukta.
+	indicH                  // Halant.
+	indicM                  // Dependent vowel, a matra.
+	indicSM                 // Syllable modifier, like a bindu or visarga.
+	indicRepha              // Preceding repha.
+	indicZWJ
+	indicZWNJ
+)
+
+// Positions of glyphs in an Indic syllable, in their visual order.
+const (
+	posStart uint8 = iota
+	posRaToBecomeReph
+	posPreM
+	posPreC
+	posBaseC
+	posAfterMain
+	posAboveC
+	posBeforeSub
+	posBelowC
+	posAfterSub
+	posBeforePost
+	posPostC
+	posAfterPost
+	posSMVD
+	posEnd
+
+	// Matra positions of indicCategories, which each script maps
+	// to a position in the syllable.
+	posAboveM
+	posBelowM
+	posPostM
+	posNone
+)
+
+// Reph modes.
+const (
+	rephImplicit = iota // Ra and halant.
+	rephExplicit        // Ra, halant and zero width joiner.
+	rephLog             // A repha character.
+)
+
+// IndicScript holds what differs between the Indic scripts.
+type indicScript struct {
+	block              rune // First code point of the Unicode block.
+	rephPos            uint8
+	rephMode           int
+	right, top, bottom uint8 // Positions of matras.
+	afterHalant        bool  // Pre-base matras move after the last halant.
+}
+
+var (
+	indicDevanagari = indicScript{0x0900, posBeforePost, rephImplicit, posAfterSub, posAfterSub, posAfterSub, true}
+	indicBengali    = indicScript{0x0980, posAfterSub, rephImplicit, posAfterPost, posAfterSub, posAfterSub, true}
+	indicGurmukhi   = indicScript{0x0A00, posBeforeSub, rephImplicit, posAfterPost, posAfterPost, posAfterPost, true}
+	indicGujarati   = indicScript{0x0A80, posBeforePost, rephImplicit, posAfterPost, posAfterSub, posAfterPost, true}
+	indicOriya      = indicScript{0x0B00, posAfterMain, rephImplicit, posAfterPost, posAfterMain, posAfterSub, true}
+	indicTamil      = indicScript{0x0B80, posAfterPost, rephImplicit, posAfterPost, posAfterSub, posAfterPost, false}
+	indicTelugu     = indicScript{0x0C00, posAfterPost, rephExplicit, posBeforeSub, posBeforeSub, posBeforeSub, true}
+	indicKannada    = indicScript{0x0C80, posAfterPost, rephImplicit, posBeforeSub, posBeforeSub, posBeforeSub, true}
+	indicMalayalam  = indicScript{0x0D00, posAfterMain, rephLog, posAfterPost, posAfterSub, posAfterPost, false}
+)
+
+// IndicSplit decomposes two-part vowel signs into a pre-base and a post-base part.
+var indicSplit = map[rune][2]rune{
+	0x09CB: {0x09C7, 0x09BE},
+	0x09CC: {0x09C7, 0x09D7},
+	0x0B48: {0x0B47, 0x0B56},
+	0x0B4B: {0x0B47, 0x0B3E},
+	0x0B4C: {0x0B47, 0x0B57},
+	0x0BCA: {0x0BC6, 0x0BBE},
+	0x0BCB: {0x0BC7, 0x0BBE},
+	0x0BCC: {0x0BC6, 0x0BD7},
+	0x0D4A: {0x0D46, 0x0D3E},
+	0x0D4B: {0x0D47, 0x0D3E},
+	0x0D4C: {0x0D46, 0x0D57},
+}
+
+// IndicDecompose splits two-part vowel signs, as their parts are
+// positioned separately.
+func indicDecompose(buf []otGlyph) []otGlyph {
+	out := make([]otGlyph, 0, len(buf))
+	for _, g := range buf {
+		if split, ok := indicSplit[g.r]; ok {
+			g.r = split[0]
+			out = append(out, g)
+			g.r = split[1]
+		}
+		out = append(out, g)
+	}
+	return out
+}
+
+// IndicCategory returns the category and initial position of r.
+func indicCategory(r rune, sc *indicScript) (uint8, uint8) {
+	switch r {
+	case 0x200C:
+		return indicZWNJ, posEnd
+	case 0x200D:
+		return indicZWJ, posEnd
+	case 0x00A0, 0x25CC:
+		return indicC, posBaseC
+	}
+	i := sort.Search(len(indicCategories), func(i int) bool { return indicCategories[i].hi >= r })
+	if i == len(indicCategories) || indicCategories[i].lo > r {
+		return indicX, posEnd
+	}
+	e := indicCategories[i]
+	switch e.cat {
+	case indicC:
+		if sc.rephMode != rephLog && (r == sc.block+0x30 || r == 0x09F0) {
+			return indicRa, posBaseC
+		}
+		return indicC, posBaseC
+	case indicV:
+		return indicV, posBaseC
+	case indicM:
+		switch e.pos {
+		case posPostM:
+			return indicM, sc.right
+		case posAboveM:
+			return indicM, sc.top
+		case posBelowM:
+			return indicM, sc.bottom
+		}
+		return indicM, posPreM
+	case indicSM:
+		return indicSM, posSMVD
+	case indicX:
+		if e.pos != posNone {
+			return indicSM, posSMVD
+		}
+	}
+	return e.cat, posEnd
+}
+
+func isConsonant(g *otGlyph) bool {
+	return g.cat == indicC || g.cat == indicRa || g.cat == indicV
+}
+
+func isJoiner(g *otGlyph) bool {
+	return g.cat == indicZWJ || g.cat == indicZWNJ
+}
+
+// ShapeIndic substitutes the glyphs of an Indic run. Glyphs are reordered
+// by syllable before and after the basic shaping forms are applied.
+func (p *otPlan) shapeIndic(f *Font, c *otContext, rs []rune, sc *indicScript) {
+	virama := f.index(sc.block + 0x4D)
+	for i := range c.buf {
+		g := &c.buf[i]
+		g.cat, g.pos = indicCategory(g.r, sc)
+		if g.cat == indicC || g.cat == indicRa {
+			g.pos = p.consonantPosition(c.l, g.id, virama)
+		}
+	}
+	c.buf = p.syllables(f, c.l, c.buf)
+	c.syllables = true
+
+	stages := p.gsub
+	if len(stages) == 0 {
+		stages = make([][]otLookupRef, 2)
+	}
+	c.apply(stages[0])
+	eachSyllable(c.buf, func(start, end int) { p.initialReorder(c, sc, start, end) })
+	for _, refs := range stages[1 : len(stages)-1] {
+		c.apply(refs)
+	}
+	eachSyllable(c.buf, func(start, end int) { p.finalReorder(c, sc, rs, start, end) })
+	c.apply(stages[len(stages)-1])
+}
+
+// ConsonantPosition returns if a consonant has a below-base or post-base form.
+func (p *otPlan) consonantPosition(l *otLayout, id, virama uint16) uint8 {
+	if l == nil {
+		return posBaseC
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if pos, ok := p.consonants[id]; ok {
+		return pos
+	}
+	pos := posBaseC
+	switch {
+	case l.wouldSubstitute(p.blwf, virama, id) || l.wouldSubstitute(p.blwf, id, virama):
+		pos = posBelowC
+	case l.wouldSubstitute(p.pstf, virama, id) || l.wouldSubstitute(p.pstf, id, virama):
+		pos = posPostC
+	}
+	p.consonants[id] = pos
+	return pos
+}
+
+// EachSyllable calls fn for the glyphs of each syllable.
+func eachSyllable(buf []otGlyph, fn func(start, end int)) {
+	for start := 0; start < len(buf); {
+		end := start + 1
+		for end < len(buf) && buf[end].syllable == buf[start].syllable {
+			end++
+		}
+		fn(start, end)
+		start = end
+	}
+}
+
+// Syllables numbers the syllables of the buffer. A dotted circle is
+// inserted before marks which do not follow a consonant or vowel,
+// if the font has a glyph for it.
+func (p *otPlan) syllables(f *Font, l *otLayout, buf []otGlyph) []otGlyph {
+	out := make([]otGlyph, 0, len(buf))
+	n := len(buf)
+	var syl uint16
+	for i := 0; i < n; {
+		start := i
+		syl++
+		switch buf[i].cat {
+		case indicRepha, indicC, indicRa, indicV:
+			if buf[i].cat == indicRepha {
+				i++
+			}
+			for i < n && isConsonant(&buf[i]) {
+				i++
+				for i < n && buf[i].cat == indicN {
+					i++
+				}
+				// A halant joins the next consonant to the cluster.
+				j := i
+				if j < n && buf[j].cat == indicH {
+					j++
+					for j < n && isJoiner(&buf[j]) {
+						j++
+					}
+				}
+				if j == i || j == n || (buf[j].cat != indicC && buf[j].cat != indicRa) {
+					break
+				}
+				i = j
+			}
+		case indicM, indicN, indicH, indicSM:
+			if f.hasGlyph(0x25CC) {
+				id := f.index(0x25CC)
+				out = append(out, otGlyph{
+					id: id, r: 0x25CC, cluster: buf[i].cluster, mask: buf[i].mask,
+					class: glyphClass(l, id, 0x25CC), syllable: syl, cat: indicC, pos: posBaseC,
+				})
+			}
+		default:
+			i++
+		}
+		for i < n && buf[start].cat != indicX {
+			c := buf[i].cat
+			if c != indicM && c != indicN && c != indicH && c != indicSM && c != indicZWJ && c != indicZWNJ {
+				break
+			}
+			i++
+		}
+		for ; start < i; start++ {
+			buf[start].syllable = syl
+			out = append(out, buf[start])
+		}
+	}
+	return out
+}
+
+// InitialReorder finds the base consonant of a syllable, sorts the glyphs
+// by their position and selects the forms they may take.
+func (p *otPlan) initialReorder(c *otContext, sc *indicScript, start, end int) {
+	buf := c.buf
+	if !isConsonant(&buf[start]) && buf[start].cat != indicRepha {
+		return
+	}
+
+	base, limit, reph := end, start, false
+	switch {
+	case sc.rephMode == rephLog && buf[start].cat == indicRepha:
+		limit++
+		reph = true
+	case sc.rephMode != rephLog && start+3 <= end && buf[start].cat == indicRa && buf[start+1].cat == indicH:
+		ids := []uint16{buf[start].id, buf[start+1].id}
+		if sc.rephMode == rephExplicit {
+			if buf[start+2].cat != indicZWJ {
+				break
+			}
+			ids = append(ids, buf[start+2].id)
+		}
+		if c.l.wouldSubstitute(p.rphf, ids...) {
+			limit += 2
+			reph = true
+		}
+	}
+	if reph {
+		for limit < end && isJoiner(&buf[limit]) {
+			limit++
+		}
+		base = start
+	}
+
+	// The base is the last consonant without a below-base or post-base form.
+	below := false
+	for i := end; i > limit; {
+		i--
+		if isConsonant(&buf[i]) {
+			base = i
+			if buf[i].pos != posBelowC && (buf[i].pos != posPostC || below) {
+				break
+			}
+			if buf[i].pos == posBelowC {
+				below = true
+			}
+		} else if start < i && buf[i].cat == indicZWJ && buf[i-1].cat == indicH {
+			break
+		}
+	}
+	if reph && base == start && limit-base <= 2 {
+		reph = false // The Ra is the only consonant.
+	}
+
+	for i := start; i < base; i++ {
+		if buf[i].pos > posPreC {
+			buf[i].pos = posPreC
+		}
+	}
+	if base < end {
+		buf[base].pos = posBaseC
+	}
+	if reph {
+		buf[start].pos = posRaToBecomeReph
+	}
+	if !p.newSpec {
+		// Old fonts expect the first halant after the base after the last consonant.
+		for i := base + 1; i < end; i++ {
+			if buf[i].cat == indicH {
+				j := end - 1
+				for j > i && !isConsonant(&buf[j]) {
+					j--
+				}
+				if j > i {
+					g := buf[i]
+					copy(buf[i:j], buf[i+1:j+1])
+					buf[j] = g
+				}
+				break
+			}
+		}
+	}
+
+	// Nuktas, halants and joiners move with the glyph before them.
+	last := posStart
+	for i := start; i < end; i++ {
+		switch g := &buf[i]; g.cat {
+		case indicN, indicH, indicZWJ, indicZWNJ:
+			g.pos = last
+			if g.cat == indicH && g.pos == posPreM {
+				for j := i; j > start; j-- {
+					if buf[j-1].pos != posPreM {
+						g.pos = buf[j-1].pos
+						break
+					}
+				}
+			}
+		default:
+			if g.pos != posSMVD {
+				last = g.pos
+			}
+		}
+	}
+	// Consonants after the base own the glyphs between them and the previous consonant or matra.
+	prev := base
+	for i := base + 1; i < end; i++ {
+		if isConsonant(&buf[i]) {
+			for j := prev + 1; j < i; j++ {
+				if buf[j].pos < posSMVD {
+					buf[j].pos = buf[i].pos
+				}
+			}
+			prev = i
+		} else if buf[i].cat == indicM {
+			prev = i
+		}
+	}
+
+	s := buf[start:end]
+	sort.SliceStable(s, func(i, j int) bool { return s[i].pos < s[j].pos })
+
+	base = end
+	for i := start; i < end; i++ {
+		if buf[i].pos == posBaseC {
+			base = i
+			break
+		}
+	}
+	for i := start; i < end && buf[i].pos == posRaToBecomeReph; i++ {
+		buf[i].mask |= maskRphf
+	}
+	for i := start; i < base; i++ {
+		buf[i].mask |= maskHalf
+	}
+	for i := base + 1; i < end; i++ {
+		buf[i].mask |= maskPost
+	}
+}
+
+// FinalReorder moves pre-base matras and the reph to their final position,
+// after the basic forms are substituted.
+func (p *otPlan) finalReorder(c *otContext, sc *indicScript, rs []rune, start, end int) {
+	buf := c.buf
+	base := start
+	for base < end && buf[base].pos < posBaseC {
+		base++
+	}
+	if base == end && start < base && buf[base-1].cat == indicZWJ {
+		base--
+	}
+	if base < end {
+		for start < base && (buf[base].cat == indicN || buf[base].cat == indicH) {
+			base--
+		}
+	}
+
+	// Pre-base matras go after the last halant which did not form a conjunct.
+	if start+1 < end && start < base {
+		to := base - 1
+		if base == end {
+			to = base - 2
+		}
+		if to < start {
+			to = start
+		}
+		if sc.afterHalant {
+			for {
+				for to > start && buf[to].cat != indicM && buf[to].cat != indicH {
+					to--
+				}
+				if buf[to].cat == indicH && buf[to].pos != posPreM {
+					if to+1 < end && buf[to+1].cat == indicZWJ && to > start {
+						to--
+						continue
+					}
+				} else {
+					to = start
+				}
+				break
+			}
+		}
+		if start < to && buf[to].pos != posPreM {
+			for i := to; i > start; i-- {
+				if buf[i-1].pos == posPreM {
+					from := i - 1
+					if from < base && base <= to {
+						base--
+					}
+					g := buf[from]
+					copy(buf[from:to], buf[from+1:to+1])
+					buf[to] = g
+					to--
+				}
+			}
+		}
+	}
+
+	// A reph formed if the Ra ligated with the halant.
+	if start+1 < end && buf[start].pos == posRaToBecomeReph && (buf[start].cat == indicRepha) != buf[start].ligated {
+		to := p.rephPosition(buf, sc, start, end, base)
+		g := buf[start]
+		copy(buf[start:to], buf[start+1:to+1])
+		buf[to] = g
+	}
+
+	// The init feature applies to pre-base matras at the start of a word.
+	if buf[start].pos == posPreM {
+		first := buf[start].cluster
+		for i := start; i < end; i++ {
+			if buf[i].cluster < first {
+				first = buf[i].cluster
+			}
+		}
+		if first == 0 || !unicode.In(rs[first-1], unicode.L, unicode.M) {
+			buf[start].mask |= maskInit
+		}
+	}
+}
+
+// RephPosition returns where the reph of a syllable goes.
+func (p *otPlan) rephPosition(buf []otGlyph, sc *indicScript, start, end, base int) int {
+	// After the first halant between the Ra and the base.
+	afterHalant := func() int {
+		i := start + 1
+		for i < base && buf[i].cat != indicH {
+			i++
+		}
+		if i < base && buf[i].cat == indicH {
+			if i+1 < base && isJoiner(&buf[i+1]) {
+				i++
+			}
+			return i
+		}
+		return -1
+	}
+	if i := afterHalant(); i >= 0 {
+		return i
+	}
+	switch sc.rephPos {
+	case posAfterMain:
+		i := base
+		for i+1 < end && buf[i+1].pos <= posAfterMain {
+			i++
+		}
+		if i < end {
+			return i
+		}
+	case posAfterSub:
+		i := base
+		for i+1 < end {
+			if pos := buf[i+1].pos; pos == posPostC || pos == posAfterPost || pos == posSMVD {
+				break
+			}
+			i++
+		}
+		if i < end {
+			return i
+		}
+	}
+	// Otherwise at the end of the syllable, before syllable modifiers.
+	i := end - 1
+	for i > start && buf[i].pos == posSMVD {
+		i--
+	}
+	if buf[i].cat == indicH {
+		for j := base + 1; j < i; j++ {
+			if buf[j].cat == indicM {
+				i--
+			}
+		}
+	}
+	return i
+}
@@ -0,0 +1,393 @@
+package duitdraw
+
+// Joining and Indic shaping data of Unicode 14.0.0, derived from
+// ArabicShaping.txt, IndicSyllabicCategory.txt and IndicPositionalCategory.txt.
+
+// JoiningRange gives the joining type of the code points from lo to hi.
+type joiningRange struct {
+	lo, hi rune
+	typ    joining
+}
+
+// JoiningTypes are the ranges of code points, sorted by lo, whose joining type
+// differs from the default: joinT for Mn, Me and Cf, joinU otherwise.
+var joiningTypes = []joiningRange{
+	{0x0600, 0x0605, joinU},
+	{0x0620, 0x0620, joinD},
+	{0x0622, 0x0625, joinR},
+	{0x0626, 0x0626, joinD},
+	{0x0627, 0x0627, joinR},
+	{0x0628, 0x0628, joinD},
+	{0x0629, 0x0629, joinR},
+	{0x062A, 0x062E, joinD},
+	{0x062F, 0x0632, joinR},
+	{0x0633, 0x063F, joinD},
+	{0x0640, 0x0640, joinC},
+	{0x0641, 0x0647, joinD},
+	{0x0648, 0x0648, joinR},
+	{0x0649, 0x064A, joinD},
+	{0x066E, 0x066F, joinD},
+	{0x0671, 0x0673, joinR},
+	{0x0675, 0x0677, joinR},
+	{0x0678, 0x0687, joinD},
+	{0x0688, 0x0699, joinR},
+	{0x069A, 0x06BF, joinD},
+	{0x06C0, 0x06C0, joinR},
+	{0x06C1, 0x06C2, joinD},
+	{0x06C3, 0x06CB, joinR},
+	{0x06CC, 0x06CC, joinD},
+	{0x06CD, 0x06CD, joinR},
+	{0x06CE, 0x06CE, joinD},
+	{0x06CF, 0x06CF, joinR},
+	{0x06D0, 0x06D1, joinD},
+	{0x06D2, 0x06D3, joinR},
+	{0x06D5, 0x06D5, joinR},
+	{0x06DD, 0x06DD, joinU},
+	{0x06EE, 0x06EF, joinR},
+	{0x06FA, 0x06FC, joinD},
+	{0x06FF, 0x06FF, joinD},
+	{0x0710, 0x0710, joinR},
+	{0x0712, 0x0714, joinD},
+	{0x0715, 0x0719, joinR},
+	{0x071A, 0x071D, joinD},
+	{0x071E, 0x071E, joinR},
+	{0x071F, 0x0727, joinD},
+	{0x0728, 0x0728, joinR},
+	{0x0729, 0x0729, joinD},
+	{0x072A, 0x072A, joinR},
+	{0x072B, 0x072B, joinD},
+	{0x072C, 0x072C, joinR},
+	{0x072D, 0x072E, joinD},
+	{0x072F, 0x072F, joinR},
+	{0x074D, 0x074D, joinR},
+	{0x074E, 0x0758, joinD},
+	{0x0759, 0x075B, joinR},
+	{0x075C, 0x076A, joinD},
+	{0x076B, 0x076C, joinR},
+	{0x076D, 0x0770, joinD},
+	{0x0771, 0x0771, joinR},
+	{0x0772, 0x0772, joinD},
+	{0x0773, 0x0774, joinR},
+	{0x0775, 0x0777, joinD},
+	{0x0778, 0x0779, joinR},
+	{0x077A, 0x077F, joinD},
+	{0x07CA, 0x07EA, joinD},
+	{0x07FA, 0x07FA, joinC},
+	{0x0840, 0x0840, joinR},
+	{0x0841, 0x0845, joinD},
+	{0x0846, 0x0847, joinR},
+	{0x0848, 0x0848, joinD},
+	{0x0849, 0x0849, joinR},
+	{0x084A, 0x0853, joinD},
+	{0x0854, 0x0854, joinR},
+	{0x0855, 0x0855, joinD},
+	{0x0856, 0x0858, joinR},
+	{0x0860, 0x0860, joinD},
+	{0x0862, 0x0865, joinD},
+	{0x0867, 0x0867, joinR},
+	{0x0868, 0x0868, joinD},
+	{0x0869, 0x086A, joinR},
+	{0x0870, 0x0882, joinR},
+	{0x0883, 0x0885, joinC},
+	{0x0886, 0x0886, joinD},
+	{0x0889, 0x088D, joinD},
+	{0x088E, 0x088E, joinR},
+	{0x0890, 0x0891, joinU},
+	{0x08A0, 0x08A9, joinD},
+	{0x08AA, 0x08AC, joinR},
+	{0x08AE, 0x08AE, joinR},
+	{0x08AF, 0x08B0, joinD},
+	{0x08B1, 0x08B2, joinR},
+	{0x08B3, 0x08B8, joinD},
+	{0x08B9, 0x08B9, joinR},
+	{0x08BA, 0x08C8, joinD},
+	{0x08E2, 0x08E2, joinU},
+	{0x1807, 0x1807, joinD},
+	{0x180A, 0x180A, joinC},
+	{0x180E, 0x180E, joinU},
+	{0x1820, 0x1878, joinD},
+	{0x1887, 0x18A8, joinD},
+	{0x18AA, 0x18AA, joinD},
+	{0x200C, 0x200C, joinU},
+	{0x200D, 0x200D, joinC},
+	{0x2066, 0x2069, joinU},
+	{0xA840, 0xA871, joinD},
+	{0xA872, 0xA872, joinL},
+	{0x10AC0, 0x10AC4, joinD},
+	{0x10AC5, 0x10AC5, joinR},
+	{0x10AC7, 0x10AC7, joinR},
+	{0x10AC9, 0x10ACA, joinR},
+	{0x10ACD, 0x10ACD, joinL},
+	{0x10ACE, 0x10AD2, joinR},
+	{0x10AD3, 0x10AD6, joinD},
+	{0x10AD7, 0x10AD7, joinL},
+	{0x10AD8, 0x10ADC, joinD},
+	{0x10ADD, 0x10ADD, joinR},
+	{0x10ADE, 0x10AE0, joinD},
+	{0x10AE1, 0x10AE1, joinR},
+	{0x10AE4, 0x10AE4, joinR},
+	{0x10AEB, 0x10AEE, joinD},
+	{0x10AEF, 0x10AEF, joinR},
+	{0x10B80, 0x10B80, joinD},
+	{0x10B81, 0x10B81, joinR},
+	{0x10B82, 0x10B82, joinD},
+	{0x10B83, 0x10B85, joinR},
+	{0x10B86, 0x10B88, joinD},
+	{0x10B89, 0x10B89, joinR},
+	{0x10B8A, 0x10B8B, joinD},
+	{0x10B8C, 0x10B8C, joinR},
+	{0x10B8D, 0x10B8D, joinD},
+	{0x10B8E, 0x10B8F, joinR},
+	{0x10B90, 0x10B90, joinD},
+	{0x10B91, 0x10B91, joinR},
+	{0x10BA9, 0x10BAC, joinR},
+	{0x10BAD, 0x10BAE, joinD},
+	{0x10D00, 0x10D00, joinL},
+	{0x10D01, 0x10D21, joinD},
+	{0x10D22, 0x10D22, joinR},
+	{0x10D23, 0x10D23, joinD},
+	{0x10F30, 0x10F32, joinD},
+	{0x10F33, 0x10F33, joinR},
+	{0x10F34, 0x10F44, joinD},
+	{0x10F51, 0x10F53, joinD},
+	{0x10F54, 0x10F54, joinR},
+	{0x10F70, 0x10F73, joinD},
+	{0x10F74, 0x10F75, joinR},
+	{0x10F76, 0x10F81, joinD},
+	{0x10FB0, 0x10FB0, joinD},
+	{0x10FB2, 0x10FB3, joinD},
+	{0x10FB4, 0x10FB6, joinR},
+	{0x10FB8, 0x10FB8, joinD},
+	{0x10FB9, 0x10FBA, joinR},
+	{0x10FBB, 0x10FBC, joinD},
+	{0x10FBD, 0x10FBD, joinR},
+	{0x10FBE, 0x10FBF, joinD},
+	{0x10FC1, 0x10FC1, joinD},
+	{0x10FC2, 0x10FC3, joinR},
+	{0x10FC4, 0x10FC4, joinD},
+	{0x10FC9, 0x10FC9, joinR},
+	{0x10FCA, 0x10FCA, joinD},
+	{0x10FCB, 0x10FCB, joinL},
+	{0x110BD, 0x110BD, joinU},
+	{0x110CD, 0x110CD, joinU},
+	{0x1E900, 0x1E943, joinD},
+	{0x1E94B, 0x1E94B, joinT},
+}
+
+// IndicRange gives the Indic category and matra position of the code points from lo to hi.
+type indicRange struct {
+	lo, hi rune
+	cat    uint8
+	pos    uint8
+}
+
+// IndicCategories are the ranges of code points from Devanagari to Malayalam,
+// sorted by lo, which are not of category indicX without a position.
+var indicCategories = []indicRange{
+	{0x0900, 0x0902, indicSM, posAboveM},
+	{0x0903, 0x0903, indicSM, posPostM},
+	{0x0904, 0x0914, indicV, posNone},
+	{0x0915, 0x0939, indicC, posNone},
+	{0x093A, 0x093A, indicM, posAboveM},
+	{0x093B, 0x093B, indicM, posPostM},
+	{0x093C, 0x093C, indicN, posBelowM},
+	{0x093E, 0x093E, indicM, posPostM},
+	{0x093F, 0x093F, indicM, posPreM},
+	{0x0940, 0x0940, indicM, posPostM},
+	{0x0941, 0x0944, indicM, posBelowM},
+	{0x0945, 0x0948, indicM, posAboveM},
+	{0x0949, 0x094C, indicM, posPostM},
+	{0x094D, 0x094D, indicH, posBelowM},
+	{0x094E, 0x094E, indicM, posPreM},
+	{0x094F, 0x094F, indicM, posPostM},
+	{0x0951, 0x0951, indicSM, posAboveM},
+	{0x0952, 0x0952, indicSM, posBelowM},
+	{0x0953, 0x0954, indicX, posAboveM},
+	{0x0955, 0x0955, indicM, posAboveM},
+	{0x0956, 0x0957, indicM, posBelowM},
+	{0x0958, 0x095F, indicC, posNone},
+	{0x0960, 0x0961, indicV, posNone},
+	{0x0962, 0x0963, indicM, posBelowM},
+	{0x0972, 0x0977, indicV, posNone},
+	{0x0978, 0x0980, indicC, posNone},
+	{0x0981, 0x0981, indicSM, posAboveM},
+	{0x0982, 0x0983, indicSM, posPostM},
+	{0x0985, 0x098C, indicV, posNone},
+	{0x098F, 0x0990, indicV, posNone},
+	{0x0993, 0x0994, indicV, posNone},
+	{0x0995, 0x09A8, indicC, posNone},
+	{0x09AA, 0x09B0, indicC, posNone},
+	{0x09B2, 0x09B2, indicC, posNone},
+	{0x09B6, 0x09B9, indicC, posNone},
+	{0x09BC, 0x09BC, indicN, posBelowM},
+	{0x09BE, 0x09BE, indicM, posPostM},
+	{0x09BF, 0x09BF, indicM, posPreM},
+	{0x09C0, 0x09C0, indicM, posPostM},
+	{0x09C1, 0x09C4, indicM, posBelowM},
+	{0x09C7, 0x09C8, indicM, posPreM},
+	{0x09CB, 0x09CC, indicM, posPreM},
+	{0x09CD, 0x09CD, indicH, posBelowM},
+	{0x09CE, 0x09CE, indicC, posNone},
+	{0x09D7, 0x09D7, indicM, posPostM},
+	{0x09DC, 0x09DD, indicC, posNone},
+	{0x09DF, 0x09DF, indicC, posNone},
+	{0x09E0, 0x09E1, indicV, posNone},
+	{0x09E2, 0x09E3, indicM, posBelowM},
+	{0x09F0, 0x09F1, indicC, posNone},
+	{0x09FC, 0x09FC, indicSM, posNone},
+	{0x09FE, 0x09FE, indicSM, posAboveM},
+	{0x0A01, 0x0A02, indicSM, posAboveM},
+	{0x0A03, 0x0A03, indicSM, posPostM},
+	{0x0A05, 0x0A0A, indicV, posNone},
+	{0x0A0F, 0x0A10, indicV, posNone},
+	{0x0A13, 0x0A14, indicV, posNone},
+	{0x0A15, 0x0A28, indicC, posNone},
+	{0x0A2A, 0x0A30, indicC, posNone},
+	{0x0A32, 0x0A33, indicC, posNone},
+	{0x0A35, 0x0A36, indicC, posNone},
+	{0x0A38, 0x0A39, indicC, posNone},
+	{0x0A3C, 0x0A3C, indicN, posBelowM},
+	{0x0A3E, 0x0A3E, indicM, posPostM},
+	{0x0A3F, 0x0A3F, indicM, posPreM},
+	{0x0A40, 0x0A40, indicM, posPostM},
+	{0x0A41, 0x0A42, indicM, posBelowM},
+	{0x0A47, 0x0A48, indicM, posAboveM},
+	{0x0A4B, 0x0A4C, indicM, posAboveM},
+	{0x0A4D, 0x0A4D, indicH, posBelowM},
+	{0x0A51, 0x0A51, indicSM, posBelowM},
+	{0x0A59, 0x0A5C, indicC, posNone},
+	{0x0A5E, 0x0A5E, indicC, posNone},
+	{0x0A70, 0x0A71, indicSM, posAboveM},
+	{0x0A72, 0x0A73, indicC, posNone},
+	{0x0A75, 0x0A75, indicC, posBelowM},
+	{0x0A81, 0x0A82, indicSM, posAboveM},
+	{0x0A83, 0x0A83, indicSM, posPostM},
+	{0x0A85, 0x0A8D, indicV, posNone},
+	{0x0A8F, 0x0A91, indicV, posNone},
+	{0x0A93, 0x0A94, indicV, posNone},
+	{0x0A95, 0x0AA8, indicC, posNone},
+	{0x0AAA, 0x0AB0, indicC, posNone},
+	{0x0AB2, 0x0AB3, indicC, posNone},
+	{0x0AB5, 0x0AB9, indicC, posNone},
+	{0x0ABC, 0x0ABC, indicN, posBelowM},
+	{0x0ABE, 0x0ABE, indicM, posPostM},
+	{0x0ABF, 0x0ABF, indicM, posPreM},
+	{0x0AC0, 0x0AC0, indicM, posPostM},
+	{0x0AC1, 0x0AC4, indicM, posBelowM},
+	{0x0AC5, 0x0AC5, indicM, posAboveM},
+	{0x0AC7, 0x0AC8, indicM, posAboveM},
+	{0x0AC9, 0x0AC9, indicM, posPostM},
+	{0x0ACB, 0x0ACC, indicM, posPostM},
+	{0x0ACD, 0x0ACD, indicH, posBelowM},
+	{0x0AE0, 0x0AE1, indicV, posNone},
+	{0x0AE2, 0x0AE3, indicM, posBelowM},
+	{0x0AF9, 0x0AF9, indicC, posNone},
+	{0x0AFA, 0x0AFC, indicSM, posAboveM},
+	{0x0AFD, 0x0AFF, indicN, posAboveM},
+	{0x0B01, 0x0B01, indicSM, posAboveM},
+	{0x0B02, 0x0B03, indicSM, posPostM},
+	{0x0B05, 0x0B0C, indicV, posNone},
+	{0x0B0F, 0x0B10, indicV, posNone},
+	{0x0B13, 0x0B14, indicV, posNone},
+	{0x0B15, 0x0B28, indicC, posNone},
+	{0x0B2A, 0x0B30, indicC, posNone},
+	{0x0B32, 0x0B33, indicC, posNone},
+	{0x0B35, 0x0B39, indicC, posNone},
+	{0x0B3C, 0x0B3C, indicN, posBelowM},
+	{0x0B3E, 0x0B3E, indicM, posPostM},
+	{0x0B3F, 0x0B3F, indicM, posAboveM},
+	{0x0B40, 0x0B40, indicM, posPostM},
+	{0x0B41, 0x0B44, indicM, posBelowM},
+	{0x0B47, 0x0B48, indicM, posPreM},
+	{0x0B4B, 0x0B4C, indicM, posPreM},
+	{0x0B4D, 0x0B4D, indicH, posBelowM},
+	{0x0B55, 0x0B56, indicM, posAboveM},
+	{0x0B57, 0x0B57, indicM, posPostM},
+	{0x0B5C, 0x0B5D, indicC, posNone},
+	{0x0B5F, 0x0B5F, indicC, posNone},
+	{0x0B60, 0x0B61, indicV, posNone},
+	{0x0B62, 0x0B63, indicM, posBelowM},
+	{0x0B71, 0x0B71, indicC, posNone},
+	{0x0B82, 0x0B82, indicSM, posAboveM},
+	{0x0B83, 0x0B83, indicSM, posNone},
+	{0x0B85, 0x0B8A, indicV, posNone},
+	{0x0B8E, 0x0B90, indicV, posNone},
+	{0x0B92, 0x0B94, indicV, posNone},
+	{0x0B95, 0x0B95, indicC, posNone},
+	{0x0B99, 0x0B9A, indicC, posNone},
+	{0x0B9C, 0x0B9C, indicC, posNone},
+	{0x0B9E, 0x0B9F, indicC, posNone},
+	{0x0BA3, 0x0BA4, indicC, posNone},
+	{0x0BA8, 0x0BAA, indicC, posNone},
+	{0x0BAE, 0x0BB9, indicC, posNone},
+	{0x0BBE, 0x0BBF, indicM, posPostM},
+	{0x0BC0, 0x0BC0, indicM, posAboveM},
+	{0x0BC1, 0x0BC2, indicM, posPostM},
+	{0x0BC6, 0x0BC8, indicM, posPreM},
+	{0x0BCA, 0x0BCC, indicM, posPreM},
+	{0x0BCD, 0x0BCD, indicH, posAboveM},
+	{0x0BD7, 0x0BD7, indicM, posPostM},
+	{0x0C00, 0x0C00, indicSM, posAboveM},
+	{0x0C01, 0x0C03, indicSM, posPostM},
+	{0x0C04, 0x0C04, indicSM, posAboveM},
+	{0x0C05, 0x0C0C, indicV, posNone},
+	{0x0C0E, 0x0C10, indicV, posNone},
+	{0x0C12, 0x0C14, indicV, posNone},
+	{0x0C15, 0x0C28, indicC, posNone},
+	{0x0C2A, 0x0C39, indicC, posNone},
+	{0x0C3C, 0x0C3C, indicN, posBelowM},
+	{0x0C3E, 0x0C40, indicM, posAboveM},
+	{0x0C41, 0x0C44, indicM, posPostM},
+	{0x0C46, 0x0C47, indicM, posAboveM},
+	{0x0C48, 0x0C48, indicM, posBelowM},
+	{0x0C4A, 0x0C4C, indicM, posAboveM},
+	{0x0C4D, 0x0C4D, indicH, posAboveM},
+	{0x0C55, 0x0C55, indicM, posAboveM},
+	{0x0C56, 0x0C56, indicM, posBelowM},
+	{0x0C58, 0x0C5A, indicC, posNone},
+	{0x0C5D, 0x0C5D, indicC, posNone},
+	{0x0C60, 0x0C61, indicV, posNone},
+	{0x0C62, 0x0C63, indicM, posBelowM},
+	{0x0C80, 0x0C80, indicSM, posNone},
+	{0x0C81, 0x0C81, indicSM, posAboveM},
+	{0x0C82, 0x0C83, indicSM, posPostM},
+	{0x0C85, 0x0C8C, indicV, posNone},
+	{0x0C8E, 0x0C90, indicV, posNone},
+	{0x0C92, 0x0C94, indicV, posNone},
+	{0x0C95, 0x0CA8, indicC, posNone},
+	{0x0CAA, 0x0CB3, indicC, posNone},
+	{0x0CB5, 0x0CB9, indicC, posNone},
+	{0x0CBC, 0x0CBC, indicN, posBelowM},
+	{0x0CBE, 0x0CBE, indicM, posPostM},
+	{0x0CBF, 0x0CBF, indicM, posAboveM},
+	{0x0CC0, 0x0CC4, indicM, posPostM},
+	{0x0CC6, 0x0CC6, indicM, posAboveM},
+	{0x0CC7, 0x0CC8, indicM, posPostM},
+	{0x0CCA, 0x0CCB, indicM, posPostM},
+	{0x0CCC, 0x0CCC, indicM, posAboveM},
+	{0x0CCD, 0x0CCD, indicH, posAboveM},
+	{0x0CD5, 0x0CD6, indicM, posPostM},
+	{0x0CDD, 0x0CDE, indicC, posNone},
+	{0x0CE0, 0x0CE1, indicV, posNone},
+	{0x0CE2, 0x0CE3, indicM, posBelowM},
+	{0x0CF1, 0x0CF2, indicC, posNone},
+	{0x0D00, 0x0D01, indicSM, posAboveM},
+	{0x0D02, 0x0D03, indicSM, posPostM},
+	{0x0D04, 0x0D04, indicSM, posNone},
+	{0x0D05, 0x0D0C, indicV, posNone},
+	{0x0D0E, 0x0D10, indicV, posNone},
+	{0x0D12, 0x0D14, indicV, posNone},
+	{0x0D15, 0x0D3A, indicC, posNone},
+	{0x0D3B, 0x0D3C, indicH, posAboveM},
+	{0x0D3E, 0x0D42, indicM, posPostM},
+	{0x0D43, 0x0D44, indicM, posBelowM},
+	{0x0D46, 0x0D48, indicM, posPreM},
+	{0x0D4A, 0x0D4C, indicM, posPreM},
+	{0x0D4D, 0x0D4D, indicH, posAboveM},
+	{0x0D4E, 0x0D4E, indicRepha, posAboveM},
+	{0x0D54, 0x0D56, indicC, posNone},
+	{0x0D57, 0x0D57, indicM, posPostM},
+	{0x0D5F, 0x0D61, indicV, posNone},
+	{0x0D62, 0x0D63, indicM, posBelowM},
+	{0x0D7A, 0x0D7F, indicC, posNone},
+}
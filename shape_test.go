@@ -0,0 +1,365 @@
+package duitdraw
+
+import (
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// AllGlyphs is a face which has a glyph for every rune.
+type allGlyphs struct {
+	font.Face
+}
+
+func (allGlyphs) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	return fixed.I(5), true
+}
+
+func (allGlyphs) Kern(r0, r1 rune) fixed.Int26_6 {
+	return 0
+}
+
+// Runes returns the runes of glyphs, or U+FFFD for glyphs drawn by index.
+func runes(gs []Glyph) string {
+	var rs []rune
+	for _, g := range gs {
+		if g.Rune < 0 {
+			rs = append(rs, 0xFFFD)
+		} else {
+			rs = append(rs, g.Rune)
+		}
+	}
+	return string(rs)
+}
+
+// TestShape shapes with a face without layout tables, which reorders
+// bidirectional and Indic text and joins Arabic with presentation forms.
+func TestShape(t *testing.T) {
+	f := &Font{
+		FaceID: FaceID{Name: "shape test", FontOptions: FontOptions{Shape: true}},
+		face:   allGlyphs{},
+	}
+	tt := []struct {
+		logical, visual string
+	}{
+		{"Hello world!", "Hello world!"},
+		{"abc אבג def", "abc גבא def"},
+		{"אבג abc", "abc גבא"},
+		{"אבג 123", "123 גבא"},
+		{"א(ב)", "(ב)א"},
+		{"abc (אבג) def", "abc (גבא) def"},
+		{"abc אבג (123) def", "abc (123) גבא def"},
+		{"אבג 1.5%!", "!1.5% גבא"},
+		{"abc ⁧אבג def⁩ ghi", "abc def גבא ghi"}, // isolate, controls are not drawn
+		{"אב\nגד", "בא\nדג"},                     // paragraphs are reordered separately
+		{"سلام", "ﻡﻼﺳ"},                          // salam: lam-alef ligature
+		{"ببب", "ﺐﺒﺑ"},                           // beh: initial, medial, final
+		{"بَب", "ﺐﺑَ"},                           // marks are transparent
+		{"دب", "ﺏﺩ"},                             // dal does not join to the left
+		{"كف 23", "23 ﻒﻛ"},                       // numbers keep their order
+		{"কি", "িক"},                             // pre-base vowel sign
+		{"কোনো", "েকােনা"},                       // two-part vowel signs
+		{"ক্ষি", "ক্িষ"},                         // without conjuncts, the matra follows the visible halant
+	}
+	for _, tc := range tt {
+		if got := runes(f.shape(tc.logical)); got != tc.visual {
+			t.Errorf("shape(%q) is %+q; expected %+q", tc.logical, got, tc.visual)
+		}
+	}
+}
+
+// LayoutTable returns a GSUB or GPOS table with the lookups,
+// each for one feature of the default language system of script.
+func layoutTable(script string, features []string, lookups [][]byte) []byte {
+	n := len(features)
+	scripts := be(uint16(1), []byte(script), uint16(8), uint16(4), uint16(0), uint16(0), uint16(0xFFFF), uint16(n))
+	features2 := be(uint16(n))
+	lookups2 := be(uint16(n))
+	var fs, ls []byte
+	for i, tag := range features {
+		scripts = append(scripts, be(uint16(i))...)
+		features2 = append(features2, be([]byte(tag), uint16(2+6*n+len(fs)))...)
+		fs = append(fs, be(uint16(0), uint16(1), uint16(i))...)
+		lookups2 = append(lookups2, be(uint16(2+2*n+len(ls)))...)
+		ls = append(ls, lookups[i]...)
+	}
+	features2 = append(features2, fs...)
+	lookups2 = append(lookups2, ls...)
+	return be(uint16(1), uint16(0), uint16(10), uint16(10+len(scripts)), uint16(10+len(scripts)+len(features2)),
+		scripts, features2, lookups2)
+}
+
+type testLigature struct {
+	components []uint16
+	glyph      uint16
+}
+
+// LigatureLookup returns a GSUB lookup with the ligatures.
+func ligatureLookup(ligs ...testLigature) []byte {
+	sets := make(map[uint16][]testLigature)
+	var first []uint16
+	for _, l := range ligs {
+		g := l.components[0]
+		if _, ok := sets[g]; !ok {
+			first = append(first, g)
+		}
+		sets[g] = append(sets[g], l)
+	}
+	sort.Slice(first, func(i, j int) bool { return first[i] < first[j] })
+
+	cov := be(uint16(1), uint16(len(first)), first)
+	head := 6 + 2*len(first)
+	var offsets []uint16
+	var body []byte
+	for _, g := range first {
+		offsets = append(offsets, uint16(head+len(cov)+len(body)))
+		set := sets[g]
+		body = append(body, be(uint16(len(set)))...)
+		var lb []byte
+		for _, l := range set {
+			body = append(body, be(uint16(2+2*len(set)+len(lb)))...)
+			lb = append(lb, be(l.glyph, uint16(len(l.components)), l.components[1:])...)
+		}
+		body = append(body, lb...)
+	}
+	return be(uint16(4), uint16(0), uint16(1), uint16(8),
+		uint16(1), uint16(head), uint16(len(first)), offsets, cov, body)
+}
+
+// OpenTestFont writes a font file with empty glyphs and opens it with the
+// Shape option at 10 pixels per em from dir. The cmap maps runes to glyphs, all
+// glyphs advance by 500 of 1000 units per em.
+func openTestFont(t *testing.T, dir string, cmap map[rune]uint16, n int, tables map[string][]byte) *Font {
+	var rs []rune
+	for r := range cmap {
+		rs = append(rs, r)
+	}
+	sort.Slice(rs, func(i, j int) bool { return rs[i] < rs[j] })
+	groups := be(uint16(12), uint16(0), uint32(16+12*len(rs)), uint32(0), uint32(len(rs)))
+	for _, r := range rs {
+		groups = append(groups, be(uint32(r), uint32(r), uint32(cmap[r]))...)
+	}
+
+	head := make([]byte, 54)
+	copy(head[18:], be(uint16(1000)))
+	maxp := make([]byte, 32)
+	copy(maxp, be(uint32(0x00010000), uint16(n)))
+	hhea := make([]byte, 36)
+	copy(hhea[4:], be(int16(800), int16(-200)))
+	copy(hhea[34:], be(uint16(n)))
+	var hmtx []byte
+	for i := 0; i < n; i++ {
+		hmtx = append(hmtx, be(uint16(500), int16(0))...)
+	}
+	tables["head"] = head
+	tables["maxp"] = maxp
+	tables["hhea"] = hhea
+	tables["hmtx"] = hmtx
+	tables["loca"] = make([]byte, 2*(n+1))
+	tables["glyf"] = []byte{}
+	tables["cmap"] = append(be(uint16(0), uint16(1), uint16(3), uint16(10), uint32(12)), groups...)
+
+	name := filepath.Join(dir, "test.ttf")
+	if err := ioutil.WriteFile(name, sfnt(tables), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := openFont(FaceID{Name: name, Size: 10, DPI: 72, FontOptions: FontOptions{Shape: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func indexes(gs []Glyph) []int {
+	var ids []int
+	for _, g := range gs {
+		ids = append(ids, g.Index)
+	}
+	return ids
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// TestShapeBengali shapes Bengali with the GSUB features of a test font:
+// a conjunct (akhn), the reph (rphf), below-base and post-base forms
+// (blwf, pstf) and half forms.
+func TestShapeBengali(t *testing.T) {
+	const (
+		ka = iota + 1
+		ssa
+		ra
+		virama
+		i
+		e
+		aa
+		ya
+		ta
+		kssa
+		reph
+		yaPost
+		taHalf
+		raBelow
+		circle
+		au
+	)
+	cmap := map[rune]uint16{
+		0x0995: ka, 0x09B7: ssa, 0x09B0: ra, 0x09CD: virama, 0x09BF: i, 0x09C7: e,
+		0x09BE: aa, 0x09AF: ya, 0x09A4: ta, 0x25CC: circle, 0x09D7: au,
+	}
+	gsub := layoutTable("bng2", []string{"akhn", "rphf", "blwf", "half", "pstf"}, [][]byte{
+		ligatureLookup(testLigature{[]uint16{ka, virama, ssa}, kssa}),
+		ligatureLookup(testLigature{[]uint16{ra, virama}, reph}),
+		ligatureLookup(testLigature{[]uint16{virama, ra}, raBelow}),
+		ligatureLookup(testLigature{[]uint16{ta, virama}, taHalf}),
+		ligatureLookup(testLigature{[]uint16{virama, ya}, yaPost}),
+	})
+	dir, err := ioutil.TempDir("", "duitdraw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	f := openTestFont(t, dir, cmap, au+1, map[string][]byte{"GSUB": gsub})
+
+	tt := []struct {
+		s      string
+		glyphs []int
+	}{
+		{"কি", []int{i, ka}},
+		{"ক্ষি", []int{i, kssa}},
+		{"কো", []int{e, ka, aa}},
+		{"কৌ", []int{e, ka, au}},
+		{"র্ক", []int{ka, reph}},
+		{"র্কি", []int{i, ka, reph}},
+		{"র্ক্ষি", []int{i, kssa, reph}},
+		{"র্", []int{ra, virama}},
+		{"ক্র", []int{ka, raBelow}},
+		{"ক্রি", []int{i, ka, raBelow}},
+		{"ক্য", []int{ka, yaPost}},
+		{"ত্ক", []int{taHalf, ka}},
+		{"কিকো", []int{i, ka, e, ka, aa}},
+		{"ি", []int{i, circle}},
+	}
+	for _, tc := range tt {
+		gs := f.shape(tc.s)
+		if got := indexes(gs); !equalInts(got, tc.glyphs) {
+			t.Errorf("shape(%+q) has glyphs %v; expected %v", tc.s, got, tc.glyphs)
+		}
+		if w := f.StringWidth(tc.s); w != 5*len(tc.glyphs) {
+			t.Errorf("StringWidth(%+q) is %d; expected %d", tc.s, w, 5*len(tc.glyphs))
+		}
+	}
+}
+
+// TestShapeMark positions a combining mark with the GPOS mark feature.
+func TestShapeMark(t *testing.T) {
+	// Mark-to-base: the anchor of the mark at (100, 0) goes to the anchor of the base at (250, 700).
+	mark := be(uint16(4), uint16(0), uint16(1), uint16(8),
+		uint16(1), uint16(12), uint16(18), uint16(1), uint16(24), uint16(36),
+		uint16(1), uint16(1), uint16(2),
+		uint16(1), uint16(1), uint16(1),
+		uint16(1), uint16(0), uint16(6), uint16(1), int16(100), int16(0),
+		uint16(1), uint16(4), uint16(1), int16(250), int16(700))
+	gpos := layoutTable("latn", []string{"mark"}, [][]byte{mark})
+	dir, err := ioutil.TempDir("", "duitdraw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	f := openTestFont(t, dir, map[rune]uint16{'a': 1, 0x0301: 2}, 3, map[string][]byte{"GPOS": gpos})
+
+	gs := f.shape("a\u0301")
+	if len(gs) != 2 {
+		t.Fatalf("shape has %d glyphs", len(gs))
+	}
+	// The pen is at 500 units after the base, the mark moves back by 350.
+	if o := gs[1].Offset; o.X != -fixed.I(7)/2 || o.Y != -fixed.I(7) {
+		t.Errorf("mark offset is %v; expected (-3.5, -7)", o)
+	}
+}
+
+// TestShapeArabic shapes Arabic with the GSUB and GPOS tables of DejaVuSans.
+func TestShapeArabic(t *testing.T) {
+	const name = "/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf"
+	if _, err := os.Stat(name); err != nil {
+		t.Skip(err)
+	}
+	f, err := openFont(FaceID{Name: name, Size: 12, DPI: 72, FontOptions: FontOptions{Shape: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The joining forms are the glyphs of the presentation forms,
+	// the isolated meem is its nominal glyph.
+	want := []int{int(f.index(0x0645)), int(f.index(0xFEFC)), int(f.index(0xFEB3))}
+	if got := indexes(f.shape("سلام")); !equalInts(got, want) {
+		t.Errorf("salam has glyphs %v; expected %v", got, want)
+	}
+
+	// Marks have no advance and are attached above and below their letter.
+	gs := f.shape("بِسْمِ")
+	var marks int
+	for _, g := range gs {
+		var b truetype.GlyphBuf
+		if err := b.Load(f.file.ttf, f.scale(), truetype.Index(g.Index), font.HintingNone); err != nil {
+			t.Fatal(err)
+		}
+		// Top and bottom of the drawn glyph, relative to the baseline.
+		top, bottom := g.Offset.Y-b.Bounds.Max.Y, g.Offset.Y-b.Bounds.Min.Y
+		switch g.Rune {
+		case 0x0650: // Kasra.
+			if g.Advance != 0 || top <= 0 {
+				t.Errorf("kasra has advance %v and top %v", g.Advance, top)
+			}
+			marks++
+		case 0x0652: // Sukun.
+			if g.Advance != 0 || bottom >= 0 {
+				t.Errorf("sukun has advance %v and bottom %v", g.Advance, bottom)
+			}
+			marks++
+		}
+	}
+	if marks != 3 {
+		t.Errorf("shape has %d marks; expected 3: %+v", marks, gs)
+	}
+}
+
+func TestShapeStringWidth(t *testing.T) {
+	const name = "/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf"
+	if _, err := os.Stat(name); err != nil {
+		t.Skip(err)
+	}
+	d := Display{DPI: DefaultDPI}
+	f, err := d.OpenFont(name + "@12pt,shape")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := d.MakeImage(image.NewRGBA(image.Rect(0, 0, 600, 50)))
+	black, _ := d.AllocImage(image.Rect(0, 0, 1, 1), 0, true, Black)
+	for _, s := range []string{
+		"أنا قادر على أكل الزجاج و هذا لا يؤلمني.",
+		"אני יכול לאכול זכוכית וזה לא מזיק לי.",
+		"office affine",
+	} {
+		p := dst.String(image.Pt(1, 1), black, image.ZP, f, s)
+		if dx := f.StringWidth(s); p.X-1 != dx {
+			t.Errorf("String(%q) advanced by %v; StringWidth is %v", s, p.X-1, dx)
+		}
+	}
+}
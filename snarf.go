@@ -3,6 +3,9 @@
 package duitdraw
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/atotto/clipboard"
 )
 
@@ -21,3 +24,22 @@ func (d *Display) readSnarf(buf []byte) (int, int, error) {
 func (d *Display) writeSnarf(data []byte) error {
 	return clipboard.WriteAll(string(data))
 }
+
+func (d *Display) readClipboard(mime string) ([]byte, error) {
+	if mime != "text/plain" {
+		return nil, fmt.Errorf("ReadClipboard: %s is not supported", mime)
+	}
+	s, err := clipboard.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(s), nil
+}
+
+func (d *Display) writeClipboard(data map[string][]byte) error {
+	text, ok := data["text/plain"]
+	if !ok {
+		return errors.New("WriteClipboard: only text/plain is supported")
+	}
+	return clipboard.WriteAll(string(text))
+}
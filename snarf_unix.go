@@ -45,14 +45,40 @@ func (d *Display) readSnarf(buf []byte) (int, int, error) {
 	xc.mu.Lock()
 	defer xc.mu.Unlock()
 
-	n, size, err := xc.getSelection(primaryAtom, buf)
-	if size > 0 {
-		return n, size, err
+	data, err := xc.convert(primaryAtom, textAtom)
+	if err != nil || len(data) == 0 {
+		data, err = xc.convert(clipboardAtom, textAtom)
+		if err != nil {
+			return 0, 0, err
+		}
 	}
-	return xc.getSelection(clipboardAtom, buf)
+	n := copy(buf, data)
+	if n < len(data) {
+		return n, len(data), errShortSnarfBuffer
+	}
+	return n, n, nil
 }
 
 func (d *Display) writeSnarf(text []byte) error {
+	return d.writeClipboard(map[string][]byte{"text/plain": text})
+}
+
+func (d *Display) readClipboard(mime string) ([]byte, error) {
+	xc, err := getXClip()
+	if err != nil {
+		return nil, err
+	}
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+
+	target, err := xc.atom(mimeTargets(mime)[0])
+	if err != nil {
+		return nil, err
+	}
+	return xc.convert(clipboardAtom, target)
+}
+
+func (d *Display) writeClipboard(data map[string][]byte) error {
 	xc, err := getXClip()
 	if err != nil {
 		return err
@@ -60,7 +86,19 @@ func (d *Display) writeSnarf(text []byte) error {
 	xc.mu.Lock()
 	defer xc.mu.Unlock()
 
-	xc.text = text
+	targets := make(map[xproto.Atom][]byte)
+	for mime, b := range data {
+		for _, name := range mimeTargets(mime) {
+			a, err := xc.atom(name)
+			if err != nil {
+				return err
+			}
+			targets[a] = b
+		}
+	}
+	xc.dmu.Lock()
+	xc.data = targets
+	xc.dmu.Unlock()
 	ssoc := xproto.SetSelectionOwnerChecked(xc.conn, xc.win, clipboardAtom, xproto.TimeCurrentTime)
 	if err := ssoc.Check(); err != nil {
 		return fmt.Errorf("error setting clipboard: %v", err)
@@ -72,18 +110,51 @@ func (d *Display) writeSnarf(text []byte) error {
 	return nil
 }
 
+// MimeTargets returns the selection targets for a MIME type.
+// The first one is requested when reading the clipboard.
+// Text is offered as UTF8_STRING, which most programs request,
+// and other types by their name.
+func mimeTargets(mime string) []string {
+	if mime == "text/plain" {
+		return []string{"UTF8_STRING", "text/plain;charset=utf-8", "text/plain"}
+	}
+	return []string{mime}
+}
+
 const debugClipboardRequests = false
 
 type xClip struct {
-	conn      *xgb.Conn
-	win       xproto.Window
-	text      []byte
-	selnotify chan bool
-	err       error
-	mu        sync.Mutex
+	conn       *xgb.Conn
+	win        xproto.Window
+	selnotify  chan bool
+	propnotify chan bool // A new value of a property of win, for incremental reads.
+	chunk      int       // Size limit of a property, larger data is sent incrementally.
+	err        error
+	mu         sync.Mutex
+
+	dmu  sync.Mutex                // Guards the fields which are used by the event loop.
+	data map[xproto.Atom][]byte    // Clipboard contents by target.
+	incr map[incrKey]*incrTransfer // Incremental transfers to other programs.
 }
 
-var clipboardAtom, primaryAtom, textAtom, targetsAtom, atomAtom xproto.Atom
+// IncrKey identifies an incremental transfer by the property of the requestor.
+type incrKey struct {
+	requestor xproto.Window
+	property  xproto.Atom
+}
+
+// IncrTransfer is the remaining data of an incremental transfer.
+type incrTransfer struct {
+	target xproto.Atom
+	data   []byte
+	expire *time.Timer // Drops the transfer, if the requestor stops reading.
+}
+
+// IncrTimeout is the time after which an incremental transfer is dropped,
+// if the requestor does not delete the property to ask for the next chunk.
+const incrTimeout = 10 * time.Second
+
+var clipboardAtom, primaryAtom, textAtom, targetsAtom, atomAtom, incrAtom xproto.Atom
 
 var (
 	xclip     *xClip
@@ -101,6 +172,8 @@ func getXClip() (*xClip, error) {
 		}
 
 		xc.selnotify = make(chan bool, 1)
+		xc.propnotify = make(chan bool, 1)
+		xc.incr = make(map[incrKey]*incrTransfer)
 
 		xc.win, xc.err = xproto.NewWindowId(xc.conn)
 		if xc.err != nil {
@@ -108,8 +181,10 @@ func getXClip() (*xClip, error) {
 		}
 
 		setup := xproto.Setup(xc.conn)
+		xc.chunk = int(setup.MaximumRequestLength)*4 - 64 // Room for the request header.
 		s := setup.DefaultScreen(xc.conn)
-		xc.err = xproto.CreateWindowChecked(xc.conn, s.RootDepth, xc.win, s.Root, 100, 100, 1, 1, 0, xproto.WindowClassInputOutput, s.RootVisual, 0, []uint32{}).Check()
+		xc.err = xproto.CreateWindowChecked(xc.conn, s.RootDepth, xc.win, s.Root, 100, 100, 1, 1, 0, xproto.WindowClassInputOutput, s.RootVisual,
+			xproto.CwEventMask, []uint32{xproto.EventMaskPropertyChange}).Check()
 		if xc.err != nil {
 			return
 		}
@@ -119,6 +194,7 @@ func getXClip() (*xClip, error) {
 		textAtom = xc.internAtom("UTF8_STRING")
 		targetsAtom = xc.internAtom("TARGETS")
 		atomAtom = xc.internAtom("ATOM")
+		incrAtom = xc.internAtom("INCR")
 
 		go xc.eventLoop()
 	})
@@ -131,34 +207,65 @@ func (xc *xClip) setError(err error) {
 	}
 }
 
-func (xc *xClip) getSelection(selAtom xproto.Atom, buf []byte) (int, int, error) {
-	err := xproto.ConvertSelectionChecked(xc.conn, xc.win, selAtom, textAtom, selAtom, xproto.TimeCurrentTime).Check()
+// Convert asks the owner of the selection to convert it to target,
+// and reads the property which stores the result.
+// Large data is received incrementally.
+func (xc *xClip) convert(selAtom, target xproto.Atom) ([]byte, error) {
+	select {
+	case <-xc.selnotify: // A late response to a previous request.
+	default:
+	}
+	err := xproto.ConvertSelectionChecked(xc.conn, xc.win, selAtom, target, selAtom, xproto.TimeCurrentTime).Check()
 	if err != nil {
-		return 0, 0, err
+		return nil, err
 	}
 
 	select {
 	case r := <-xc.selnotify:
 		if !r {
-			return 0, 0, fmt.Errorf("bad response from selection owner")
+			return nil, fmt.Errorf("bad response from selection owner")
+		}
+	case <-time.After(1 * time.Second):
+		return nil, fmt.Errorf("clipboard retrieval failed, timeout")
+	}
+	// The owner has written the property before it sent the notification.
+	select {
+	case <-xc.propnotify:
+	default:
+	}
+	gpr, err := xproto.GetProperty(xc.conn, true, xc.win, selAtom, xproto.GetPropertyTypeAny, 0, maxPropertyLength).Reply()
+	if err != nil {
+		return nil, err
+	}
+	if gpr.Type != incrAtom {
+		return gpr.Value, nil
+	}
+
+	// Deleting the INCR property started the transfer.
+	// Each chunk is written to the property, and we delete it after reading.
+	// An empty chunk ends the transfer.
+	var data []byte
+	for {
+		select {
+		case <-xc.propnotify:
+		case <-time.After(1 * time.Second):
+			return nil, fmt.Errorf("incremental clipboard retrieval failed, timeout")
 		}
-		gpr, err := xproto.GetProperty(xc.conn, true, xc.win, selAtom, textAtom, 0, uint32(len(buf))).Reply()
+		gpr, err := xproto.GetProperty(xc.conn, true, xc.win, selAtom, xproto.GetPropertyTypeAny, 0, maxPropertyLength).Reply()
 		if err != nil {
-			return 0, 0, err
+			return nil, err
 		}
-		n := copy(buf, gpr.Value[:gpr.ValueLen])
-		if n < int(gpr.ValueLen) || gpr.BytesAfter != 0 {
-			return n, int(gpr.ValueLen + gpr.BytesAfter), errShortSnarfBuffer
+		if gpr.ValueLen == 0 {
+			return data, nil
 		}
-		return n, n, nil
-	case <-time.After(1 * time.Second):
-		return 0, 0, fmt.Errorf("clipboard retrieval failed, timeout")
+		data = append(data, gpr.Value...)
 	}
 }
 
-func (xc *xClip) eventLoop() {
-	targetAtoms := []xproto.Atom{targetsAtom, textAtom}
+// MaxPropertyLength is the length of a property to read, in 32 bit units.
+const maxPropertyLength = 1 << 28
 
+func (xc *xClip) eventLoop() {
 	for {
 		e, err := xc.conn.WaitForEvent()
 		if err != nil {
@@ -171,48 +278,143 @@ func (xc *xClip) eventLoop() {
 				tgtname := xc.lookupAtom(e.Target)
 				fmt.Fprintln(os.Stderr, "SelectionRequest", e, textAtom, tgtname, "isPrimary:", e.Selection == primaryAtom, "isClipboard:", e.Selection == clipboardAtom)
 			}
-			t := xc.text
+			xc.dmu.Lock()
+			xc.selectionRequest(e)
+			xc.dmu.Unlock()
 
-			switch e.Target {
-			case textAtom:
-				if debugClipboardRequests {
-					fmt.Fprintln(os.Stderr, "Sending as text")
-				}
-				err := xproto.ChangePropertyChecked(xc.conn, xproto.PropModeReplace, e.Requestor, e.Property, textAtom, 8, uint32(len(t)), []byte(t)).Check()
-				if err == nil {
-					xc.sendSelectionNotify(e)
-				} else {
-					fmt.Fprintf(os.Stderr, "duitdraw: %v\n", err)
-				}
+		case xproto.SelectionNotifyEvent: // read snarf
+			xc.selnotify <- (e.Property == clipboardAtom) || (e.Property == primaryAtom)
 
-			case targetsAtom:
-				if debugClipboardRequests {
-					fmt.Fprintln(os.Stderr, "Sending targets")
+		case xproto.DestroyNotifyEvent:
+			// A requestor of incremental transfers exited.
+			xc.dmu.Lock()
+			for k := range xc.incr {
+				if k.requestor == e.Window {
+					xc.dropIncr(k)
 				}
-				buf := make([]byte, len(targetAtoms)*4)
-				for i, atom := range targetAtoms {
-					xgb.Put32(buf[i*4:], uint32(atom))
+			}
+			xc.dmu.Unlock()
+
+		case xproto.PropertyNotifyEvent:
+			if e.State == xproto.PropertyDelete {
+				xc.dmu.Lock()
+				xc.sendChunk(incrKey{e.Window, e.Atom})
+				xc.dmu.Unlock()
+			} else if e.Window == xc.win {
+				select {
+				case xc.propnotify <- true:
+				default:
 				}
+			}
+		}
+	}
+}
 
-				xproto.ChangePropertyChecked(xc.conn, xproto.PropModeReplace, e.Requestor, e.Property, atomAtom, 32, uint32(len(targetAtoms)), buf).Check()
-				if err == nil {
-					xc.sendSelectionNotify(e)
-				} else {
-					fmt.Fprintf(os.Stderr, "duitdraw: %v\n", err)
-				}
+// SelectionRequest answers a request of another program for the clipboard.
+// The caller holds xc.dmu.
+func (xc *xClip) selectionRequest(e xproto.SelectionRequestEvent) {
+	if e.Target == targetsAtom {
+		if debugClipboardRequests {
+			fmt.Fprintln(os.Stderr, "Sending targets")
+		}
+		buf := make([]byte, 4, 4*(1+len(xc.data)))
+		xgb.Put32(buf, uint32(targetsAtom))
+		for atom := range xc.data {
+			buf = append(buf, 0, 0, 0, 0)
+			xgb.Put32(buf[len(buf)-4:], uint32(atom))
+		}
+		xc.reply(e, atomAtom, 32, buf)
+		return
+	}
+	t, ok := xc.data[e.Target]
+	if !ok {
+		if debugClipboardRequests {
+			fmt.Fprintln(os.Stderr, "Skipping")
+		}
+		e.Property = 0
+		xc.sendSelectionNotify(e)
+		return
+	}
+	if len(t) <= xc.chunk {
+		if debugClipboardRequests {
+			fmt.Fprintln(os.Stderr, "Sending", len(t), "bytes")
+		}
+		xc.reply(e, e.Target, 8, t)
+		return
+	}
 
-			default:
-				if debugClipboardRequests {
-					fmt.Fprintln(os.Stderr, "Skipping")
-				}
-				e.Property = 0
-				xc.sendSelectionNotify(e)
-			}
+	// The requestor deletes the INCR property to receive the first chunk.
+	if debugClipboardRequests {
+		fmt.Fprintln(os.Stderr, "Sending", len(t), "bytes incrementally")
+	}
+	// The transfer is dropped, when the requestor is destroyed or does not read.
+	if e.Requestor != xc.win {
+		xproto.ChangeWindowAttributes(xc.conn, e.Requestor, xproto.CwEventMask,
+			[]uint32{xproto.EventMaskPropertyChange | xproto.EventMaskStructureNotify})
+	}
+	k := incrKey{e.Requestor, e.Property}
+	if old := xc.incr[k]; old != nil {
+		old.expire.Stop()
+	}
+	it := &incrTransfer{target: e.Target, data: t}
+	it.expire = time.AfterFunc(incrTimeout, func() {
+		xc.dmu.Lock()
+		defer xc.dmu.Unlock()
+		if xc.incr[k] == it {
+			xc.dropIncr(k)
+		}
+	})
+	xc.incr[k] = it
+	buf := make([]byte, 4)
+	xgb.Put32(buf, uint32(len(t)))
+	xc.reply(e, incrAtom, 32, buf)
+}
 
-		case xproto.SelectionNotifyEvent: // read snarf
-			xc.selnotify <- (e.Property == clipboardAtom) || (e.Property == primaryAtom)
+// Reply stores the data in the property of the requestor and notifies it.
+func (xc *xClip) reply(e xproto.SelectionRequestEvent, typ xproto.Atom, format byte, data []byte) {
+	err := xproto.ChangePropertyChecked(xc.conn, xproto.PropModeReplace, e.Requestor, e.Property, typ, format, uint32(len(data)*8/int(format)), data).Check()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "duitdraw: %v\n", err)
+		return
+	}
+	xc.sendSelectionNotify(e)
+}
+
+// SendChunk sends the next chunk of an incremental transfer,
+// after the requestor deleted the property. The caller holds xc.dmu.
+func (xc *xClip) sendChunk(k incrKey) {
+	t := xc.incr[k]
+	if t == nil {
+		return
+	}
+	n := len(t.data)
+	if n > xc.chunk {
+		n = xc.chunk
+	}
+	xproto.ChangeProperty(xc.conn, xproto.PropModeReplace, k.requestor, k.property, t.target, 8, uint32(n), t.data[:n])
+	t.data = t.data[n:]
+	t.expire.Reset(incrTimeout)
+	if n == 0 {
+		xc.dropIncr(k)
+	}
+}
+
+// DropIncr ends an incremental transfer. Events of the requestor are
+// no longer selected, if it has no other transfers. The caller holds xc.dmu.
+func (xc *xClip) dropIncr(k incrKey) {
+	if t := xc.incr[k]; t != nil {
+		t.expire.Stop()
+	}
+	delete(xc.incr, k)
+	if k.requestor == xc.win {
+		return
+	}
+	for o := range xc.incr {
+		if o.requestor == k.requestor {
+			return
 		}
 	}
+	xproto.ChangeWindowAttributes(xc.conn, k.requestor, xproto.CwEventMask, []uint32{0})
 }
 
 func (xc *xClip) sendSelectionNotify(e xproto.SelectionRequestEvent) {
@@ -235,6 +437,15 @@ func (xc *xClip) internAtom(n string) xproto.Atom {
 	return iar.Atom
 }
 
+// Atom returns the atom with the given name, which is created if it does not exist.
+func (xc *xClip) atom(name string) (xproto.Atom, error) {
+	iar, err := xproto.InternAtom(xc.conn, false, uint16(len(name)), name).Reply()
+	if err != nil {
+		return 0, err
+	}
+	return iar.Atom, nil
+}
+
 func (xc *xClip) lookupAtom(at xproto.Atom) string {
 	reply, err := xproto.GetAtomName(xc.conn, at).Reply()
 	if err != nil {
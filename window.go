@@ -0,0 +1,52 @@
+package duitdraw
+
+import "sync/atomic"
+
+// WindowEvent is a change of the keyboard focus of the window,
+// or the pointer entering or leaving it.
+// This type is not present in 9fans draw package.
+type WindowEvent int
+
+// Window events, which are received from Display.WindowEvents.
+const (
+	FocusIn      WindowEvent = iota + 1 // The window gained the keyboard focus.
+	FocusOut                            // The window lost the keyboard focus.
+	PointerEnter                        // The pointer entered the window.
+	PointerLeave                        // The pointer left the window.
+)
+
+func (e WindowEvent) String() string {
+	switch e {
+	case FocusIn:
+		return "FocusIn"
+	case FocusOut:
+		return "FocusOut"
+	case PointerEnter:
+		return "PointerEnter"
+	case PointerLeave:
+		return "PointerLeave"
+	}
+	return "WindowEvent(?)"
+}
+
+// WindowEvents returns a channel which receives the focus changes of the window
+// and the pointer entering or leaving it, e.g. to reset a hover state.
+// Mouse events on Mousectl.C are not changed.
+// Pointer crossings are only reported on X11.
+// Events are dropped if the channel is not read.
+// This method is not present in 9fans draw package.
+func (d *Display) WindowEvents() <-chan WindowEvent {
+	atomic.StoreInt32(&d.winEventsOn, 1)
+	return d.winEvents
+}
+
+// SendWindowEvent sends e to the WindowEvents channel, if it is enabled.
+func (d *Display) sendWindowEvent(e WindowEvent) {
+	if atomic.LoadInt32(&d.winEventsOn) == 0 {
+		return
+	}
+	select {
+	case d.winEvents <- e:
+	default:
+	}
+}
@@ -0,0 +1,225 @@
+// +build dragonfly freebsd linux netbsd openbsd solaris
+
+package duitdraw
+
+import (
+	"image"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/randr"
+	"github.com/BurntSushi/xgb/render"
+	"github.com/BurntSushi/xgb/xfixes"
+	"github.com/BurntSushi/xgb/xproto"
+	"golang.org/x/exp/shiny/screen"
+)
+
+// X11Display is a separate connection to the X server, which is used for
+// requests that shiny does not support.
+type x11Display struct {
+	conn   *xgb.Conn
+	root   xproto.Window
+	randr  bool              // The RandR extension is available.
+	argb   render.Pictformat // ARGB format of the RENDER extension for image cursors, or 0.
+	xfixes bool              // XFixes 5 is available for hiding the cursor and pointer barriers.
+
+	mu         sync.Mutex
+	windows    map[xproto.Window]*Display // Windows which receive events.
+	timers     map[xproto.Window]*time.Timer
+	cursors    map[xproto.Window]xproto.Cursor // Cursors which are set on windows.
+	cursorFont xproto.Font                     // The X cursor font for system cursors, or 0 if it is not open.
+	keysyms    *xproto.GetKeyboardMappingReply // Keyboard mapping for dead keys, or nil.
+	modeSwitch uint16                          // Modifier masks of Mode_switch and ISO_Level3_Shift.
+	level3     uint16
+	hidden     map[xproto.Window]bool // Windows which hide the cursor.
+	grabs      map[xproto.Window]*pointerGrab
+
+	// Dead keys are synced with shiny's key events, see pressedDeadKey.
+	deadKeys map[xproto.Window][]deadPress
+	syncs    map[xproto.Window][]chan xproto.Timestamp
+	syncAtom xproto.Atom
+}
+
+var (
+	xdpy   *x11Display
+	xdpyMu sync.Mutex
+)
+
+func getX11Display() (*x11Display, error) {
+	xdpyMu.Lock()
+	defer xdpyMu.Unlock()
+	if xdpy == nil {
+		conn, err := xgb.NewConn()
+		if err != nil {
+			return nil, err
+		}
+		xdpy = &x11Display{
+			conn:    conn,
+			root:    xproto.Setup(conn).DefaultScreen(conn).Root,
+			randr:   randr.Init(conn) == nil,
+			argb:    argbFormat(conn),
+			windows: make(map[xproto.Window]*Display),
+			timers:  make(map[xproto.Window]*time.Timer),
+			cursors: make(map[xproto.Window]xproto.Cursor),
+			hidden:  make(map[xproto.Window]bool),
+			grabs:   make(map[xproto.Window]*pointerGrab),
+
+			deadKeys: make(map[xproto.Window][]deadPress),
+			syncs:    make(map[xproto.Window][]chan xproto.Timestamp),
+		}
+		xdpy.xfixes = initXFixes(xdpy)
+		go xdpy.eventLoop()
+	}
+	return xdpy, nil
+}
+
+// X11Window returns the X window id of a shiny window.
+// The x11driver does not export it, so it is read with reflection.
+func x11Window(w screen.Window) xproto.Window {
+	v := reflect.ValueOf(w)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return 0
+	}
+	if f := v.FieldByName("xw"); f.IsValid() && f.Kind() == reflect.Uint32 {
+		return xproto.Window(f.Uint())
+	}
+	return 0
+}
+
+// WatchWindow receives X events for the window of the display.
+// The DPI is updated when the window moves or the X resources or the monitor
+// configuration change. Key presses are received to detect dead keys,
+// property changes to sync with shiny's key events,
+// and crossing events for Display.WindowEvents.
+func watchWindow(dpy *Display) {
+	d, err := getX11Display()
+	if err != nil {
+		return
+	}
+	xw := x11Window(dpy.window)
+	if xw == 0 {
+		return
+	}
+	d.mu.Lock()
+	d.windows[xw] = dpy
+	d.mu.Unlock()
+
+	// Event masks are per client, so this does not interfere with shiny.
+	xproto.ChangeWindowAttributes(d.conn, xw, xproto.CwEventMask,
+		[]uint32{xproto.EventMaskStructureNotify | xproto.EventMaskKeyPress |
+			xproto.EventMaskEnterWindow | xproto.EventMaskLeaveWindow |
+			xproto.EventMaskPropertyChange})
+	xproto.ChangeWindowAttributes(d.conn, d.root, xproto.CwEventMask,
+		[]uint32{xproto.EventMaskPropertyChange})
+	if d.randr {
+		randr.SelectInput(d.conn, d.root,
+			randr.NotifyMaskScreenChange|randr.NotifyMaskCrtcChange|randr.NotifyMaskOutputChange)
+	}
+}
+
+func unwatchWindow(dpy *Display) {
+	d, err := getX11Display()
+	if err != nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for xw, w := range d.windows {
+		if w == dpy {
+			delete(d.windows, xw)
+			if t := d.timers[xw]; t != nil {
+				t.Stop()
+				delete(d.timers, xw)
+			}
+			if c, ok := d.cursors[xw]; ok {
+				xproto.FreeCursor(d.conn, c)
+				delete(d.cursors, xw)
+			}
+			if d.hidden[xw] {
+				// The hide count belongs to this connection, which
+				// outlives the window.
+				xfixes.ShowCursor(d.conn, xw)
+				delete(d.hidden, xw)
+			}
+			delete(d.deadKeys, xw)
+			delete(d.syncs, xw)
+			d.ungrab(xw)
+		}
+	}
+}
+
+// WindowOrigin returns the position of the window on the screen.
+func windowOrigin(w screen.Window) (image.Point, bool) {
+	d, err := getX11Display()
+	if err != nil {
+		return image.Point{}, false
+	}
+	xw := x11Window(w)
+	if xw == 0 {
+		return image.Point{}, false
+	}
+	t, err := xproto.TranslateCoordinates(d.conn, xw, d.root, 0, 0).Reply()
+	if err != nil {
+		return image.Point{}, false
+	}
+	return image.Pt(int(t.DstX), int(t.DstY)), true
+}
+
+// EventLoop receives the events selected on the connection.
+func (d *x11Display) eventLoop() {
+	for {
+		e, err := d.conn.WaitForEvent()
+		if e == nil && err == nil {
+			return // Connection closed.
+		}
+		switch e := e.(type) {
+		case xproto.ConfigureNotifyEvent:
+			d.updateDPI(e.Window)
+			d.mu.Lock()
+			d.confine(e.Window)
+			d.mu.Unlock()
+		case xproto.PropertyNotifyEvent:
+			if e.Window == d.root {
+				// Xft.dpi is in the resource manager string, other root
+				// properties change with every focus switch.
+				if e.Atom == xproto.AtomResourceManager {
+					d.updateDPI(0)
+				}
+			} else {
+				d.synced(e.Window, e.Atom, e.Time)
+			}
+		case randr.ScreenChangeNotifyEvent, randr.NotifyEvent:
+			d.updateDPI(0)
+		case xproto.KeyPressEvent:
+			d.deadKey(e)
+		case xproto.EnterNotifyEvent:
+			d.crossing(e.Event, e.Mode, e.Detail, PointerEnter)
+		case xproto.LeaveNotifyEvent:
+			d.crossing(e.Event, e.Mode, e.Detail, PointerLeave)
+		case xproto.MappingNotifyEvent:
+			d.mu.Lock()
+			d.keysyms = nil
+			d.mu.Unlock()
+		}
+	}
+}
+
+// Crossing sends a pointer crossing of window xw to its display.
+// Crossings caused by a grab of another client, e.g. the window manager,
+// and from or to a child window are ignored.
+func (d *x11Display) crossing(xw xproto.Window, mode, detail byte, e WindowEvent) {
+	if mode == xproto.NotifyModeGrab || detail == xproto.NotifyDetailInferior {
+		return
+	}
+	d.mu.Lock()
+	dpy := d.windows[xw]
+	d.mu.Unlock()
+	if dpy != nil {
+		dpy.window.Send(e)
+	}
+}
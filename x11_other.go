@@ -0,0 +1,16 @@
+// +build !dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package duitdraw
+
+func watchWindow(dpy *Display) {}
+
+func unwatchWindow(dpy *Display) {}
+
+func pressedDeadKey(dpy *Display) string {
+	return ""
+}
+
+// StartIME returns nil, input methods are only supported on X11.
+func startIME(d *Display) inputMethod {
+	return nil
+}
@@ -0,0 +1,225 @@
+// +build dragonfly freebsd linux netbsd openbsd solaris
+
+package duitdraw
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"testing"
+
+	"github.com/BurntSushi/xgb/xproto"
+	"golang.org/x/exp/shiny/screen"
+)
+
+// X11TestWindow has the window id field of the x11driver's windowImpl.
+type x11TestWindow struct {
+	screen.Window
+	xw xproto.Window
+}
+
+func TestX11Window(t *testing.T) {
+	if xw := x11Window(&x11TestWindow{xw: 0x1200003}); xw != 0x1200003 {
+		t.Errorf("expected window 0x1200003 got %#x", xw)
+	}
+	if xw := x11Window(&fakeWindow{}); xw != 0 {
+		t.Errorf("expected no window got %#x", xw)
+	}
+	if _, _, err := x11DisplayWindow(&fakeWindow{}); err == nil {
+		t.Error("expected error for a window without id")
+	}
+}
+
+func TestBitmapData(t *testing.T) {
+	data := []byte{0x80, 0x01, 0x0f, 0xf0}
+	got := bitmapData(data, 16, 32, true)
+	exp := []byte{0x01, 0x80, 0, 0, 0xf0, 0x0f, 0, 0}
+	if string(got) != string(exp) {
+		t.Errorf("expected %x got %x", exp, got)
+	}
+	if got := bitmapData(data, 32, 32, false); string(got) != string(data) {
+		t.Errorf("expected %x got %x", data, got)
+	}
+}
+
+func TestArgbData(t *testing.T) {
+	m := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	m.SetRGBA(0, 0, color.RGBA{1, 2, 3, 4})
+	m.SetRGBA(1, 0, color.RGBA{5, 6, 7, 8})
+	if got, exp := argbData(m, true), []byte{3, 2, 1, 4, 7, 6, 5, 8}; string(got) != string(exp) {
+		t.Errorf("lsb first: expected %v got %v", exp, got)
+	}
+	if got, exp := argbData(m, false), []byte{4, 1, 2, 3, 8, 5, 6, 7}; string(got) != string(exp) {
+		t.Errorf("msb first: expected %v got %v", exp, got)
+	}
+}
+
+func TestCursorGlyphs(t *testing.T) {
+	for c := CursorDefault + 1; c <= CursorNotAllowed; c++ {
+		g, ok := cursorGlyphs[c]
+		if !ok {
+			t.Errorf("no glyph for cursor %d", c)
+		} else if g%2 != 0 {
+			t.Errorf("cursor %d: glyph %d is a mask", c, g)
+		}
+	}
+}
+
+func TestKeysymColumn(t *testing.T) {
+	const (
+		a, A       = 'a', 'A'
+		ae, AE     = 0xe6, 0xc6 // AltGr level 3 and 4.
+		alpha      = 0x7e1      // Group 2, e.g. Mode_switch.
+		circumflex = 0xfe52     // dead_circumflex on level 3.
+	)
+	tt := []struct {
+		syms          []xproto.Keysym
+		group         int
+		level3, shift bool
+		exp           xproto.Keysym
+	}{
+		{[]xproto.Keysym{a, A, alpha, 0, ae, AE}, 0, false, false, a},
+		{[]xproto.Keysym{a, A, alpha, 0, ae, AE}, 0, false, true, A},
+		{[]xproto.Keysym{a, A, alpha, 0, ae, AE}, 0, true, false, ae},
+		{[]xproto.Keysym{a, A, alpha, 0, ae, AE}, 0, true, true, AE},
+		{[]xproto.Keysym{a, A, alpha, 0, ae, AE}, 1, false, false, alpha},
+		{[]xproto.Keysym{a, A, alpha, 0, ae, AE}, 1, false, true, alpha},
+		{[]xproto.Keysym{a, A, 0, 0, circumflex, 0}, 0, true, true, circumflex},
+		{[]xproto.Keysym{a, A, 0, 0}, 1, false, true, A},
+		{[]xproto.Keysym{a, A}, 0, true, false, a},
+		{[]xproto.Keysym{a, 0}, 0, false, true, a},
+		{[]xproto.Keysym{a, A, alpha, 0}, 3, false, false, a},
+	}
+	for i, tc := range tt {
+		if got := keysymColumn(tc.syms, tc.group, tc.level3, tc.shift); got != tc.exp {
+			t.Errorf("%d: expected %#x got %#x", i, tc.exp, got)
+		}
+	}
+}
+
+func TestTimeAfter(t *testing.T) {
+	if !timeAfter(2, 1) || timeAfter(1, 2) || timeAfter(1, 1) {
+		t.Error("wrong order")
+	}
+	if !timeAfter(1, 0xfffffff0) {
+		t.Error("wrap around")
+	}
+}
+
+func TestBarrierLines(t *testing.T) {
+	l := barrierLines(image.Rect(10, 20, 110, 70))
+	exp := [4]image.Rectangle{
+		{image.Pt(10, 20), image.Pt(10, 70)},
+		{image.Pt(110, 20), image.Pt(110, 70)},
+		{image.Pt(10, 20), image.Pt(110, 20)},
+		{image.Pt(10, 70), image.Pt(110, 70)},
+	}
+	if l != exp {
+		t.Errorf("expected %v got %v", exp, l)
+	}
+}
+
+func TestClampPoint(t *testing.T) {
+	r := image.Rect(10, 20, 110, 70)
+	tt := []struct{ p, exp image.Point }{
+		{image.Pt(50, 30), image.Pt(50, 30)},
+		{image.Pt(0, 0), image.Pt(10, 20)},
+		{image.Pt(200, 100), image.Pt(109, 69)},
+		{image.Pt(110, 40), image.Pt(109, 40)},
+	}
+	for _, tc := range tt {
+		if got := clampPoint(tc.p, r); got != tc.exp {
+			t.Errorf("%v: expected %v got %v", tc.p, tc.exp, got)
+		}
+	}
+}
+
+// TestMoveTo warps the pointer into a window of the X server given by DISPLAY,
+// e.g. Xvfb, and checks its position on the screen.
+func TestMoveTo(t *testing.T) {
+	if os.Getenv("DISPLAY") == "" {
+		t.Skip("DISPLAY is not set")
+	}
+	d, err := getX11Display()
+	if err != nil {
+		t.Skip(err)
+	}
+	xw, err := xproto.NewWindowId(d.conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	screen := xproto.Setup(d.conn).DefaultScreen(d.conn)
+	err = xproto.CreateWindowChecked(d.conn, screen.RootDepth, xw, d.root,
+		30, 40, 200, 100, 5, // X, Y, width, height, border
+		xproto.WindowClassInputOutput, screen.RootVisual, 0, nil).Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer xproto.DestroyWindow(d.conn, xw)
+	if err := xproto.MapWindowChecked(d.conn, xw).Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	w := &x11TestWindow{xw: xw}
+	o, ok := windowOrigin(w)
+	if !ok {
+		t.Fatal("no window origin")
+	}
+	pt := image.Pt(17, 23)
+	if err := moveTo(w, pt); err != nil {
+		t.Fatal(err)
+	}
+	p, err := xproto.QueryPointer(d.conn, xw).Reply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := image.Pt(int(p.WinX), int(p.WinY)); got != pt {
+		t.Errorf("expected pointer at %v in the window got %v", pt, got)
+	}
+	if got, exp := image.Pt(int(p.RootX), int(p.RootY)), o.Add(pt); got != exp {
+		t.Errorf("expected pointer at %v on the screen got %v", exp, got)
+	}
+}
+
+func TestMimeTargets(t *testing.T) {
+	if got := mimeTargets("text/plain"); len(got) != 3 || got[0] != "UTF8_STRING" {
+		t.Errorf("text/plain: expected UTF8_STRING first got %v", got)
+	}
+	if got := mimeTargets("image/png"); len(got) != 1 || got[0] != "image/png" {
+		t.Errorf("image/png: expected [image/png] got %v", got)
+	}
+}
+
+// TestClipboard writes several types to the clipboard of the X server
+// given by DISPLAY and reads them back. The image is larger than a
+// request and is transferred incrementally.
+func TestClipboard(t *testing.T) {
+	if os.Getenv("DISPLAY") == "" {
+		t.Skip("DISPLAY is not set")
+	}
+	png := make([]byte, 1<<20)
+	for i := range png {
+		png[i] = byte(i % 251)
+	}
+	data := map[string][]byte{
+		"text/plain":    []byte("a\tb"),
+		"text/html":     []byte("<table><tr><td>a<td>b</table>"),
+		"image/png":     png,
+		"text/uri-list": []byte("file:///tmp/a.png\r\n"),
+	}
+	var d Display
+	if err := d.WriteClipboard(data); err != nil {
+		t.Fatal(err)
+	}
+	for mime, exp := range data {
+		got, err := d.ReadClipboard(mime)
+		if err != nil {
+			t.Errorf("%s: %v", mime, err)
+		} else if string(got) != string(exp) {
+			t.Errorf("%s: expected %d bytes got %d", mime, len(exp), len(got))
+		}
+	}
+	if _, err := d.ReadClipboard("application/x-unknown"); err == nil {
+		t.Error("expected error for a type which is not offered")
+	}
+}